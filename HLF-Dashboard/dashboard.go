@@ -3,11 +3,23 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"os"
 	"os/exec"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"TerminalUI/logger"
+
 	"github.com/gdamore/tcell/v2"
 	"github.com/rivo/tview"
 )
@@ -17,11 +29,87 @@ const (
 	CHAINCODE_NAME = "basic"
 	CHAINCODE_PATH = "../asset-transfer-basic/chaincode-go"
 	CHAINCODE_LANG = "go"
+	CHANNEL_NAME   = "mychannel"
+	FABRIC_CFG     = "/home/fabric-samples/config"
+)
+
+const (
+	// maxLogLines caps the retained log so verbose deploys can't grow it forever
+	maxLogLines = 5000
+	// outputFlushInterval is how often streamed command output is drawn
+	outputFlushInterval = 100 * time.Millisecond
+	// dockerRetryDelay is the wait between attempts of a failed docker command
+	dockerRetryDelay = time.Second
 )
 
+type pendingLog struct {
+	text    string
+	logType string
+}
+
+// logEntry is one line of the dashboard's log
+type logEntry struct {
+	timestamp time.Time
+	logType   string
+	text      string
+}
+
+// logManager backs the log view, keeping the newest maxLogLines entries
+// so they can be filtered, searched or exported, not just drawn.
+type logManager struct {
+	mu      sync.Mutex
+	entries []logEntry
+}
+
+func (lm *logManager) AddLogs(entries ...logEntry) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	lm.entries = append(lm.entries, entries...)
+	if len(lm.entries) > maxLogLines {
+		lm.entries = append([]logEntry(nil), lm.entries[len(lm.entries)-maxLogLines:]...)
+	}
+}
+
+func (lm *logManager) GetLogs() []logEntry {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	return append([]logEntry(nil), lm.entries...)
+}
+
+func (lm *logManager) Clear() {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	lm.entries = nil
+}
+
+type installedChaincode struct {
+	packageID string
+	label     string
+	version   string
+}
+
 func main() {
+	dockerRetries := flag.Int("docker-retries", 2, "times to retry a docker command that fails transiently")
+	classifyOutput := flag.Bool("classify-output", false, "color command output by its INFO/WARN/ERROR keywords instead of by stream, for tools that log to stderr")
+	forward := flag.String("forward", "", "also send every log to the logger server at this address, e.g. localhost:8080")
+	flag.Parse()
+
 	app := tview.NewApplication()
 
+	// Forward logs to a logger server when asked. The client reconnects in
+	// the background; logs written while the server is away are only shown
+	// locally.
+	var forwarder *logger.Client
+	if *forward != "" {
+		forwarder = logger.NewClient(*forward, logger.LineFraming)
+		forwarder.Start()
+		defer forwarder.Stop()
+	}
+
+	// Cancelled on exit so running commands and their readers are reaped
+	appCtx, cancelAll := context.WithCancel(context.Background())
+	defer cancelAll()
+
 	// Create main layout
 	mainFlex := tview.NewFlex().SetDirection(tview.FlexRow)
 
@@ -47,47 +135,101 @@ func main() {
 	helpView.SetBorder(true).SetTitle("[::u]Help & Instructions").SetBorderColor(tcell.ColorYellow)
 
 	// Instruction message
-	helpMessage := `[yellow]Instructions: [white]Use [lime]Tab[white] to switch focus, [lime]Enter[white] to execute, and [lime]Esc[white] to exit. Commands: [lime]Up[white]=Start Network, [lime]Down[white]=Stop Network, [lime]Deploy[white]=Deploy Chaincode, [lime]Clear[white]=Logs. Logs: [lime]Green[white]=Success, [red]Red[white]=Error, [yellow]Yellow[white]=Info.`
+	helpMessage := `[yellow]Instructions: [white]Use [lime]Tab[white] to switch focus, [lime]Enter[white] to execute, and [lime]Esc[white] to exit. Commands: [lime]Up[white]=Start Network, [lime]Down[white]=Stop Network, [lime]Deploy[white]=Deploy Chaincode, [lime]Chaincodes[white]=List Installed, [lime]Channels[white]=Peer Logs by Channel, [lime]Clear[white]=Logs. Logs: [lime]Green[white]=Success, [red]Red[white]=Error, [yellow]Yellow[white]=Info.`
 	paddingWidth := 50
 	paddedMessage := fmt.Sprintf("%s%s", helpMessage, strings.Repeat(" ", paddingWidth))
 
-	// Function to scroll text horizontally
+	// Scroll the help text horizontally until the app exits. The text is
+	// only touched on the UI goroutine, and nothing is drawn once the
+	// event loop is gone.
+	helpView.SetText(paddedMessage)
 	go func() {
+		ticker := time.NewTicker(100 * time.Millisecond)
+		defer ticker.Stop()
 		for {
-			helpView.SetText(paddedMessage)
-			time.Sleep(100 * time.Millisecond)
-			paddedMessage = paddedMessage[1:] + paddedMessage[:1]
-			app.Draw()
+			select {
+			case <-appCtx.Done():
+				return
+			case <-ticker.C:
+				app.QueueUpdateDraw(func() {
+					paddedMessage = paddedMessage[1:] + paddedMessage[:1]
+					helpView.SetText(paddedMessage)
+				})
+			}
 		}
 	}()
 
-	// Function to append logs with timestamp and color coding
-	appendLog := func(text string, logType string) {
-		timestamp := time.Now().Format("15:04:05")
-		var coloredText string
-		switch logType {
-		case "info":
-			coloredText = fmt.Sprintf("[yellow]%s │[white] %s", timestamp, text)
-		case "success":
-			coloredText = fmt.Sprintf("[lime]%s │ %s[white]", timestamp, text)
-		case "error":
-			coloredText = fmt.Sprintf("[red]%s │ %s[white]", timestamp, text)
-		case "system":
-			coloredText = fmt.Sprintf("[blue]%s │ %s[white]", timestamp, text)
-		case "chaincode":
-			coloredText = fmt.Sprintf("[yellow]%s │[orange] %s[white]", timestamp, text)
-		case "peer":
-			coloredText = fmt.Sprintf("[yellow]%s │[cyan] %s[white]", timestamp, text)
-		default:
-			coloredText = fmt.Sprintf("[white]%s │ %s", timestamp, text)
-		}
-		logView.SetText(logView.GetText(true) + coloredText + "\n")
+	// Retained log lines, newest last
+	logs := &logManager{}
+
+	// Redraw the log view from the stored entries
+	renderLogView := func() {
+		entries := logs.GetLogs()
+		lines := make([]string, len(entries))
+		for i, entry := range entries {
+			lines[i] = renderLogEntry(entry)
+		}
+		logView.SetText(strings.Join(lines, "\n") + "\n")
 		logView.ScrollToEnd()
 	}
 
+	// Function to store logs with a timestamp, redrawing once
+	appendLogs := func(batch []pendingLog) {
+		now := time.Now()
+		entries := make([]logEntry, len(batch))
+		for i, log := range batch {
+			entries[i] = logEntry{timestamp: now, logType: log.logType, text: log.text}
+		}
+		logs.AddLogs(entries...)
+		renderLogView()
+
+		if forwarder != nil {
+			for _, entry := range entries {
+				forwarder.Send(fmt.Sprintf("%s %s: %s", entry.timestamp.Format("2006-01-02 15:04:05"), serverLevel(entry.logType), entry.text))
+			}
+		}
+	}
+
+	appendLog := func(text string, logType string) {
+		appendLogs([]pendingLog{{text, logType}})
+	}
+
+	clearLogs := func() {
+		logs.Clear()
+		logView.Clear()
+	}
+
+	// Run a docker command, retrying transient failures such as a busy
+	// daemon. A missing container or docker binary fails straight away.
+	runDocker := func(args ...string) ([]byte, []byte, error) {
+		for attempt := 1; ; attempt++ {
+			var outBuf, errBuf bytes.Buffer
+			cmd := exec.CommandContext(appCtx, "docker", args...)
+			cmd.Stdout = &outBuf
+			cmd.Stderr = &errBuf
+
+			err := cmd.Run()
+			if err == nil || attempt > *dockerRetries ||
+				errors.Is(err, exec.ErrNotFound) || strings.Contains(errBuf.String(), "No such container") {
+				return outBuf.Bytes(), errBuf.Bytes(), err
+			}
+
+			appendLog(fmt.Sprintf("docker %s failed (%v), retrying in %v (attempt %d of %d)",
+				args[0], err, dockerRetryDelay, attempt+1, *dockerRetries+1), "system")
+			select {
+			case <-appCtx.Done():
+				return outBuf.Bytes(), errBuf.Bytes(), err
+			case <-time.After(dockerRetryDelay):
+			}
+		}
+	}
+
 	// Function to execute a command and append output to logs
 	executeCommand := func(args ...string) {
-		cmd := exec.Command(NETWORK_SCRIPT, args...)
+		ctx, cancel := context.WithCancel(appCtx)
+		defer cancel()
+
+		cmd := exec.CommandContext(ctx, NETWORK_SCRIPT, args...)
 		cmd.Dir = "/home/fabric-samples/test-network"
 
 		stdoutPipe, err := cmd.StdoutPipe()
@@ -114,113 +256,125 @@ func main() {
 		stdoutChan := make(chan string)
 		stderrChan := make(chan string)
 
-		// Read stdout asynchronously
-		go func() {
-			scanner := bufio.NewScanner(stdoutPipe)
-			for scanner.Scan() {
-				stdoutChan <- scanner.Text()
-			}
-			close(stdoutChan)
-		}()
+		// Read the pipes asynchronously, giving up once the command is
+		// cancelled
+		go readPipe(ctx, stdoutPipe, stdoutChan)
+		go readPipe(ctx, stderrPipe, stderrChan)
 
-		// Read stderr asynchronously
+		// Process output in real-time, drawing it in batches so a chatty
+		// command doesn't redraw the view for every line
+		done := make(chan struct{})
 		go func() {
-			scanner := bufio.NewScanner(stderrPipe)
-			for scanner.Scan() {
-				stderrChan <- scanner.Text()
-			}
-			close(stderrChan)
-		}()
+			defer close(done)
+			ticker := time.NewTicker(outputFlushInterval)
+			defer ticker.Stop()
 
-		// Process output in real-time
-		done := make(chan bool)
-		go func() {
-			for {
+			var batch []pendingLog
+			for stdoutChan != nil || stderrChan != nil {
 				select {
 				case line, ok := <-stdoutChan:
 					if !ok {
 						stdoutChan = nil
+					} else if *classifyOutput {
+						batch = append(batch, pendingLog{line, classifyLine(line)})
 					} else {
-						appendLog(line, "info")
+						batch = append(batch, pendingLog{line, "info"})
 					}
 				case line, ok := <-stderrChan:
 					if !ok {
 						stderrChan = nil
+					} else if *classifyOutput {
+						batch = append(batch, pendingLog{line, classifyLine(line)})
 					} else {
-						appendLog(line, "error")
+						batch = append(batch, pendingLog{line, "error"})
+					}
+				case <-ticker.C:
+					if len(batch) > 0 {
+						appendLogs(batch)
+						batch = nil
 					}
 				}
-
-				// Exit when both channels are closed
-				if stdoutChan == nil && stderrChan == nil {
-					done <- true
-					return
-				}
+			}
+			if len(batch) > 0 {
+				appendLogs(batch)
 			}
 		}()
 
-		<-done
+		// Wait for the output to drain, or for the command to be cancelled
+		// while something still holds its pipes open
+		select {
+		case <-done:
+		case <-ctx.Done():
+		}
 
-		// Wait for the command to finish
-		if err := cmd.Wait(); err != nil {
+		// Wait for the command to finish; this also closes the pipes, so
+		// the readers above are never left blocked
+		err = cmd.Wait()
+		<-done
+		if err != nil {
 			appendLog(fmt.Sprintf("Command finished with error: %v", err), "error")
 		} else {
 			appendLog("Command completed successfully", "success")
 		}
 	}
 
-	// Improved fetchPeerLogs function
-	fetchPeerLogs := func(peerName string) {
+	// Improved fetchPeerLogs function; tail and since are as typed into
+	// the peer logs fields
+	fetchPeerLogs := func(peerName, tail, since string) {
+		args, err := dockerLogsArgs(peerName, tail, since)
+		if err != nil {
+			appendLog(err.Error(), "error")
+			return
+		}
 		appendLog(fmt.Sprintf("Fetching logs for peer: %s", peerName), "peer")
 
 		// Check if container exists and is running
-		checkCmd := exec.Command("docker", "ps", "--format", "{{.Names}}", "--filter", fmt.Sprintf("name=%s", peerName))
-		checkOutput, err := checkCmd.CombinedOutput()
-		if err != nil || len(checkOutput) == 0 {
+		checkOutput, _, err := runDocker("ps", "--format", "{{.Names}}", "--filter", fmt.Sprintf("name=%s", peerName))
+		if err != nil {
+			appendLog(fmt.Sprintf("Error checking peer container %s: %v", peerName, err), "error")
+			return
+		}
+		if len(checkOutput) == 0 {
 			appendLog(fmt.Sprintf("Error: Peer container %s is not running", peerName), "error")
 			return
 		}
 
 		// Execute docker logs command with proper parameters
-		cmd := exec.Command("docker", "logs", "--tail", "1000", "--timestamps", peerName)
-
-		var outBuf, errBuf bytes.Buffer
-		cmd.Stdout = &outBuf
-		cmd.Stderr = &errBuf
-
-		err = cmd.Run()
+		stdout, stderr, err := runDocker(args...)
 		if err != nil {
 			appendLog(fmt.Sprintf("Error executing docker logs command: %v", err), "error")
-			if errContent := errBuf.String(); errContent != "" {
+			if errContent := string(stderr); errContent != "" {
 				appendLog(fmt.Sprintf("Docker error output: %s", errContent), "error")
 			}
 			return
 		}
 
 		// Process stdout logs
-		logs := outBuf.String()
+		logs := string(stdout)
 		if logs == "" {
 			appendLog(fmt.Sprintf("No stdout logs found for peer %s", peerName), "info")
 		} else {
 			appendLog("Found logs for peer. Processing...", "info")
-			logLines := strings.Split(logs, "\n")
-			for _, line := range logLines {
+			var peerLogs []pendingLog
+			for _, line := range strings.Split(logs, "\n") {
 				if strings.TrimSpace(line) != "" {
-					appendLog(strings.TrimSpace(line), "peer")
+					peerLogs = append(peerLogs, pendingLog{strings.TrimSpace(line), "peer"})
 				}
 			}
+			appendLogs(peerLogs)
 		}
 
 		// Process stderr logs if any
-		errLogs := errBuf.String()
+		errLogs := string(stderr)
 		if errLogs != "" {
 			appendLog("Processing error logs...", "info")
-			errLogLines := strings.Split(errLogs, "\n")
-			for _, line := range errLogLines {
+			var peerErrors []pendingLog
+			for _, line := range strings.Split(errLogs, "\n") {
 				if strings.TrimSpace(line) != "" {
-					appendLog(line, "error")
+					peerErrors = append(peerErrors, pendingLog{line, "error"})
 				}
 			}
+			appendLogs(peerErrors)
 		}
 
 		appendLog("Finished fetching logs", "success")
@@ -240,19 +394,35 @@ func main() {
 		peerOptions = append(peerOptions, label)
 	}
 
+	// How much history to pull: the last -tail lines, or "all", and only
+	// those newer than -since, a duration such as 30m or a timestamp
+	tailField := tview.NewInputField().
+		SetLabel("Tail: ").
+		SetText("1000").
+		SetFieldWidth(8)
+	sinceField := tview.NewInputField().
+		SetLabel("Since: ").
+		SetPlaceholder("e.g. 30m").
+		SetFieldWidth(22)
+
 	// Create improved dropdown for peer logs
 	peerDropdown := tview.NewDropDown().
 		SetLabel("Select Peer: ").
 		SetOptions(peerOptions, func(option string, index int) {
 			if containerName, ok := peerContainers[option]; ok {
-				logView.Clear()
+				clearLogs()
 				appendLog(fmt.Sprintf("Selected peer: %s (%s)", option, containerName), "system")
+				tail, since := tailField.GetText(), sinceField.GetText()
 				go func() {
-					fetchPeerLogs(containerName)
+					fetchPeerLogs(containerName, tail, since)
 				}()
 			}
 		})
-	peerDropdown.SetBorder(true).SetTitle("Peer Logs")
+	peerFlex := tview.NewFlex().
+		AddItem(peerDropdown, 0, 1, false).
+		AddItem(tailField, 16, 0, false).
+		AddItem(sinceField, 30, 0, false)
+	peerFlex.SetBorder(true).SetTitle("Peer Logs")
 
 	// Create buttons
 	networkUpBtn := tview.NewButton("Network Up").
@@ -281,8 +451,7 @@ func main() {
 		specs.WriteString("=== Network Specifications ===\n")
 
 		// Fetch peers and map them to organizations
-		cmd := exec.Command("docker", "ps", "--format", "{{.Names}}", "--filter", "name=peer")
-		output, err := cmd.Output()
+		output, _, err := runDocker("ps", "--format", "{{.Names}}", "--filter", "name=peer")
 		if err != nil {
 			return fmt.Sprintf("Error fetching peers: %v\n", err)
 		}
@@ -305,39 +474,330 @@ func main() {
 		return specs.String()
 	}
 
-	fetchInstalledChaincodes := func() string {
-		cmd := exec.Command("peer", "lifecycle", "chaincode", "queryinstalled")
-		cmd.Env = append(cmd.Env, "FABRIC_CFG_PATH=/home/fabric-samples/config") // Ensure the correct environment
+	// Run a peer CLI command against the test network config
+	runPeerCommand := func(args ...string) (string, error) {
+		cmd := exec.Command("peer", args...)
+		cmd.Env = append(os.Environ(), "FABRIC_CFG_PATH="+FABRIC_CFG) // Ensure the correct environment
 
 		output, err := cmd.Output()
-		if err != nil {
-			return fmt.Sprintf("Error fetching chaincodes: %v\n", err)
-		}
-
-		return fmt.Sprintf("=== Installed Chaincodes ===\n%s", string(output))
+		return string(output), err
 	}
 
 	fetchHLFNetworkInfo := func() string {
 		var info strings.Builder
 		info.WriteString(fetchNetworkSpecs())
-		info.WriteString("\n")
-		info.WriteString(fetchInstalledChaincodes())
 		return info.String()
 	}
 
 	networkInfoBtn := tview.NewButton("Show Network Info").
 		SetSelectedFunc(func() {
 			go func() {
-				logView.Clear()
+				clearLogs()
 				appendLog("Fetching network specifications...", "system")
 				networkInfo := fetchHLFNetworkInfo()
 				appendLog(networkInfo, "info")
 			}()
 		})
 
+	// Pages let the chaincode list sit over the main layout
+	pages := tview.NewPages()
+
+	closeChaincodes := func() {
+		pages.RemovePage("chaincodes")
+		app.SetFocus(buttonFlex)
+	}
+
+	// Actions for a chaincode picked from the list
+	// Query a chaincode function, checking the function name and args as
+	// they are typed and showing the exact command Run will execute
+	showQueryForm := func(name string) {
+		closeForm := func() { pages.RemovePage("chaincode-query") }
+		status := tview.NewTextView().SetDynamicColors(true)
+		var command []string
+		form := tview.NewForm()
+		check := func(string) {
+			fn := form.GetFormItemByLabel("Function").(*tview.InputField).GetText()
+			args := form.GetFormItemByLabel("Args").(*tview.InputField).GetText()
+			var err error
+			command, err = chaincodeQueryArgs(name, fn, args)
+			if err != nil {
+				status.SetText("[red]" + tview.Escape(err.Error()))
+				return
+			}
+			status.SetText("[green]Will run:[white] " + tview.Escape("peer "+shellJoin(command)))
+		}
+		form.AddInputField("Function", "", 40, nil, check).
+			AddInputField("Args", "", 40, nil, check).
+			AddButton("Run", func() {
+				if command == nil {
+					return
+				}
+				args := command
+				closeForm()
+				closeChaincodes()
+				go func() {
+					appendLog(fmt.Sprintf("Running: peer %s", shellJoin(args)), "system")
+					output, err := runPeerCommand(args...)
+					if err != nil {
+						appendLog(fmt.Sprintf("Error running query: %v", err), "error")
+						return
+					}
+					appendLog(strings.TrimSpace(output), "chaincode")
+				}()
+			}).
+			AddButton("Cancel", closeForm).
+			SetCancelFunc(closeForm)
+		form.GetFormItemByLabel("Args").(*tview.InputField).SetPlaceholder(`a,b or ["a","b"]`)
+		check("")
+
+		queryFlex := tview.NewFlex().SetDirection(tview.FlexRow).
+			AddItem(form, 7, 0, true).
+			AddItem(status, 0, 1, false)
+		queryFlex.SetBorder(true).SetTitle(fmt.Sprintf("[::u]Query %s (Esc: close)", name)).SetBorderColor(tcell.ColorOrange)
+		pages.AddPage("chaincode-query", queryFlex, true, true)
+	}
+
+	chaincodeActions := func(cc installedChaincode) {
+		name := chaincodeName(cc.label)
+		modal := tview.NewModal().
+			SetText(fmt.Sprintf("%s\n%s", cc.label, cc.packageID)).
+			AddButtons([]string{"Query", "Query Approved", "Query Committed", "Close"}).
+			SetDoneFunc(func(buttonIndex int, buttonLabel string) {
+				pages.RemovePage("chaincode-actions")
+				var args []string
+				switch buttonLabel {
+				case "Query":
+					showQueryForm(name)
+					return
+				case "Query Approved":
+					args = []string{"lifecycle", "chaincode", "queryapproved", "-C", CHANNEL_NAME, "-n", name}
+				case "Query Committed":
+					args = []string{"lifecycle", "chaincode", "querycommitted", "-C", CHANNEL_NAME, "-n", name}
+				default:
+					return
+				}
+				closeChaincodes()
+				go func() {
+					appendLog(fmt.Sprintf("Running: peer %s", strings.Join(args, " ")), "system")
+					output, err := runPeerCommand(args...)
+					if err != nil {
+						appendLog(fmt.Sprintf("Error running %s: %v", buttonLabel, err), "error")
+						return
+					}
+					appendLog(strings.TrimSpace(output), "chaincode")
+				}()
+			})
+		pages.AddPage("chaincode-actions", modal, true, true)
+	}
+
+	// Show installed chaincodes as a table with a filter over label and package ID
+	showChaincodes := func(chaincodes []installedChaincode) {
+		table := tview.NewTable().
+			SetSelectable(true, false).
+			SetFixed(1, 0)
+		table.SetBorder(true).SetTitle("[::u]Installed Chaincodes (Enter: actions, Tab: filter, Esc: close)").SetBorderColor(tcell.ColorOrange)
+
+		var shown []installedChaincode
+		fillTable := func(filter string) {
+			table.Clear()
+			for col, header := range []string{"Package ID", "Label", "Version"} {
+				table.SetCell(0, col, tview.NewTableCell(header).
+					SetTextColor(tcell.ColorYellow).
+					SetSelectable(false))
+			}
+			shown = shown[:0]
+			filter = strings.ToLower(filter)
+			for _, cc := range chaincodes {
+				if filter != "" &&
+					!strings.Contains(strings.ToLower(cc.label), filter) &&
+					!strings.Contains(strings.ToLower(cc.packageID), filter) {
+					continue
+				}
+				row := len(shown) + 1
+				table.SetCell(row, 0, tview.NewTableCell(cc.packageID).SetExpansion(1))
+				table.SetCell(row, 1, tview.NewTableCell(cc.label))
+				table.SetCell(row, 2, tview.NewTableCell(cc.version))
+				shown = append(shown, cc)
+			}
+			table.Select(1, 0)
+		}
+		table.SetSelectedFunc(func(row, column int) {
+			if row > 0 && row <= len(shown) {
+				chaincodeActions(shown[row-1])
+			}
+		})
+
+		filterField := tview.NewInputField().
+			SetLabel("Filter: ").
+			SetChangedFunc(fillTable).
+			SetDoneFunc(func(key tcell.Key) {
+				app.SetFocus(table)
+			})
+		fillTable("")
+
+		chaincodeFlex := tview.NewFlex().SetDirection(tview.FlexRow).
+			AddItem(filterField, 1, 0, false).
+			AddItem(table, 0, 1, true)
+		chaincodeFlex.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+			if event.Key() == tcell.KeyTab {
+				if table.HasFocus() {
+					app.SetFocus(filterField)
+				} else {
+					app.SetFocus(table)
+				}
+				return nil
+			}
+			return event
+		})
+
+		pages.AddPage("chaincodes", chaincodeFlex, true, true)
+		app.SetFocus(table)
+	}
+
+	chaincodesBtn := tview.NewButton("Chaincodes").
+		SetSelectedFunc(func() {
+			go func() {
+				appendLog("Fetching installed chaincodes...", "chaincode")
+				output, err := runPeerCommand("lifecycle", "chaincode", "queryinstalled")
+				if err != nil {
+					appendLog(fmt.Sprintf("Error fetching chaincodes: %v", err), "error")
+					return
+				}
+
+				chaincodes, err := parseInstalledChaincodes(output)
+				if err != nil {
+					appendLog(fmt.Sprintf("=== Installed Chaincodes ===\n%s", output), "chaincode")
+					return
+				}
+				if len(chaincodes) == 0 {
+					appendLog("No chaincodes installed", "chaincode")
+					return
+				}
+				app.QueueUpdateDraw(func() {
+					showChaincodes(chaincodes)
+				})
+			}()
+		})
+
+	closeChannels := func() {
+		pages.RemovePage("channels")
+		app.SetFocus(buttonFlex)
+	}
+
+	// Channels: every peer's logs that name a channel, interleaved by time
+	// and colored by channel, with channels toggled on and off on the left
+	showChannels := func(entries []channelLog) {
+		colors := logger.NewSourceColors()
+		var channels []string
+		enabled := make(map[string]bool)
+		for _, entry := range entries {
+			if _, ok := enabled[entry.channel]; !ok {
+				channels = append(channels, entry.channel)
+				enabled[entry.channel] = true
+			}
+		}
+		slices.Sort(channels)
+
+		view := tview.NewTextView().
+			SetDynamicColors(true).
+			SetScrollable(true)
+		view.SetBorder(true).SetTitle("[::u]Channel Logs")
+		render := func() {
+			var lines []string
+			for _, entry := range entries {
+				if enabled[entry.channel] {
+					lines = append(lines, fmt.Sprintf("[%s]%s[white] [gray]%s[white] %s",
+						colors.Color(entry.channel), tview.Escape(entry.channel), tview.Escape(entry.peer), tview.Escape(entry.line)))
+				}
+			}
+			view.SetText(strings.Join(lines, "\n"))
+			view.ScrollToEnd()
+		}
+
+		list := tview.NewList().ShowSecondaryText(false)
+		list.SetBorder(true).SetTitle("[::u]Channels")
+		itemText := func(channel string) string {
+			mark := "[ ]"
+			if enabled[channel] {
+				mark = "[x]"
+			}
+			return fmt.Sprintf("[%s]%s %s", colors.Color(channel), tview.Escape(mark), tview.Escape(channel))
+		}
+		for _, channel := range channels {
+			list.AddItem(itemText(channel), "", 0, nil)
+		}
+		list.SetSelectedFunc(func(i int, _, _ string, _ rune) {
+			enabled[channels[i]] = !enabled[channels[i]]
+			list.SetItemText(i, itemText(channels[i]), "")
+			render()
+		})
+		render()
+
+		channelFlex := tview.NewFlex().
+			AddItem(list, 30, 0, true).
+			AddItem(view, 0, 1, false)
+		channelFlex.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+			if event.Key() == tcell.KeyTab {
+				if list.HasFocus() {
+					app.SetFocus(view)
+				} else {
+					app.SetFocus(list)
+				}
+				return nil
+			}
+			return event
+		})
+		pages.AddPage("channels", channelFlex, true, true)
+		app.SetFocus(list)
+	}
+
+	channelsBtn := tview.NewButton("Channels").
+		SetSelectedFunc(func() {
+			tail, since := tailField.GetText(), sinceField.GetText()
+			go func() {
+				if _, err := dockerLogsArgs("", tail, since); err != nil {
+					appendLog(err.Error(), "error")
+					return
+				}
+				appendLog("Fetching peer logs by channel...", "peer")
+				// Every peer at once, so the wait is the slowest one's
+				var (
+					mu      sync.Mutex
+					entries []channelLog
+					wg      sync.WaitGroup
+				)
+				for _, container := range peerContainers {
+					args, _ := dockerLogsArgs(container, tail, since)
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						stdout, stderr, err := runDocker(args...)
+						if err != nil {
+							appendLog(fmt.Sprintf("Error fetching logs for peer %s: %v", container, err), "error")
+							return
+						}
+						// Peers log to stderr, so both streams are searched
+						found := parseChannelLogs(container, string(stdout)+string(stderr))
+						mu.Lock()
+						entries = append(entries, found...)
+						mu.Unlock()
+					}()
+				}
+				wg.Wait()
+				if len(entries) == 0 {
+					appendLog("No peer logs name a channel", "info")
+					return
+				}
+				slices.SortStableFunc(entries, func(a, b channelLog) int { return a.at.Compare(b.at) })
+				app.QueueUpdateDraw(func() {
+					showChannels(entries)
+				})
+			}()
+		})
+
 	clearLogsBtn := tview.NewButton("Clear Logs").
 		SetSelectedFunc(func() {
-			logView.SetText("")
+			clearLogs()
 			appendLog("Logs cleared", "system")
 		})
 
@@ -347,15 +807,31 @@ func main() {
 	buttonFlex.AddItem(deployChaincodeBtn, 0, 1, true)
 	buttonFlex.AddItem(clearLogsBtn, 0, 1, true)
 	buttonFlex.AddItem(networkInfoBtn, 0, 1, true)
+	buttonFlex.AddItem(chaincodesBtn, 0, 1, true)
+	buttonFlex.AddItem(channelsBtn, 0, 1, true)
 
 	// Layout setup
 	mainFlex.AddItem(buttonFlex, 5, 1, true)
-	mainFlex.AddItem(peerDropdown, 3, 0, false)
+	mainFlex.AddItem(peerFlex, 3, 0, false)
 	mainFlex.AddItem(logView, 0, 2, false)
 	mainFlex.AddItem(helpView, 3, 1, false)
+	pages.AddPage("main", mainFlex, true, true)
 
 	// Set up key bindings
 	app.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		// The chaincode list and its actions handle their own keys
+		if front, _ := pages.GetFrontPage(); front != "main" {
+			if event.Key() == tcell.KeyEscape && front == "chaincodes" {
+				closeChaincodes()
+				return nil
+			}
+			if event.Key() == tcell.KeyEscape && front == "channels" {
+				closeChannels()
+				return nil
+			}
+			return event
+		}
+
 		switch event.Key() {
 		case tcell.KeyEscape:
 			app.Stop()
@@ -364,6 +840,10 @@ func main() {
 			if buttonFlex.HasFocus() {
 				app.SetFocus(peerDropdown)
 			} else if peerDropdown.HasFocus() {
+				app.SetFocus(tailField)
+			} else if tailField.HasFocus() {
+				app.SetFocus(sinceField)
+			} else if sinceField.HasFocus() {
 				app.SetFocus(logView)
 			} else {
 				app.SetFocus(buttonFlex)
@@ -377,7 +857,245 @@ func main() {
 	appendLog("Welcome to Hyperledger Fabric Test Network Control", "info")
 	appendLog("Application started - See help section below for instructions", "system")
 
-	if err := app.SetRoot(mainFlex, true).EnableMouse(true).Run(); err != nil {
+	if err := app.SetRoot(pages, true).EnableMouse(true).Run(); err != nil {
 		panic(err)
 	}
 }
+
+// channelPattern finds the channel a peer log line is about, as in
+// "... -> [mychannel] Committed block [6]" or "channel=mychannel"
+var channelPattern = regexp.MustCompile(`(?:-> \[|\bchannel[=:] ?\[?)([a-z][a-z0-9.-]*)`)
+
+// channelLog is a peer log line naming a channel
+type channelLog struct {
+	peer    string
+	channel string
+	at      time.Time // from docker's --timestamps prefix
+	line    string
+}
+
+// readPipe sends each line read from pipe to lines, closing it once the
+// pipe is drained or ctx is done, so a reader nobody is listening to
+// doesn't block for ever.
+func readPipe(ctx context.Context, pipe io.Reader, lines chan<- string) {
+	defer close(lines)
+	scanner := bufio.NewScanner(pipe)
+	for scanner.Scan() {
+		select {
+		case lines <- scanner.Text():
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// parseChannelLogs picks the lines of a peer's docker logs output that
+// name a channel.
+func parseChannelLogs(peer, output string) []channelLog {
+	var entries []channelLog
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		match := channelPattern.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		entry := channelLog{peer: peer, channel: match[1], line: line}
+		if stamp, rest, ok := strings.Cut(line, " "); ok {
+			if at, err := time.Parse(time.RFC3339Nano, stamp); err == nil {
+				entry.at, entry.line = at, rest
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// functionNamePattern is what a chaincode function may be called,
+// optionally prefixed by its contract as in "Contract:Function"
+var functionNamePattern = regexp.MustCompile(`^(?:[A-Za-z_]\w*:)?[A-Za-z_]\w*$`)
+
+// chaincodeQueryArgs builds the peer command querying fn on the chaincode
+// called name with args, as parseChaincodeArgs reads them.
+func chaincodeQueryArgs(name, fn, args string) ([]string, error) {
+	fn = strings.TrimSpace(fn)
+	if fn == "" {
+		return nil, errors.New("function name is required")
+	}
+	if !functionNamePattern.MatchString(fn) {
+		return nil, fmt.Errorf("invalid function name %q, want letters, digits and underscores", fn)
+	}
+	parsed, err := parseChaincodeArgs(args)
+	if err != nil {
+		return nil, err
+	}
+	ctor, err := json.Marshal(struct {
+		Args []string `json:"Args"`
+	}{append([]string{fn}, parsed...)})
+	if err != nil {
+		return nil, err
+	}
+	return []string{"chaincode", "query", "-C", CHANNEL_NAME, "-n", name, "-c", string(ctor)}, nil
+}
+
+// parseChaincodeArgs reads chaincode args either as a JSON array, whose
+// numbers and booleans are passed as text and objects as their JSON, or
+// as a comma-separated list. Empty input is no args.
+func parseChaincodeArgs(input string) ([]string, error) {
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return nil, nil
+	}
+	if strings.HasPrefix(input, "[") {
+		var values []json.RawMessage
+		if err := json.Unmarshal([]byte(input), &values); err != nil {
+			return nil, fmt.Errorf("invalid JSON args: %v", err)
+		}
+		args := make([]string, len(values))
+		for i, value := range values {
+			if err := json.Unmarshal(value, &args[i]); err != nil {
+				args[i] = string(value)
+			}
+		}
+		return args, nil
+	}
+	args := strings.Split(input, ",")
+	for i, arg := range args {
+		if args[i] = strings.TrimSpace(arg); args[i] == "" {
+			return nil, fmt.Errorf("argument %d is empty", i+1)
+		}
+	}
+	return args, nil
+}
+
+// shellJoin joins args into a command line a shell would split back the
+// same way, for showing what will run.
+func shellJoin(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = arg
+		if arg == "" || strings.ContainsAny(arg, " \t\n\"'\\$`{}[]*?;&|<>()#~!") {
+			quoted[i] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+		}
+	}
+	return strings.Join(quoted, " ")
+}
+
+// dockerLogsArgs builds the docker logs command for container, checking
+// tail is a line count or "all" and since a duration or timestamp, either
+// of which may be left empty.
+func dockerLogsArgs(container, tail, since string) ([]string, error) {
+	args := []string{"logs", "--timestamps"}
+	if tail = strings.TrimSpace(tail); tail != "" {
+		if n, err := strconv.Atoi(tail); tail != "all" && (err != nil || n < 0) {
+			return nil, fmt.Errorf("invalid tail %q, want a number of lines or \"all\"", tail)
+		}
+		args = append(args, "--tail", tail)
+	}
+	if since = strings.TrimSpace(since); since != "" {
+		if !validSince(since) {
+			return nil, fmt.Errorf("invalid since %q, want a duration such as 30m or a timestamp such as 2006-01-02T15:04:05Z", since)
+		}
+		args = append(args, "--since", since)
+	}
+	return append(args, container), nil
+}
+
+// validSince reports whether docker logs --since takes since: a duration
+// back from now, or a date or timestamp.
+func validSince(since string) bool {
+	if _, err := time.ParseDuration(since); err == nil {
+		return true
+	}
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05", time.DateOnly} {
+		if _, err := time.Parse(layout, since); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// parseInstalledChaincodes parses `peer lifecycle chaincode queryinstalled`
+// output, which looks like:
+//
+//	Installed chaincodes on peer:
+//	Package ID: basic_1.0:69de7483...07f3, Label: basic_1.0
+func parseInstalledChaincodes(output string) ([]installedChaincode, error) {
+	if !strings.Contains(output, "Installed chaincodes on peer:") {
+		return nil, fmt.Errorf("unrecognised queryinstalled output")
+	}
+
+	var chaincodes []installedChaincode
+	for _, line := range strings.Split(output, "\n") {
+		rest, ok := strings.CutPrefix(strings.TrimSpace(line), "Package ID: ")
+		if !ok {
+			continue
+		}
+		packageID, label, ok := strings.Cut(rest, ", Label: ")
+		if !ok {
+			return nil, fmt.Errorf("unrecognised chaincode line %q", line)
+		}
+		cc := installedChaincode{packageID: packageID, label: label}
+		if i := strings.LastIndex(label, "_"); i >= 0 {
+			cc.version = label[i+1:]
+		}
+		chaincodes = append(chaincodes, cc)
+	}
+	return chaincodes, nil
+}
+
+// chaincodeName strips the version from a package label, "basic_1.0" -> "basic"
+func chaincodeName(label string) string {
+	if i := strings.LastIndex(label, "_"); i >= 0 {
+		return label[:i]
+	}
+	return label
+}
+
+// classifyLine picks a log type for a line of command output from the
+// level keywords in it, whichever stream it came from
+func classifyLine(line string) string {
+	upper := strings.ToUpper(line)
+	switch {
+	case strings.Contains(upper, "ERROR") || strings.Contains(upper, "FATAL") || strings.Contains(upper, "PANIC"):
+		return "error"
+	case strings.Contains(upper, "WARN"):
+		return "warning"
+	default:
+		return "info"
+	}
+}
+
+// serverLevel maps a dashboard log type to a logger server level
+func serverLevel(logType string) string {
+	switch logType {
+	case "error":
+		return "ERROR"
+	case "warning":
+		return "WARNING"
+	default:
+		return "INFO"
+	}
+}
+
+// renderLogEntry colors an entry by its type
+func renderLogEntry(entry logEntry) string {
+	timestamp := entry.timestamp.Format("15:04:05")
+	switch entry.logType {
+	case "info":
+		return fmt.Sprintf("[yellow]%s │[white] %s", timestamp, entry.text)
+	case "success":
+		return fmt.Sprintf("[lime]%s │ %s[white]", timestamp, entry.text)
+	case "error":
+		return fmt.Sprintf("[red]%s │ %s[white]", timestamp, entry.text)
+	case "warning":
+		return fmt.Sprintf("[yellow]%s │ %s[white]", timestamp, entry.text)
+	case "system":
+		return fmt.Sprintf("[blue]%s │ %s[white]", timestamp, entry.text)
+	case "chaincode":
+		return fmt.Sprintf("[yellow]%s │[orange] %s[white]", timestamp, entry.text)
+	case "peer":
+		return fmt.Sprintf("[yellow]%s │[cyan] %s[white]", timestamp, entry.text)
+	default:
+		return fmt.Sprintf("[white]%s │ %s", timestamp, entry.text)
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadPipe(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   []string
+	}{
+		{"lines", "Creating channel\nChannel created\n", []string{"Creating channel", "Channel created"}},
+		{"no trailing newline", "one\ntwo", []string{"one", "two"}},
+		{"empty", "", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines := make(chan string)
+			go readPipe(context.Background(), strings.NewReader(tt.output), lines)
+			var got []string
+			for line := range lines {
+				got = append(got, line)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("read %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadPipeCancelled(t *testing.T) {
+	// Output nobody reads, from a pipe that never closes
+	pr, pw := io.Pipe()
+	defer pw.Close()
+	go io.WriteString(pw, "one\ntwo\n")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	lines := make(chan string)
+	returned := make(chan struct{})
+	go func() {
+		readPipe(ctx, pr, lines)
+		close(returned)
+	}()
+	cancel()
+	select {
+	case <-returned:
+	case <-time.After(time.Second):
+		t.Fatal("readPipe still blocked after its context was cancelled")
+	}
+	for line := range lines {
+		t.Errorf("read %q after cancelling", line)
+	}
+}
+
+func TestDockerLogsArgs(t *testing.T) {
+	tests := []struct {
+		tail, since string
+		want        []string
+		ok          bool
+	}{
+		{"", "", []string{"logs", "--timestamps", "peer0"}, true},
+		{"100", "", []string{"logs", "--timestamps", "--tail", "100", "peer0"}, true},
+		{" all ", " 30m ", []string{"logs", "--timestamps", "--tail", "all", "--since", "30m", "peer0"}, true},
+		{"0", "2024-01-01", []string{"logs", "--timestamps", "--tail", "0", "--since", "2024-01-01", "peer0"}, true},
+		{"-1", "", nil, false},
+		{"ten", "", nil, false},
+		{"", "yesterday", nil, false},
+	}
+	for _, tt := range tests {
+		got, err := dockerLogsArgs("peer0", tt.tail, tt.since)
+		if (err == nil) != tt.ok || !slices.Equal(got, tt.want) {
+			t.Errorf("dockerLogsArgs(%q, %q) = %q, %v, want %q, ok %v", tt.tail, tt.since, got, err, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestValidSince(t *testing.T) {
+	tests := []struct {
+		since string
+		want  bool
+	}{
+		{"30m", true},
+		{"1h30m", true},
+		{"2024-01-01T10:00:00Z", true},
+		{"2024-01-01T10:00:00.5+02:00", true},
+		{"2024-01-01T10:00:00", true},
+		{"2024-01-01", true},
+		{"2024-01-01 10:00:00", false},
+		{"30", false},
+		{"1d", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := validSince(tt.since); got != tt.want {
+			t.Errorf("validSince(%q) = %v, want %v", tt.since, got, tt.want)
+		}
+	}
+}
+
+func TestParseChannelLogs(t *testing.T) {
+	at := time.Date(2024, 1, 1, 10, 0, 0, 123456789, time.UTC)
+	output := strings.Join([]string{
+		"2024-01-01T10:00:00.123456789Z 2024-01-01 10:00:00.123 UTC 0041 INFO [gossip.privdata] StoreBlock -> [mychannel] Received block [5]",
+		"2024-01-01T10:00:00.123456789Z 2024-01-01 10:00:00.200 UTC 0042 INFO [kvledger] commit -> channel=mychannel block=5",
+		"2024-01-01T10:00:00.123456789Z 2024-01-01 10:00:00.300 UTC 0043 INFO [comm.grpc.server] unary call completed",
+		"  [endorser] ProcessProposal -> channel: [other-ch.1] txID=abc  ",
+		"",
+	}, "\n")
+	want := []channelLog{
+		{"peer0", "mychannel", at, "2024-01-01 10:00:00.123 UTC 0041 INFO [gossip.privdata] StoreBlock -> [mychannel] Received block [5]"},
+		{"peer0", "mychannel", at, "2024-01-01 10:00:00.200 UTC 0042 INFO [kvledger] commit -> channel=mychannel block=5"},
+		// Without docker's timestamp the line is kept whole
+		{"peer0", "other-ch.1", time.Time{}, "[endorser] ProcessProposal -> channel: [other-ch.1] txID=abc"},
+	}
+	got := parseChannelLogs("peer0", output)
+	if !slices.EqualFunc(got, want, func(a, b channelLog) bool {
+		return a.peer == b.peer && a.channel == b.channel && a.at.Equal(b.at) && a.line == b.line
+	}) {
+		t.Errorf("parseChannelLogs =\n%+v\nwant\n%+v", got, want)
+	}
+}
+
+func TestParseChaincodeArgs(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string
+		ok    bool
+	}{
+		{"", nil, true},
+		{"  ", nil, true},
+		{"asset1", []string{"asset1"}, true},
+		{" asset1 , blue,5 ", []string{"asset1", "blue", "5"}, true},
+		{`["asset1", "a, b", 5, true, null, {"k": 1}]`, []string{"asset1", "a, b", "5", "true", "", `{"k": 1}`}, true},
+		{"[]", []string{}, true},
+		{"asset1,,5", nil, false},
+		{"asset1,", nil, false},
+		{`["asset1"`, nil, false},
+	}
+	for _, tt := range tests {
+		got, err := parseChaincodeArgs(tt.input)
+		if (err == nil) != tt.ok || !slices.Equal(got, tt.want) {
+			t.Errorf("parseChaincodeArgs(%q) = %q, %v, want %q, ok %v", tt.input, got, err, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestChaincodeQueryArgs(t *testing.T) {
+	tests := []struct {
+		fn, args string
+		want     []string
+		ok       bool
+	}{
+		{"ReadAsset", "asset1", []string{"chaincode", "query", "-C", CHANNEL_NAME, "-n", "basic", "-c", `{"Args":["ReadAsset","asset1"]}`}, true},
+		{" GetAllAssets ", "", []string{"chaincode", "query", "-C", CHANNEL_NAME, "-n", "basic", "-c", `{"Args":["GetAllAssets"]}`}, true},
+		{"Asset:Read", `["a\"b"]`, []string{"chaincode", "query", "-C", CHANNEL_NAME, "-n", "basic", "-c", `{"Args":["Asset:Read","a\"b"]}`}, true},
+		{"", "asset1", nil, false},
+		{"Read Asset", "", nil, false},
+		{"ReadAsset", "a,,b", nil, false},
+	}
+	for _, tt := range tests {
+		got, err := chaincodeQueryArgs("basic", tt.fn, tt.args)
+		if (err == nil) != tt.ok || !slices.Equal(got, tt.want) {
+			t.Errorf("chaincodeQueryArgs(%q, %q) = %q, %v, want %q, ok %v", tt.fn, tt.args, got, err, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestShellJoin(t *testing.T) {
+	tests := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"peer", "chaincode", "query"}, "peer chaincode query"},
+		{[]string{"-c", `{"Args":["ReadAsset"]}`}, `-c '{"Args":["ReadAsset"]}'`},
+		{[]string{"it's", ""}, `'it'\''s' ''`},
+		{[]string{"a b", "$HOME", "x;y"}, `'a b' '$HOME' 'x;y'`},
+		{nil, ""},
+	}
+	for _, tt := range tests {
+		if got := shellJoin(tt.args); got != tt.want {
+			t.Errorf("shellJoin(%q) = %s, want %s", tt.args, got, tt.want)
+		}
+	}
+}
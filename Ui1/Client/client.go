@@ -2,6 +2,7 @@ package main
 
 import (
 	"bufio"
+	"flag"
 	"fmt"
 	"net"
 	"os"
@@ -9,15 +10,13 @@ import (
 	"sync"
 	"time"
 
+	"TerminalUI/logger"
+
 	"github.com/gdamore/tcell/v2"
 	"github.com/rivo/tview"
 )
 
-const (
-	aliveASCII  = "💗"
-	brokenASCII = "💔"
-	heartbeat   = "_HEARTBEAT_"
-)
+const heartbeat = "_HEARTBEAT_"
 
 type logManager struct {
 	mu   sync.Mutex
@@ -40,6 +39,14 @@ func (lm *logManager) GetLogs(limit int) []string {
 }
 
 func main() {
+	ascii := flag.Bool("ascii", false, "show the connection status as [UP]/[DOWN] instead of emoji")
+	flag.Parse()
+	// This first version marks the status with hearts
+	icons := logger.StatusIcons{Alive: "💗", Broken: "💔"}
+	if *ascii {
+		icons = logger.ASCIIIcons
+	}
+
 	app := tview.NewApplication()
 
 	// UI Components
@@ -78,7 +85,7 @@ func main() {
 	// Connect to server
 	conn, err := net.Dial("tcp", "localhost:8080")
 	if err != nil {
-		connectionStatus.SetText(fmt.Sprintf("%s Connected", brokenASCII))
+		connectionStatus.SetText(tview.Escape(icons.Line(false, false, "Disconnected")))
 		app.Draw()
 	}
 
@@ -136,13 +143,9 @@ func main() {
 
 			app.QueueUpdateDraw(func() {
 				if isConnected {
-					if showEmoji {
-						connectionStatus.SetText("Connected")
-					} else {
-						connectionStatus.SetText(aliveASCII + " Connected")
-					}
+					connectionStatus.SetText(tview.Escape(icons.Line(true, showEmoji, "Connected")))
 				} else {
-					connectionStatus.SetText(brokenASCII + " Disconnected")
+					connectionStatus.SetText(tview.Escape(icons.Line(false, false, "Disconnected")))
 				}
 			})
 			showEmoji = !showEmoji
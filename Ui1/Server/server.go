@@ -1,61 +1,54 @@
 package main
 
 import (
-	"bufio"
+	"context"
+	"flag"
 	"fmt"
-	"net"
 	"os"
+	"os/signal"
 	"strings"
-	"sync"
+	"syscall"
 	"time"
 
+	"TerminalUI/logger"
+
 	"github.com/gdamore/tcell/v2"
 	"github.com/rivo/tview"
 )
 
-const (
-	aliveASCII  = "💗"
-	brokenASCII = "💔"
-	heartbeat   = "_HEARTBEAT_"
-)
-
-type clientState struct {
-	isAlive       bool
-	lastHeartbeat time.Time
-}
-
-type logManager struct {
-	mu   sync.Mutex
-	logs []string
-}
-
-func (lm *logManager) AddLog(log string) {
-	lm.mu.Lock()
-	defer lm.mu.Unlock()
-	lm.logs = append(lm.logs, log)
-}
-
-func (lm *logManager) GetFilteredLogs(filter string) []string {
-	lm.mu.Lock()
-	defer lm.mu.Unlock()
-	if filter == "ALL" {
-		return append([]string(nil), lm.logs...)
+func main() {
+	port := flag.String("port", logger.DefaultPort(), "port to listen for clients on; defaults to $LOGGER_PORT, else 8080")
+	heartbeatTimeout := flag.Duration("heartbeat-timeout", logger.DefaultHeartbeatTimeout, "how long a client may go without a heartbeat before it shows as disconnected; keep it at least twice the client's -heartbeat-interval")
+	tlsCert := flag.String("tls-cert", "", "PEM certificate to accept clients over TLS with, along with -tls-key; plain TCP without")
+	tlsKey := flag.String("tls-key", "", "PEM private key for -tls-cert")
+	metricsAddr := flag.String("metrics-addr", "", "address, such as :9100, to serve Prometheus metrics at /metrics on; none without")
+	ascii := flag.Bool("ascii", false, "show the connection status as [UP]/[DOWN] instead of emoji")
+	flag.Parse()
+	// This first version marks the status with hearts
+	icons := logger.StatusIcons{Alive: "💗", Broken: "💔"}
+	if *ascii {
+		icons = logger.ASCIIIcons
 	}
-	filteredLogs := []string{}
-	for _, log := range lm.logs {
-		if strings.Contains(strings.ToUpper(log), strings.ToUpper(filter)) {
-			filteredLogs = append(filteredLogs, log)
-		}
+	addr, err := logger.ListenAddr(*port)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid -port: %v\n", err)
+		os.Exit(1)
+	}
+	if *heartbeatTimeout <= 0 {
+		fmt.Fprintf(os.Stderr, "Invalid -heartbeat-timeout %v, want a positive duration\n", *heartbeatTimeout)
+		os.Exit(1)
+	}
+	tlsConfig, err := logger.LoadServerTLS(*tlsCert, *tlsKey)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid -tls-cert or -tls-key: %v\n", err)
+		os.Exit(1)
 	}
-	return filteredLogs
-}
 
-func main() {
 	app := tview.NewApplication()
-	var clientConn net.Conn
-	var clientAlive bool
-	var lastHeartbeat time.Time
-	var connMutex sync.Mutex
+	server := logger.NewServer(addr)
+	server.SetHeartbeatTimeout(*heartbeatTimeout)
+	server.SetTLSConfig(tlsConfig)
+	server.SetMetricsAddr(*metricsAddr)
 
 	// UI Components
 	logoView := tview.NewTextView().
@@ -75,7 +68,7 @@ func main() {
 	footer := tview.NewTextView().
 		SetTextAlign(tview.AlignCenter).
 		SetDynamicColors(true).
-		SetText("Press 'A' (All), 'I' (Info), 'W' (Warning), 'E' (Error), 'Q' (Quit)")
+		SetText("Press 'A' (All), 'I' (Info), 'W' (Warning), 'E' (Error), 'X' (Clear), 'Q' (Quit)")
 
 	grid := tview.NewGrid().
 		SetRows(1, 0, 1, 1).
@@ -88,7 +81,7 @@ func main() {
 		AddItem(connectionStatus, 2, 0, 1, 1, 0, 0, false).
 		AddItem(footer, 3, 0, 1, 1, 0, 0, false)
 
-	logManager := &logManager{}
+	logManager := server.Logs()
 	currentFilter := "ALL"
 
 	// client connection status with blinking emoji
@@ -96,58 +89,40 @@ func main() {
 		ticker := time.NewTicker(500 * time.Millisecond) // Faster ticker for smoother blinking
 		showEmoji := true
 		for range ticker.C {
-			connMutex.Lock()
-			if clientConn != nil && time.Since(lastHeartbeat) > 3*time.Second {
-				clientAlive = false
-			}
-			isConnected := clientConn != nil && clientAlive
-			connMutex.Unlock()
+			clients := server.ConnectedClients()
+			names := server.ConnectedNames()
+			status := logger.ClientsText(clients, names...)
 
 			app.QueueUpdateDraw(func() {
-				if isConnected {
-					if showEmoji {
-						connectionStatus.SetText("Client Connected")
-					} else {
-						connectionStatus.SetText(aliveASCII + " Client Connected")
-					}
+				if clients > 0 {
+					connectionStatus.SetText(tview.Escape(icons.Line(true, showEmoji, status)))
 				} else {
-					connectionStatus.SetText(brokenASCII + " No Client Connected")
+					connectionStatus.SetText(tview.Escape(icons.Line(false, false, status)))
 				}
 			})
 			showEmoji = !showEmoji
 		}
 	}()
 
+	// Show every log as it arrives
+	server.OnLog(func(string) {
+		app.QueueUpdateDraw(func() {
+			logsView.SetText(fmt.Sprintf("Current Filter: ALL\n\n%s",
+				strings.Join(logManager.GetFilteredLogs("ALL"), "\n")))
+		})
+	})
+
 	// Start server
-	ln, err := net.Listen("tcp", ":8080")
-	if err != nil {
+	// SIGINT and SIGTERM quit as 'Q' does, so the server is still shut
+	// down cleanly on the way out
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	context.AfterFunc(ctx, app.Stop)
+	if err := server.Start(ctx); err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to start server: %v\n", err)
 		return
 	}
-	defer ln.Close()
-
-	// Accept client connections
-	go func() {
-		for {
-			conn, err := ln.Accept()
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Error accepting connection: %v\n", err)
-				continue
-			}
-
-			connMutex.Lock()
-			// Close existing connection if any
-			if clientConn != nil {
-				clientConn.Close()
-			}
-			clientConn = conn
-			clientAlive = true
-			lastHeartbeat = time.Now()
-			connMutex.Unlock()
-
-			go handleClient(conn, logManager, logsView, app, &connMutex, &clientAlive, &lastHeartbeat)
-		}
-	}()
+	defer server.Stop()
 
 	// Handle keyboard input
 	app.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
@@ -160,6 +135,8 @@ func main() {
 			currentFilter = "ERROR"
 		case 'a', 'A':
 			currentFilter = "ALL"
+		case 'x', 'X':
+			logManager.Clear()
 		case 'q', 'Q':
 			app.Stop()
 			return nil
@@ -174,39 +151,3 @@ func main() {
 		fmt.Fprintf(os.Stderr, "Error running app: %v\n", err)
 	}
 }
-
-func handleClient(
-	conn net.Conn,
-	logManager *logManager,
-	logsView *tview.TextView,
-	app *tview.Application,
-	connMutex *sync.Mutex,
-	clientAlive *bool,
-	lastHeartbeat *time.Time,
-) {
-	defer func() {
-		connMutex.Lock()
-		conn.Close()
-		*clientAlive = false
-		connMutex.Unlock()
-	}()
-
-	scanner := bufio.NewScanner(conn)
-	for scanner.Scan() {
-		message := scanner.Text()
-
-		if message == heartbeat {
-			connMutex.Lock()
-			*clientAlive = true
-			*lastHeartbeat = time.Now()
-			connMutex.Unlock()
-			continue
-		}
-
-		logManager.AddLog(message)
-		app.QueueUpdateDraw(func() {
-			logsView.SetText(fmt.Sprintf("Current Filter: ALL\n\n%s",
-				strings.Join(logManager.GetFilteredLogs("ALL"), "\n")))
-		})
-	}
-}
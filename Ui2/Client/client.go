@@ -1,24 +1,19 @@
 package main
 
 import (
-	"bufio"
+	"flag"
 	"fmt"
-	"net"
 	"os"
 	"strings"
 	"sync"
 	"time"
 
+	"TerminalUI/logger"
+
 	"github.com/gdamore/tcell/v2"
 	"github.com/rivo/tview"
 )
 
-const (
-	aliveASCII  = "🟢"
-	brokenASCII = "🔴"
-	heartbeat   = "_HEARTBEAT_"
-)
-
 type logManager struct {
 	mu   sync.Mutex
 	logs []string
@@ -40,6 +35,19 @@ func (lm *logManager) GetLogs(limit int) []string {
 }
 
 func main() {
+	framingName := flag.String("framing", "line", "message framing: line for servers that predate framing, length, or nul for NUL-terminated records")
+	ascii := flag.Bool("ascii", false, "show the connection status as [UP]/[DOWN] instead of emoji")
+	flag.Parse()
+	icons := logger.EmojiIcons
+	if *ascii {
+		icons = logger.ASCIIIcons
+	}
+	framing, err := logger.ParseFraming(*framingName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid -framing: %v\n", err)
+		os.Exit(1)
+	}
+
 	app := tview.NewApplication()
 
 	// UI Components
@@ -75,74 +83,26 @@ func main() {
 	logManager := &logManager{}
 	logLimit := 50
 
-	// Connect to server
-	conn, err := net.Dial("tcp", "localhost:8080")
-	if err != nil {
-		connectionStatus.SetText(fmt.Sprintf("%s Connected", brokenASCII))
-		app.Draw()
-	}
-
-	defer func() {
-		if conn != nil {
-			conn.Close()
-		}
-	}()
-
-	isConnected := conn != nil
-	logChan := make(chan string)
-	heartbeatChan := make(chan struct{})
+	// Connection to the server, reconnecting with backoff in the background
+	client := logger.NewClient("localhost:8080", framing)
+	client.Start()
+	defer client.Stop()
 
-	// Message sender goroutine
-	go func() {
-		if conn == nil {
-			return
-		}
-		writer := bufio.NewWriter(conn)
-		for {
-			select {
-			case logMsg := <-logChan:
-				_, err := writer.WriteString(logMsg + "\n")
-				if err != nil {
-					isConnected = false
-					continue
-				}
-				writer.Flush()
-			case <-heartbeatChan:
-				_, err := writer.WriteString(heartbeat + "\n")
-				if err != nil {
-					isConnected = false
-					continue
-				}
-				writer.Flush()
-			}
-		}
-	}()
-
-	// Heartbeat sender with blinking emoji
+	// Connection status with blinking emoji
 	go func() {
 		ticker := time.NewTicker(500 * time.Millisecond) // Faster ticker for smoother blinking
 		showEmoji := true
 		for range ticker.C {
-			if conn != nil {
-				select {
-				case heartbeatChan <- struct{}{}:
-					isConnected = true
-				default:
-					isConnected = false
-				}
-			} else {
-				isConnected = false
-			}
+			isConnected := client.Connected()
+			retryIn := client.RetryIn()
 
 			app.QueueUpdateDraw(func() {
 				if isConnected {
-					if showEmoji {
-						connectionStatus.SetText("Connected")
-					} else {
-						connectionStatus.SetText(aliveASCII + " Connected")
-					}
+					connectionStatus.SetText(tview.Escape(icons.Line(true, showEmoji, "Connected")))
+				} else if retryIn > 0 {
+					connectionStatus.SetText(tview.Escape(icons.Line(false, false, logger.ReconnectingText(retryIn))))
 				} else {
-					connectionStatus.SetText(brokenASCII + " Disconnected")
+					connectionStatus.SetText(tview.Escape(icons.Line(false, false, "Disconnected")))
 				}
 			})
 			showEmoji = !showEmoji
@@ -151,7 +111,7 @@ func main() {
 
 	// Handle keypresses
 	app.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
-		if conn == nil || !isConnected {
+		if !client.Connected() {
 			logManager.AddLog("Connection is broken. Unable to send log.")
 			updateLogsView(logsView, logManager, logLimit)
 			return nil
@@ -177,10 +137,7 @@ func main() {
 		logManager.AddLog(logMsg)
 		updateLogsView(logsView, logManager, logLimit)
 
-		select {
-		case logChan <- logMsg:
-			// Log sent successfully
-		default:
+		if err := client.Send(logMsg); err != nil {
 			logManager.AddLog("Failed to send log to server.")
 			updateLogsView(logsView, logManager, logLimit)
 		}
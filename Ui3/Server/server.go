@@ -1,76 +1,56 @@
 package main
 
 import (
-	"bufio"
+	"context"
+	"flag"
 	"fmt"
-	"net"
 	"os"
+	"os/signal"
+	"regexp"
 	"strings"
-	"sync"
+	"syscall"
 	"time"
 
+	"TerminalUI/logger"
+
 	"github.com/gdamore/tcell/v2"
 	"github.com/rivo/tview"
 )
 
-const (
-	aliveASCII  = "🟢"
-	brokenASCII = "🔴"
-	heartbeat   = "_HEARTBEAT_"
-)
-
-type clientState struct {
-	isAlive       bool
-	lastHeartbeat time.Time
-}
-
-type logManager struct {
-	mu   sync.Mutex
-	logs []string
-}
-
-func (lm *logManager) AddLog(log string) {
-	lm.mu.Lock()
-	defer lm.mu.Unlock()
-	lm.logs = append(lm.logs, log)
-}
-
-func (lm *logManager) GetFilteredLogs(filter string) []string {
-	lm.mu.Lock()
-	defer lm.mu.Unlock()
-	if filter == "ALL" {
-		return append([]string(nil), lm.logs...)
+func main() {
+	port := flag.String("port", logger.DefaultPort(), "port to listen for clients on; defaults to $LOGGER_PORT, else 8080")
+	heartbeatTimeout := flag.Duration("heartbeat-timeout", logger.DefaultHeartbeatTimeout, "how long a client may go without a heartbeat before it shows as disconnected; keep it at least twice the client's -heartbeat-interval")
+	tlsCert := flag.String("tls-cert", "", "PEM certificate to accept clients over TLS with, along with -tls-key; plain TCP without")
+	tlsKey := flag.String("tls-key", "", "PEM private key for -tls-cert")
+	metricsAddr := flag.String("metrics-addr", "", "address, such as :9100, to serve Prometheus metrics at /metrics on; none without")
+	tagClients := flag.Bool("tag-clients", false, "tag each log with the address of the client that sent it, to tell several clients apart")
+	ascii := flag.Bool("ascii", false, "show the connection status as [UP]/[DOWN] instead of emoji")
+	flag.Parse()
+	icons := logger.EmojiIcons
+	if *ascii {
+		icons = logger.ASCIIIcons
 	}
-	filteredLogs := []string{}
-	for _, log := range lm.logs {
-		if strings.Contains(strings.ToUpper(log), strings.ToUpper(filter)) {
-			filteredLogs = append(filteredLogs, log)
-		}
+	addr, err := logger.ListenAddr(*port)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid -port: %v\n", err)
+		os.Exit(1)
 	}
-	return filteredLogs
-}
-
-func (lm *logManager) GetSearchFilteredLogs(query string) []string {
-	lm.mu.Lock()
-	defer lm.mu.Unlock()
-	if query == "" {
-		return append([]string(nil), lm.logs...)
+	if *heartbeatTimeout <= 0 {
+		fmt.Fprintf(os.Stderr, "Invalid -heartbeat-timeout %v, want a positive duration\n", *heartbeatTimeout)
+		os.Exit(1)
 	}
-	filteredLogs := []string{}
-	for _, log := range lm.logs {
-		if strings.Contains(strings.ToLower(log), strings.ToLower(query)) {
-			filteredLogs = append(filteredLogs, log)
-		}
+	tlsConfig, err := logger.LoadServerTLS(*tlsCert, *tlsKey)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid -tls-cert or -tls-key: %v\n", err)
+		os.Exit(1)
 	}
-	return filteredLogs
-}
 
-func main() {
 	app := tview.NewApplication()
-	var clientConn net.Conn
-	var clientAlive bool
-	var lastHeartbeat time.Time
-	var connMutex sync.Mutex
+	server := logger.NewServer(addr)
+	server.SetHeartbeatTimeout(*heartbeatTimeout)
+	server.SetTLSConfig(tlsConfig)
+	server.SetMetricsAddr(*metricsAddr)
+	server.SetClientPrefix(*tagClients)
 
 	// UI Components
 	logoView := tview.NewTextView().
@@ -89,8 +69,7 @@ func main() {
 
 	footer := tview.NewTextView().
 		SetTextAlign(tview.AlignCenter).
-		SetDynamicColors(true).
-		SetText("Press 'A' (All), 'I' (Info), 'W' (Warning), 'E' (Error), 'Q' (Quit), '/' to focus Search Bar")
+		SetDynamicColors(true)
 
 	searchBar := tview.NewInputField().
 		SetLabel("Search: ").
@@ -108,90 +87,99 @@ func main() {
 		AddItem(connectionStatus, 3, 0, 1, 1, 0, 0, false).
 		AddItem(footer, 4, 0, 1, 1, 0, 0, false)
 
-	logManager := &logManager{}
+	logManager := server.Logs()
 	currentFilter := "ALL"
 
+	// 'C' steps through the levels: ALL → INFO → WARNING → ERROR → ALL
+	nextFilter := map[string]string{
+		"ALL":     "INFO",
+		"INFO":    "WARNING",
+		"WARNING": "ERROR",
+		"ERROR":   "ALL",
+	}
+
 	// Monitor client connection status with blinking emoji
 	go func() {
 		ticker := time.NewTicker(500 * time.Millisecond)
 		showEmoji := true
 		for range ticker.C {
-			connMutex.Lock()
-			if clientConn != nil && time.Since(lastHeartbeat) > 3*time.Second {
-				clientAlive = false
-			}
-			isConnected := clientConn != nil && clientAlive
-			connMutex.Unlock()
+			clients := server.ConnectedClients()
+			names := server.ConnectedNames()
+			status := logger.ClientsText(clients, names...)
 
 			app.QueueUpdateDraw(func() {
-				if isConnected {
-					if showEmoji {
-						connectionStatus.SetText("Client Connected")
-					} else {
-						connectionStatus.SetText(aliveASCII + " Client Connected")
-					}
+				if clients > 0 {
+					connectionStatus.SetText(tview.Escape(icons.Line(true, showEmoji, status)))
 				} else {
-					connectionStatus.SetText(brokenASCII + " No Client Connected")
+					connectionStatus.SetText(tview.Escape(icons.Line(false, false, status)))
 				}
 			})
 			showEmoji = !showEmoji
 		}
 	}()
 
+	// Show every log as it arrives
+	server.OnLog(func(string) {
+		app.QueueUpdateDraw(func() {
+			logsView.SetText(fmt.Sprintf("Current Filter: ALL\n\n%s",
+				colorizeLogs(logManager.GetFilteredLogs("ALL"), nil)))
+		})
+	})
+
 	// Start server
-	ln, err := net.Listen("tcp", ":8080")
-	if err != nil {
+	// SIGINT and SIGTERM quit as 'Q' does, so the server is still shut
+	// down cleanly on the way out
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	context.AfterFunc(ctx, app.Stop)
+	if err := server.Start(ctx); err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to start server: %v\n", err)
 		return
 	}
-	defer ln.Close()
-
-	// Accept client connections
-	go func() {
-		for {
-			conn, err := ln.Accept()
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Error accepting connection: %v\n", err)
-				continue
-			}
-
-			connMutex.Lock()
-			if clientConn != nil {
-				clientConn.Close()
-			}
-			clientConn = conn
-			clientAlive = true
-			lastHeartbeat = time.Now()
-			connMutex.Unlock()
-
-			go handleClient(conn, logManager, logsView, app, &connMutex, &clientAlive, &lastHeartbeat)
-		}
-	}()
+	defer server.Stop()
 
 	// Manage search and keyboard inputs
 	searchQuery := ""
-	app.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
-		switch event.Key() {
-		case tcell.KeyRune:
-			switch event.Rune() {
-			case '/': // Focus on the search bar
-				app.SetFocus(searchBar)
-				return nil
-			case 'a', 'A':
-				currentFilter = "ALL"
-			case 'i', 'I':
-				currentFilter = "INFO"
-			case 'w', 'W':
-				currentFilter = "WARNING"
-			case 'e', 'E':
-				currentFilter = "ERROR"
-			case 'q', 'Q':
-				app.Stop()
-				return nil
-			}
+	pages := tview.NewPages().AddPage("logs", grid, true, true)
+	keymap := logger.NewKeymap()
+
+	setFilter := func(level string) {
+		currentFilter = level
+		filteredLogs := logManager.GetFilteredLogs(currentFilter)
+		logsView.SetText(fmt.Sprintf("Current Filter: %s\n\n%s", currentFilter, colorizeLogs(filteredLogs, nil)))
+		footer.SetText(footerText(currentFilter, keymap))
+	}
+	showHelp := func() {
+		help := tview.NewModal().
+			SetText(keymap.Help()).
+			AddButtons([]string{"Close"}).
+			SetDoneFunc(func(int, string) {
+				pages.RemovePage("help")
+			})
+		pages.AddPage("help", help, true, true)
+	}
 
-			filteredLogs := logManager.GetFilteredLogs(currentFilter)
-			logsView.SetText(fmt.Sprintf("Current Filter: %s\n\n%s", currentFilter, strings.Join(filteredLogs, "\n")))
+	keymap.RegisterKey('/', "Search", func() { app.SetFocus(searchBar) })
+	keymap.RegisterKey('a', "All", func() { setFilter("ALL") })
+	keymap.RegisterKey('i', "Info", func() { setFilter("INFO") })
+	keymap.RegisterKey('w', "Warning", func() { setFilter("WARNING") })
+	keymap.RegisterKey('e', "Error", func() { setFilter("ERROR") })
+	keymap.RegisterKey('c', "Cycle", func() { setFilter(nextFilter[currentFilter]) })
+	keymap.RegisterKey('x', "Clear", func() {
+		logManager.Clear()
+		setFilter(currentFilter)
+	})
+	keymap.RegisterKey('?', "Help", showHelp)
+	keymap.RegisterKey('q', "Quit", app.Stop)
+	footer.SetText(footerText(currentFilter, keymap))
+
+	app.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		// Let the search bar and help screen have every key sent to them
+		if searchBar.HasFocus() || pages.HasPage("help") {
+			return event
+		}
+		if event.Key() == tcell.KeyRune && keymap.Handle(event.Rune()) {
+			return nil
 		}
 		return event
 	})
@@ -204,60 +192,46 @@ func main() {
 	})
 	searchBar.SetChangedFunc(func(query string) {
 		searchQuery = query
-		filteredLogs := logManager.GetSearchFilteredLogs(searchQuery)
-		logsView.SetText(fmt.Sprintf("Search Query: %s\n\n%s", searchQuery, strings.Join(filteredLogs, "\n")))
+		filteredLogs := logManager.GetSearchFilteredLogs(searchQuery, "ALL")
+		highlight, _ := logManager.CompileSearch(searchQuery)
+		logsView.SetText(fmt.Sprintf("Search Query: %s\n\n%s", tview.Escape(searchQuery), colorizeLogs(filteredLogs, highlight)))
 	})
 
-	if err := app.SetRoot(grid, true).Run(); err != nil {
+	if err := app.SetRoot(pages, true).Run(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error running app: %v\n", err)
 	}
 }
 
-func handleClient(
-	conn net.Conn,
-	logManager *logManager,
-	logsView *tview.TextView,
-	app *tview.Application,
-	connMutex *sync.Mutex,
-	clientAlive *bool,
-	lastHeartbeat *time.Time,
-) {
-	defer func() {
-		connMutex.Lock()
-		conn.Close()
-		*clientAlive = false
-		connMutex.Unlock()
-	}()
-
-	scanner := bufio.NewScanner(conn)
-	for scanner.Scan() {
-		message := scanner.Text()
-
-		if message == heartbeat {
-			connMutex.Lock()
-			*clientAlive = true
-			*lastHeartbeat = time.Now()
-			connMutex.Unlock()
-			continue
-		}
+func footerText(level string, keymap *logger.Keymap) string {
+	return fmt.Sprintf("Level: [yellow]%s[white] | %s", level, keymap.Footer())
+}
 
-		// Add log with color coding
-		logManager.AddLog(colorizeLog(message))
-		app.QueueUpdateDraw(func() {
-			logsView.SetText(fmt.Sprintf("Current Filter: ALL\n\n%s",
-				strings.Join(logManager.GetFilteredLogs("ALL"), "\n")))
-		})
+// colorizeLog colors log by level, escaped for tview, marking matches of
+// highlight in it when there is one
+func colorizeLog(log string, highlight *regexp.Regexp) string {
+	level, _, _ := logger.ParseLogLine(log)
+	var color, open, close string
+	switch level {
+	case "INFO":
+		color, open, close = "green", "[green]", "[white]"
+	case "WARNING":
+		color, open, close = "yellow", "[yellow]", "[white]"
+	case "ERROR":
+		color, open, close = "red", "[red]", "[white]"
+	case "DEBUG":
+		color, open, close = "gray", "[gray]", "[white]"
+	case "TRACE":
+		color, open, close = "gray", "[gray::d]", "[white::-]"
 	}
+	return open + logger.HighlightMatches(log, highlight, color) + close
 }
 
-// Helper function to apply colors
-func colorizeLog(log string) string {
-	if strings.Contains(log, "INFO") {
-		return fmt.Sprintf("[green]%s[white]", log)
-	} else if strings.Contains(log, "WARNING") {
-		return fmt.Sprintf("[yellow]%s[white]", log)
-	} else if strings.Contains(log, "ERROR") {
-		return fmt.Sprintf("[red]%s[white]", log)
+// colorizeLogs renders stored logs one per line, colored by level, with
+// matches of highlight marked
+func colorizeLogs(logs []string, highlight *regexp.Regexp) string {
+	colored := make([]string, len(logs))
+	for i, log := range logs {
+		colored[i] = colorizeLog(log, highlight)
 	}
-	return log // Default for other logs
+	return strings.Join(colored, "\n")
 }
@@ -1,24 +1,23 @@
 package main
 
 import (
-	"bufio"
+	"crypto/tls"
+	"errors"
+	"flag"
 	"fmt"
-	"net"
 	"os"
+	"os/signal"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
+	"TerminalUI/logger"
+
 	"github.com/gdamore/tcell/v2"
 	"github.com/rivo/tview"
 )
 
-const (
-	aliveASCII  = "🟢"
-	brokenASCII = "🔴"
-	heartbeat   = "_HEARTBEAT_"
-)
-
 type logManager struct {
 	mu   sync.Mutex
 	logs []string
@@ -40,6 +39,55 @@ func (lm *logManager) GetLogs(limit int) []string {
 }
 
 func main() {
+	framed := flag.Bool("framed", false, "use length-prefixed framing so messages may contain newlines; same as -framing length")
+	framingName := flag.String("framing", "line", "message framing: line, length, or nul for NUL-terminated records")
+	ascii := flag.Bool("ascii", false, "show the connection status as [UP]/[DOWN] instead of emoji")
+	utc := flag.Bool("utc", false, "stamp logs in UTC instead of local time")
+	maxRetries := flag.Int("max-retries", 0, "give up reconnecting after this many failed retries, 0 for never")
+	addr := flag.String("addr", "localhost:8080", "address of the logger server")
+	compress := flag.Bool("compress", false, "gzip the stream to the server, which must be run with -compress")
+	headless := flag.Bool("headless", false, "run without a UI, sending a log of each level in turn every -interval")
+	interval := flag.Duration("interval", time.Second, "time between logs with -headless")
+	heartbeatInterval := flag.Duration("heartbeat-interval", logger.DefaultHeartbeatInterval, "time between heartbeats; the server's -heartbeat-timeout should be at least twice this")
+	useTLS := flag.Bool("tls", false, "connect over TLS, for servers run with -tls-cert")
+	caFile := flag.String("ca", "", "PEM certificates to verify the server's with -tls; defaults to the system's")
+	offlineQueue := flag.Int("offline-queue", 100, "number of logs to hold while disconnected and send on reconnect, dropping the oldest beyond it; 0 drops them all")
+	name := flag.String("name", logger.DefaultClientName(), "name the server shows for this client and tags its logs with; '' sends none")
+	flag.Parse()
+
+	framing, err := logger.ParseFraming(*framingName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid -framing: %v\n", err)
+		os.Exit(1)
+	}
+	if *heartbeatInterval <= 0 {
+		fmt.Fprintf(os.Stderr, "Invalid -heartbeat-interval %v, want a positive duration\n", *heartbeatInterval)
+		os.Exit(1)
+	}
+	var tlsConfig *tls.Config
+	if *useTLS || *caFile != "" {
+		if tlsConfig, err = logger.LoadClientTLS(*caFile); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid -ca: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if _, ok := logger.ParseHello(logger.HelloMessage(*name)); *name != "" && !ok {
+		fmt.Fprintf(os.Stderr, "Invalid -name %q, want letters, digits and . _ @ : / - only\n", *name)
+		os.Exit(1)
+	}
+	if *framed {
+		framing = logger.LengthFraming
+	}
+	icons := logger.EmojiIcons
+	if *ascii {
+		icons = logger.ASCIIIcons
+	}
+
+	if *headless {
+		runHeadless(*addr, *name, framing, tlsConfig, *maxRetries, *heartbeatInterval, *compress, *interval, *utc)
+		return
+	}
+
 	app := tview.NewApplication()
 
 	// UI Components
@@ -59,8 +107,7 @@ func main() {
 
 	footer := tview.NewTextView().
 		SetTextAlign(tview.AlignCenter).
-		SetDynamicColors(true).
-		SetText("Press 'I' (Info), 'W' (Warning), 'E' (Error), 'Q' (Quit)")
+		SetDynamicColors(true)
 
 	grid := tview.NewGrid().
 		SetRows(1, 0, 1, 1).
@@ -75,183 +122,176 @@ func main() {
 	logManager := &logManager{}
 	logLimit := 50
 
-	// Connection state
-	var connMutex sync.Mutex
-	var isConnected bool
-	var conn net.Conn
-
-	// Function to check connection
-	checkConnection := func() bool {
-		connMutex.Lock()
-		defer connMutex.Unlock()
-
-		if conn == nil {
-			isConnected = false
-			return false
-		}
-
-		// Try to write a heartbeat to check connection
-		_, err := conn.Write([]byte("\n"))
-		if err != nil {
-			conn.Close()
-			conn = nil
-			isConnected = false
-			return false
-		}
-		isConnected = true
-		return true
+	// Connection to the server, reconnecting in the background
+	client := logger.NewClient(*addr, framing)
+	client.SetMaxRetries(*maxRetries)
+	client.SetHeartbeatInterval(*heartbeatInterval)
+	client.SetTLSConfig(tlsConfig)
+	client.SetOfflineQueue(*offlineQueue)
+	if *name != "" {
+		client.SetHandshake(logger.HelloMessage(*name))
 	}
+	client.SetCompress(*compress)
+	client.Start()
+	defer client.Stop()
 
-	// Function to attempt connection
-	connect := func() bool {
-		connMutex.Lock()
-		defer connMutex.Unlock()
-
-		if conn != nil {
-			conn.Close()
-			conn = nil
-		}
-
-		newConn, err := net.Dial("tcp", "localhost:8080")
-		if err != nil {
-			isConnected = false
-			return false
-		}
-		conn = newConn
-		isConnected = true
-		return true
-	}
-
-	// Initial connection
-	connect()
-
-	// Create channels for communication
-	logChan := make(chan string)
-	heartbeatChan := make(chan struct{})
-
-	// Message sender goroutine
+	// Connection status with blinking emoji
 	go func() {
-		for {
-			select {
-			case logMsg := <-logChan:
-				connMutex.Lock()
-				if conn != nil && isConnected {
-					writer := bufio.NewWriter(conn)
-					_, err := writer.WriteString(logMsg + "\n")
-					if err != nil {
-						conn.Close()
-						conn = nil
-						isConnected = false
-					} else {
-						err = writer.Flush()
-						if err != nil {
-							conn.Close()
-							conn = nil
-							isConnected = false
-						}
-					}
-				}
-				connMutex.Unlock()
-			case <-heartbeatChan:
-				connMutex.Lock()
-				if conn != nil && isConnected {
-					writer := bufio.NewWriter(conn)
-					_, err := writer.WriteString(heartbeat + "\n")
-					if err != nil {
-						conn.Close()
-						conn = nil
-						isConnected = false
-					} else {
-						err = writer.Flush()
-						if err != nil {
-							conn.Close()
-							conn = nil
-							isConnected = false
-						}
-					}
-				}
-				connMutex.Unlock()
-			}
-		}
-	}()
-
-	// Heartbeat and connection checker
-	go func() {
-		heartbeatTicker := time.NewTicker(1 * time.Second)
 		blinkTicker := time.NewTicker(500 * time.Millisecond)
 		showEmoji := true
 
-		for {
-			select {
-			case <-heartbeatTicker.C:
-				if !checkConnection() {
-					// Try to reconnect if connection is lost
-					connect()
+		for range blinkTicker.C {
+			connStatus := client.Connected()
+			responsive := client.Responsive()
+			gaveUp := client.GaveUp()
+			retryIn := client.RetryIn()
+			dialErr := client.DialErr()
+			queued := client.Queued()
+			app.QueueUpdateDraw(func() {
+				var status string
+				if connStatus && !responsive {
+					status = icons.Line(false, false, "Connected, but the server is not responding")
+				} else if connStatus {
+					status = icons.Line(true, showEmoji, "Connected")
+				} else if gaveUp {
+					status = icons.Line(false, false, "Connection failed permanently, press 'R' to reconnect")
+				} else if retryIn > 0 {
+					status = icons.Line(false, false, logger.ReconnectingText(retryIn))
+				} else {
+					status = icons.Line(false, false, "Disconnected")
+				}
+				if !connStatus && dialErr != nil {
+					status += " (" + dialErr.Error() + ")"
+				}
+				if queued > 0 {
+					status += fmt.Sprintf(" | %d queued", queued)
 				}
-				heartbeatChan <- struct{}{}
-
-			case <-blinkTicker.C:
-				connStatus := isConnected
-				app.QueueUpdateDraw(func() {
-					if connStatus {
-						if showEmoji {
-							connectionStatus.SetText("Connected")
-						} else {
-							connectionStatus.SetText(aliveASCII + " Connected")
-						}
-					} else {
-						connectionStatus.SetText(brokenASCII + " Disconnected")
-					}
-				})
-				showEmoji = !showEmoji
-			}
+				if *compress {
+					status += " | " + compressionSavings(client)
+				}
+				connectionStatus.SetText(tview.Escape(status))
+			})
+			showEmoji = !showEmoji
 		}
 	}()
 
 	// Handle keypresses
-	app.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
-		if !isConnected {
+	pages := tview.NewPages().AddPage("logs", grid, true, true)
+	keymap := logger.NewKeymap()
+
+	inUTC := *utc
+	sendLog := func(level, text string) {
+		if !client.Connected() && *offlineQueue <= 0 {
 			logManager.AddLog("Connection is broken. Unable to send log.")
 			updateLogsView(logsView, logManager, logLimit)
-			return nil
-		}
-
-		var logMsg string
-		timestamp := time.Now().Format("2006-01-02 15:04:05")
-
-		switch event.Rune() {
-		case 'I', 'i':
-			logMsg = fmt.Sprintf("%s INFO: Info log sent", timestamp)
-		case 'W', 'w':
-			logMsg = fmt.Sprintf("%s WARNING: Warning log sent", timestamp)
-		case 'E', 'e':
-			logMsg = fmt.Sprintf("%s ERROR: Error log sent", timestamp)
-		case 'Q', 'q':
-			app.Stop()
-			return nil
-		default:
-			return event
+			return
 		}
 
+		timestamp := logger.FormatTimestamp(time.Now(), inUTC)
+		logMsg := fmt.Sprintf("%s %s: %s", timestamp, level, text)
 		logManager.AddLog(logMsg)
-		updateLogsView(logsView, logManager, logLimit)
 
-		select {
-		case logChan <- logMsg:
-			// Log sent successfully
-		default:
+		// While disconnected logs wait in the offline queue
+		switch err := client.Send(logMsg); {
+		case errors.Is(err, logger.ErrQueueFull):
+			logManager.AddLog(fmt.Sprintf("WARNING: Offline queue full (%d), dropped the oldest unsent log.", *offlineQueue))
+		case errors.Is(err, logger.ErrQueued):
+		case err != nil:
 			logManager.AddLog("Failed to send log to server.")
-			updateLogsView(logsView, logManager, logLimit)
 		}
+		updateLogsView(logsView, logManager, logLimit)
+	}
+	showHelp := func() {
+		help := tview.NewModal().
+			SetText(keymap.Help()).
+			AddButtons([]string{"Close"}).
+			SetDoneFunc(func(int, string) {
+				pages.RemovePage("help")
+			})
+		pages.AddPage("help", help, true, true)
+	}
+
+	keymap.RegisterKey('i', "Info", func() { sendLog("INFO", "Info log sent") })
+	keymap.RegisterKey('w', "Warning", func() { sendLog("WARNING", "Warning log sent") })
+	keymap.RegisterKey('e', "Error", func() { sendLog("ERROR", "Error log sent") })
+	keymap.RegisterKey('r', "Reconnect", client.Reconnect)
+	updateFooter := func() {
+		zone := "Local"
+		if inUTC {
+			zone = "UTC"
+		}
+		footer.SetText(keymap.Footer() + " | Zone: " + zone)
+	}
+	keymap.RegisterKey('u', "UTC", func() {
+		inUTC = !inUTC
+		updateFooter()
+	})
+	keymap.RegisterKey('?', "Help", showHelp)
+	keymap.RegisterKey('q', "Quit", app.Stop)
+	updateFooter()
 
-		return nil
+	app.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if pages.HasPage("help") {
+			return event
+		}
+		if event.Key() == tcell.KeyRune && keymap.Handle(event.Rune()) {
+			return nil
+		}
+		return event
 	})
 
-	if err := app.SetRoot(grid, true).Run(); err != nil {
+	if err := app.SetRoot(pages, true).Run(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error running app: %v\n", err)
 	}
 }
 
+// runHeadless sends a log of each level in turn until interrupted, for
+// scripts and for a server's -spawn-client.
+func runHeadless(addr, name string, framing logger.Framing, tlsConfig *tls.Config, maxRetries int, heartbeatInterval time.Duration, compress bool, interval time.Duration, utc bool) {
+	client := logger.NewClient(addr, framing)
+	client.SetMaxRetries(maxRetries)
+	client.SetHeartbeatInterval(heartbeatInterval)
+	client.SetTLSConfig(tlsConfig)
+	if name != "" {
+		client.SetHandshake(logger.HelloMessage(name))
+	}
+	client.SetCompress(compress)
+	client.Start()
+	defer client.Stop()
+	if compress {
+		defer func() { fmt.Fprintln(os.Stderr, compressionSavings(client)) }()
+	}
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	levels := logger.Levels
+	for i := 0; ; i++ {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+		if client.GaveUp() {
+			fmt.Fprintln(os.Stderr, "Connection failed permanently")
+			os.Exit(1)
+		}
+		level := levels[i%len(levels)]
+		client.Send(fmt.Sprintf("%s %s: Headless %s log %d", logger.FormatTimestamp(time.Now(), utc), level, strings.ToLower(level), i+1))
+	}
+}
+
+// compressionSavings describes how much compression has saved so far
+func compressionSavings(client *logger.Client) string {
+	sent, wire := client.BytesSent()
+	if sent == 0 {
+		return "gzip: nothing sent yet"
+	}
+	return fmt.Sprintf("gzip: %d B sent as %d B, %.0f%% saved", sent, wire, 100*(1-float64(wire)/float64(sent)))
+}
+
 func updateLogsView(view *tview.TextView, manager *logManager, limit int) {
 	view.Clear()
 	logs := manager.GetLogs(limit)
@@ -1,77 +1,59 @@
 package main
 
 import (
-	"bufio"
+	"context"
+	"flag"
 	"fmt"
-	"net"
 	"os"
+	"os/signal"
+	"regexp"
+	"strconv"
 	"strings"
-	"sync"
+	"syscall"
 	"time"
 
+	"TerminalUI/logger"
+
 	"github.com/gdamore/tcell/v2"
 	"github.com/rivo/tview"
 )
 
-const (
-	aliveASCII  = "🟢"
-	brokenASCII = "🔴"
-	heartbeat   = "_HEARTBEAT_"
-)
-
-type clientState struct {
-	isAlive       bool
-	lastHeartbeat time.Time
-}
-
-type logManager struct {
-	mu   sync.Mutex
-	logs []string
-}
-
-func (lm *logManager) AddLog(log string) {
-	lm.mu.Lock()
-	defer lm.mu.Unlock()
-	lm.logs = append(lm.logs, log)
-}
-
-func (lm *logManager) GetFilteredLogs(filter string) []string {
-	lm.mu.Lock()
-	defer lm.mu.Unlock()
-	if filter == "ALL" {
-		return append([]string(nil), lm.logs...)
+func main() {
+	maxLogs := flag.Int("max-logs", 10000, "number of logs to keep before dropping the oldest, 0 for no limit")
+	port := flag.String("port", logger.DefaultPort(), "port to listen for clients on; defaults to $LOGGER_PORT, else 8080")
+	heartbeatTimeout := flag.Duration("heartbeat-timeout", logger.DefaultHeartbeatTimeout, "how long a client may go without a heartbeat before it shows as disconnected; keep it at least twice the client's -heartbeat-interval")
+	tlsCert := flag.String("tls-cert", "", "PEM certificate to accept clients over TLS with, along with -tls-key; plain TCP without")
+	tlsKey := flag.String("tls-key", "", "PEM private key for -tls-cert")
+	metricsAddr := flag.String("metrics-addr", "", "address, such as :9100, to serve Prometheus metrics at /metrics on; none without")
+	tagClients := flag.Bool("tag-clients", false, "tag each log with the address of the client that sent it, to tell several clients apart")
+	ascii := flag.Bool("ascii", false, "show the connection status as [UP]/[DOWN] instead of emoji")
+	flag.Parse()
+	icons := logger.EmojiIcons
+	if *ascii {
+		icons = logger.ASCIIIcons
 	}
-	filteredLogs := []string{}
-	for _, log := range lm.logs {
-		if strings.Contains(strings.ToUpper(log), strings.ToUpper(filter)) {
-			filteredLogs = append(filteredLogs, log)
-		}
+	addr, err := logger.ListenAddr(*port)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid -port: %v\n", err)
+		os.Exit(1)
 	}
-	return filteredLogs
-}
-
-func (lm *logManager) GetSearchFilteredLogs(query string) []string {
-	lm.mu.Lock()
-	defer lm.mu.Unlock()
-	if query == "" {
-		return append([]string(nil), lm.logs...)
+	if *heartbeatTimeout <= 0 {
+		fmt.Fprintf(os.Stderr, "Invalid -heartbeat-timeout %v, want a positive duration\n", *heartbeatTimeout)
+		os.Exit(1)
 	}
-	filteredLogs := []string{}
-	for _, log := range lm.logs {
-		if strings.Contains(strings.ToLower(log), strings.ToLower(query)) {
-			filteredLogs = append(filteredLogs, log)
-		}
+	tlsConfig, err := logger.LoadServerTLS(*tlsCert, *tlsKey)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid -tls-cert or -tls-key: %v\n", err)
+		os.Exit(1)
 	}
-	return filteredLogs
-}
 
-func main() {
 	app := tview.NewApplication()
-	var clientConn net.Conn
-	var clientAlive bool
-	var lastHeartbeat time.Time
-	var connMutex sync.Mutex
-	var currentFilter = "ALL" // Moved to higher scope to be used in handleClient
+	server := logger.NewServer(addr)
+	server.SetHeartbeatTimeout(*heartbeatTimeout)
+	server.SetTLSConfig(tlsConfig)
+	server.SetMetricsAddr(*metricsAddr)
+	server.SetClientPrefix(*tagClients)
+	var currentFilter = "ALL"
 
 	app.EnableMouse(true)
 
@@ -90,6 +72,15 @@ func main() {
 		SetDynamicColors(true).
 		SetText("No Client Connected")
 
+	// How many logs have come in at each level, beside the status
+	levelCounts := tview.NewTextView().
+		SetTextAlign(tview.AlignCenter).
+		SetDynamicColors(true).
+		SetText(countsText(nil))
+	statusRow := tview.NewFlex().
+		AddItem(connectionStatus, 0, 1, false).
+		AddItem(levelCounts, 0, 1, false)
+
 	footer := tview.NewTextView().
 		SetTextAlign(tview.AlignCenter).
 		SetDynamicColors(true).
@@ -101,15 +92,53 @@ func main() {
 		SetPlaceholder("Type here to filter logs...")
 
 	// Create filter buttons
-	logManager := &logManager{}
+	logManager := server.Logs()
+	logManager.SetLimit(*maxLogs)
+
+	// With 'H' DEBUG and TRACE logs are left out, unless filtered for
+	hideVerbose := false
+	visible := func(logs []string, seqs []int) ([]string, []int) {
+		if !hideVerbose || currentFilter == "DEBUG" || currentFilter == "TRACE" {
+			return logs, seqs
+		}
+		shown := make([]string, 0, len(logs))
+		var shownSeqs []int
+		for i, log := range logs {
+			if !logger.IsVerbose(log) {
+				shown = append(shown, log)
+				shownSeqs = append(shownSeqs, seqs[i])
+			}
+		}
+		return shown, shownSeqs
+	}
+
+	// shown is what logsView holds, kept for 'S' to export. Each log is
+	// numbered by its place among every log received, whatever the filter,
+	// and with 'T' the time it arrived.
+	var shown []string
+	var updateFooter func()
+	showArrival := false
+	showLogs := func(heading string, logs []string, seqs []int, highlight *regexp.Regexp) {
+		shown = logs
+		width := len(strconv.Itoa(logManager.Total()))
+		numbered := make([]string, len(logs))
+		for i, log := range logs {
+			numbered[i] = fmt.Sprintf("[gray]%*d[white] ", width, seqs[i]+1)
+			if showArrival {
+				numbered[i] += "[gray]" + logManager.Arrived(seqs[i]).Format("15:04:05.000") + "[white] "
+			}
+			numbered[i] += colorizeLog(log, highlight)
+		}
+		logsView.SetText(fmt.Sprintf("%s\n\n%s", heading, strings.Join(numbered, "\n")))
+		updateFooter()
+	}
 
 	createFilterButton := func(label, filter string) *tview.Button {
 		button := tview.NewButton(label).
 			SetSelectedFunc(func() {
 				currentFilter = filter
-				filteredLogs := logManager.GetFilteredLogs(filter)
-				logsView.SetText(fmt.Sprintf("Current Filter: %s\n\n%s",
-					filter, strings.Join(filteredLogs, "\n")))
+				logs, seqs := visible(logManager.GetSearchFilteredLogSeqs("", filter))
+				showLogs("Current Filter: "+filter, logs, seqs, nil)
 			})
 
 		// Add visual feedback for button states
@@ -129,6 +158,8 @@ func main() {
 	infoButton := createFilterButton("ℹ️ [green]Info", "INFO")
 	warningButton := createFilterButton("⚠️ [yellow]Warning", "WARNING")
 	errorButton := createFilterButton("❌ [red]Error", "ERROR")
+	debugButton := createFilterButton("🐞 [gray]Debug", "DEBUG")
+	traceButton := createFilterButton("🔍 [gray]Trace", "TRACE")
 
 	// Add buttons to a horizontal flex container with some padding
 	buttonFlex := tview.NewFlex().
@@ -144,13 +175,24 @@ func main() {
 		AddItem(warningButton, 0, 1, true).
 		AddItem(nil, 1, 0, false).
 		AddItem(errorButton, 0, 1, true).
+		AddItem(nil, 1, 0, false).
+		AddItem(debugButton, 0, 1, true).
+		AddItem(nil, 1, 0, false).
+		AddItem(traceButton, 0, 1, true).
 		AddItem(nil, 1, 0, false)
 
 	buttonFlex.AddItem(nil, 0, 1, false).
 		AddItem(buttonRow, 1, 0, true).
 		AddItem(nil, 0, 1, false)
 
-	footer.SetText("Mouse: Click buttons to filter | Keyboard: TAB to navigate, ENTER to select | '/' Search, 'Q' Quit")
+	updateFooter = func() {
+		hidden := "shown"
+		if hideVerbose {
+			hidden = "hidden"
+		}
+		footer.SetText(fmt.Sprintf("Showing %d of %d | Mouse: Click buttons to filter | Keyboard: TAB to navigate, ENTER to select | '/' Search, 'H' DEBUG/TRACE (%s), 'T' Time, 'S' Export, 'X' Clear, 'Q' Quit", len(shown), logManager.Total(), hidden))
+	}
+	updateFooter()
 
 	// Main grid layout
 	grid := tview.NewGrid().
@@ -162,7 +204,7 @@ func main() {
 		AddItem(searchBar, 1, 0, 1, 1, 0, 0, false).
 		AddItem(buttonFlex, 2, 0, 1, 1, 0, 0, true).
 		AddItem(logsView, 3, 0, 1, 1, 0, 0, false).
-		AddItem(connectionStatus, 4, 0, 1, 1, 0, 0, false).
+		AddItem(statusRow, 4, 0, 1, 1, 0, 0, false).
 		AddItem(footer, 5, 0, 1, 1, 0, 0, false)
 
 	// Monitor client connection status with blinking emoji
@@ -170,66 +212,97 @@ func main() {
 		ticker := time.NewTicker(500 * time.Millisecond)
 		showEmoji := true
 		for range ticker.C {
-			connMutex.Lock()
-			if clientConn != nil && time.Since(lastHeartbeat) > 3*time.Second {
-				clientAlive = false
-			}
-			isConnected := clientConn != nil && clientAlive
-			connMutex.Unlock()
+			clients := server.ConnectedClients()
+			names := server.ConnectedNames()
+			status := logger.ClientsText(clients, names...)
 
 			app.QueueUpdateDraw(func() {
-				if isConnected {
-					if showEmoji {
-						connectionStatus.SetText("Client Connected")
-					} else {
-						connectionStatus.SetText(aliveASCII + " Client Connected")
-					}
+				if clients > 0 {
+					connectionStatus.SetText(tview.Escape(icons.Line(true, showEmoji, status)))
 				} else {
-					connectionStatus.SetText(brokenASCII + " No Client Connected")
+					connectionStatus.SetText(tview.Escape(icons.Line(false, false, status)))
 				}
 			})
 			showEmoji = !showEmoji
 		}
 	}()
 
+	// Show the current filter's logs as they arrive
+	showFilter := func() {
+		logs, seqs := visible(logManager.GetSearchFilteredLogSeqs("", currentFilter))
+		showLogs("Current Filter: "+currentFilter, logs, seqs, nil)
+	}
+	server.OnLog(func(string) {
+		app.QueueUpdateDraw(func() {
+			showFilter()
+			levelCounts.SetText(countsText(logManager.Counts()))
+		})
+	})
+
 	// Start server
-	ln, err := net.Listen("tcp", ":8080")
-	if err != nil {
+	// SIGINT and SIGTERM quit as 'Q' does, so the server is still shut
+	// down cleanly on the way out
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	context.AfterFunc(ctx, app.Stop)
+	if err := server.Start(ctx); err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to start server: %v\n", err)
 		return
 	}
-	defer ln.Close()
-
-	// Accept client connections
-	go func() {
-		for {
-			conn, err := ln.Accept()
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Error accepting connection: %v\n", err)
-				continue
-			}
-
-			connMutex.Lock()
-			if clientConn != nil {
-				clientConn.Close()
-			}
-			clientConn = conn
-			clientAlive = true
-			lastHeartbeat = time.Now()
-			connMutex.Unlock()
-
-			go handleClient(conn, logManager, logsView, app, &connMutex, &clientAlive, &lastHeartbeat, &currentFilter)
+	defer server.Stop()
+
+	// Export the logs on screen, without color markup, to a timestamped
+	// file. A failure is logged instead, from another goroutine as the
+	// OnLog hook waits on this one.
+	pages := tview.NewPages().AddPage("logs", grid, true, true)
+	exportLogs := func() {
+		path := fmt.Sprintf("logs-%s.txt", time.Now().Format("20060102-150405"))
+		lines := make([]string, len(shown))
+		for i, log := range shown {
+			lines[i] = logger.StripColorTags(log) + "\n"
 		}
-	}()
+		if err := os.WriteFile(path, []byte(strings.Join(lines, "")), 0o644); err != nil {
+			go server.InjectLog("ERROR", fmt.Sprintf("Failed to export logs: %v", err))
+			return
+		}
+		modal := tview.NewModal().
+			SetText(tview.Escape(fmt.Sprintf("Exported %d logs to %s", len(shown), path))).
+			AddButtons([]string{"OK"}).
+			SetDoneFunc(func(int, string) {
+				pages.RemovePage("exported")
+			})
+		pages.AddPage("exported", modal, false, true)
+	}
 
 	// Handle keyboard inputs
 	app.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		// Let the search bar and export modal have every key sent to them
+		if searchBar.HasFocus() || pages.HasPage("exported") {
+			return event
+		}
 		switch event.Key() {
 		case tcell.KeyRune:
 			switch event.Rune() {
 			case '/':
 				app.SetFocus(searchBar)
 				return nil
+			case 'h', 'H':
+				hideVerbose = !hideVerbose
+				updateFooter()
+				showFilter()
+				return nil
+			case 't', 'T':
+				showArrival = !showArrival
+				showFilter()
+				return nil
+			case 's', 'S':
+				exportLogs()
+				return nil
+			case 'x', 'X':
+				logManager.Clear()
+				showFilter()
+				levelCounts.SetText(countsText(logManager.Counts()))
+				return nil
 			case 'q', 'Q':
 				app.Stop()
 				return nil
@@ -245,59 +318,45 @@ func main() {
 		}
 	})
 	searchBar.SetChangedFunc(func(query string) {
-		filteredLogs := logManager.GetSearchFilteredLogs(query)
-		logsView.SetText(fmt.Sprintf("Search Query: %s\n\n%s",
-			query, strings.Join(filteredLogs, "\n")))
+		logs, seqs := visible(logManager.GetSearchFilteredLogSeqs(query, "ALL"))
+		highlight, _ := logManager.CompileSearch(query)
+		showLogs("Search Query: "+tview.Escape(query), logs, seqs, highlight)
 	})
 
-	if err := app.SetRoot(grid, true).Run(); err != nil {
+	if err := app.SetRoot(pages, true).Run(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error running app: %v\n", err)
 	}
 }
 
-func handleClient(
-	conn net.Conn,
-	logManager *logManager,
-	logsView *tview.TextView,
-	app *tview.Application,
-	connMutex *sync.Mutex,
-	clientAlive *bool,
-	lastHeartbeat *time.Time,
-	currentFilter *string,
-) {
-	defer func() {
-		connMutex.Lock()
-		conn.Close()
-		*clientAlive = false
-		connMutex.Unlock()
-	}()
-
-	scanner := bufio.NewScanner(conn)
-	for scanner.Scan() {
-		message := scanner.Text()
-
-		if message == heartbeat {
-			connMutex.Lock()
-			*clientAlive = true
-			*lastHeartbeat = time.Now()
-			connMutex.Unlock()
-			continue
-		}
-
-		logManager.AddLog(colorizeLog(message))
-		app.QueueUpdateDraw(func() {
-			logsView.SetText(fmt.Sprintf("Current Filter: %s\n\n%s",
-				*currentFilter, strings.Join(logManager.GetFilteredLogs(*currentFilter), "\n")))
-		})
+// colorizeLog colors log by level, escaped for tview, marking matches of
+// highlight in it when there is one
+func colorizeLog(log string, highlight *regexp.Regexp) string {
+	level, _, _ := logger.ParseLogLine(log)
+	var color, open, close string
+	switch level {
+	case "INFO":
+		color, open, close = "green", "[green]", "[white]"
+	case "WARNING":
+		color, open, close = "yellow", "[yellow]", "[white]"
+	case "ERROR":
+		color, open, close = "red", "[red]", "[white]"
+	case "DEBUG":
+		color, open, close = "gray", "[gray]", "[white]"
+	case "TRACE":
+		color, open, close = "gray", "[gray::d]", "[white::-]"
 	}
+	return open + logger.HighlightMatches(log, highlight, color) + close
 }
-func colorizeLog(log string) string {
-	if strings.Contains(log, "INFO") {
-		return fmt.Sprintf("[green]%s[white]", log)
-	} else if strings.Contains(log, "WARNING") {
-		return fmt.Sprintf("[yellow]%s[white]", log)
-	} else if strings.Contains(log, "ERROR") {
-		return fmt.Sprintf("[red]%s[white]", log)
+
+// countsText summarizes logs by level as "I:120 W:8 E:3", colored as
+// the logs are. DEBUG and TRACE are left out until any arrive.
+func countsText(counts map[string]int) string {
+	text := fmt.Sprintf("[green]I:%d [yellow]W:%d [red]E:%d", counts["INFO"], counts["WARNING"], counts["ERROR"])
+	if n := counts["DEBUG"]; n > 0 {
+		text += fmt.Sprintf(" [gray]D:%d", n)
+	}
+	if n := counts["TRACE"]; n > 0 {
+		text += fmt.Sprintf(" [gray]T:%d", n)
 	}
-	return log
+	return text + "[white]"
 }
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bufio"
+	"flag"
 	"fmt"
 	"net"
 	"os"
@@ -9,15 +10,13 @@ import (
 	"sync"
 	"time"
 
+	"TerminalUI/logger"
+
 	"github.com/gdamore/tcell/v2"
 	"github.com/rivo/tview"
 )
 
-const (
-	aliveASCII  = "🟢"
-	brokenASCII = "🔴"
-	heartbeat   = "_HEARTBEAT_"
-)
+const heartbeat = "_HEARTBEAT_"
 
 type logManager struct {
 	mu   sync.Mutex
@@ -40,6 +39,13 @@ func (lm *logManager) GetLogs(limit int) []string {
 }
 
 func main() {
+	ascii := flag.Bool("ascii", false, "show the connection status as [UP]/[DOWN] instead of emoji")
+	flag.Parse()
+	icons := logger.EmojiIcons
+	if *ascii {
+		icons = logger.ASCIIIcons
+	}
+
 	app := tview.NewApplication()
 
 	// UI Components
@@ -194,13 +200,9 @@ func main() {
 				connStatus := isConnected
 				app.QueueUpdateDraw(func() {
 					if connStatus {
-						if showEmoji {
-							connectionStatus.SetText("Connected")
-						} else {
-							connectionStatus.SetText(aliveASCII + " Connected")
-						}
+						connectionStatus.SetText(tview.Escape(icons.Line(true, showEmoji, "Connected")))
 					} else {
-						connectionStatus.SetText(brokenASCII + " Disconnected")
+						connectionStatus.SetText(tview.Escape(icons.Line(false, false, "Disconnected")))
 					}
 				})
 				showEmoji = !showEmoji
@@ -1,76 +1,56 @@
 package main
 
 import (
-	"bufio"
+	"context"
+	"flag"
 	"fmt"
-	"net"
 	"os"
+	"os/signal"
+	"regexp"
 	"strings"
-	"sync"
+	"syscall"
 	"time"
 
+	"TerminalUI/logger"
+
 	"github.com/gdamore/tcell/v2"
 	"github.com/rivo/tview"
 )
 
-const (
-	aliveASCII  = "🟢"
-	brokenASCII = "🔴"
-	heartbeat   = "_HEARTBEAT_"
-)
-
-type clientState struct {
-	isAlive       bool
-	lastHeartbeat time.Time
-}
-
-type logManager struct {
-	mu   sync.Mutex
-	logs []string
-}
-
-func (lm *logManager) AddLog(log string) {
-	lm.mu.Lock()
-	defer lm.mu.Unlock()
-	lm.logs = append(lm.logs, log)
-}
-
-func (lm *logManager) GetFilteredLogs(filter string) []string {
-	lm.mu.Lock()
-	defer lm.mu.Unlock()
-	if filter == "ALL" {
-		return append([]string(nil), lm.logs...)
+func main() {
+	port := flag.String("port", logger.DefaultPort(), "port to listen for clients on; defaults to $LOGGER_PORT, else 8080")
+	heartbeatTimeout := flag.Duration("heartbeat-timeout", logger.DefaultHeartbeatTimeout, "how long a client may go without a heartbeat before it shows as disconnected; keep it at least twice the client's -heartbeat-interval")
+	tlsCert := flag.String("tls-cert", "", "PEM certificate to accept clients over TLS with, along with -tls-key; plain TCP without")
+	tlsKey := flag.String("tls-key", "", "PEM private key for -tls-cert")
+	metricsAddr := flag.String("metrics-addr", "", "address, such as :9100, to serve Prometheus metrics at /metrics on; none without")
+	tagClients := flag.Bool("tag-clients", false, "tag each log with the address of the client that sent it, to tell several clients apart")
+	ascii := flag.Bool("ascii", false, "show the connection status as [UP]/[DOWN] instead of emoji")
+	flag.Parse()
+	icons := logger.EmojiIcons
+	if *ascii {
+		icons = logger.ASCIIIcons
 	}
-	filteredLogs := []string{}
-	for _, log := range lm.logs {
-		if strings.Contains(strings.ToUpper(log), strings.ToUpper(filter)) {
-			filteredLogs = append(filteredLogs, log)
-		}
+	addr, err := logger.ListenAddr(*port)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid -port: %v\n", err)
+		os.Exit(1)
 	}
-	return filteredLogs
-}
-
-func (lm *logManager) GetSearchFilteredLogs(query string) []string {
-	lm.mu.Lock()
-	defer lm.mu.Unlock()
-	if query == "" {
-		return append([]string(nil), lm.logs...)
+	if *heartbeatTimeout <= 0 {
+		fmt.Fprintf(os.Stderr, "Invalid -heartbeat-timeout %v, want a positive duration\n", *heartbeatTimeout)
+		os.Exit(1)
 	}
-	filteredLogs := []string{}
-	for _, log := range lm.logs {
-		if strings.Contains(strings.ToLower(log), strings.ToLower(query)) {
-			filteredLogs = append(filteredLogs, log)
-		}
+	tlsConfig, err := logger.LoadServerTLS(*tlsCert, *tlsKey)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid -tls-cert or -tls-key: %v\n", err)
+		os.Exit(1)
 	}
-	return filteredLogs
-}
 
-func main() {
 	app := tview.NewApplication()
-	var clientConn net.Conn
-	var clientAlive bool
-	var lastHeartbeat time.Time
-	var connMutex sync.Mutex
+	server := logger.NewServer(addr)
+	server.SetHeartbeatTimeout(*heartbeatTimeout)
+	server.SetTLSConfig(tlsConfig)
+	server.SetMetricsAddr(*metricsAddr)
+	server.SetClientPrefix(*tagClients)
 	var currentFilter = "ALL"
 
 	app.EnableMouse(true)
@@ -85,6 +65,10 @@ func main() {
 		SetDynamicColors(true).
 		SetScrollable(true)
 
+	// Grouped display: runs of same-level logs under collapsible headers
+	groupTree := tview.NewTreeView().
+		SetTopLevel(1)
+
 	connectionStatus := tview.NewTextView().
 		SetTextAlign(tview.AlignCenter).
 		SetDynamicColors(true).
@@ -101,7 +85,38 @@ func main() {
 		SetPlaceholder("Type here to filter logs...")
 
 	// Create dropdown for log types
-	logManager := &logManager{}
+	logManager := server.Logs()
+
+	// What the log view shows: a title line and the logs under it
+	viewTitle := ""
+	viewLogs := func() []string { return logManager.GetFilteredLogs(currentFilter) }
+	var viewHighlight *regexp.Regexp // search matches to mark
+	grouped := false
+	expanded := map[int]bool{}
+
+	// With 'H' DEBUG and TRACE logs are left out, unless filtered for
+	hideVerbose := false
+	visible := func(logs []string) []string {
+		if !hideVerbose || currentFilter == "DEBUG" || currentFilter == "TRACE" {
+			return logs
+		}
+		shown := make([]string, 0, len(logs))
+		for _, log := range logs {
+			if !logger.IsVerbose(log) {
+				shown = append(shown, log)
+			}
+		}
+		return shown
+	}
+
+	showLogs := func() {
+		logs := visible(viewLogs())
+		if grouped {
+			fillGroupTree(groupTree, viewTitle, groupLogs(logs), expanded, viewHighlight)
+		} else {
+			logsView.SetText(fmt.Sprintf("%s\n\n%s", viewTitle, colorizeLogs(logs, viewHighlight)))
+		}
+	}
 
 	// Define log types with their icons and colors
 	logTypes := []struct {
@@ -112,6 +127,8 @@ func main() {
 		{"ℹ️ Info Logs", "INFO"},
 		{"⚠️ Warning Logs", "WARNING"},
 		{"❌ Error Logs", "ERROR"},
+		{"🐞 Debug Logs", "DEBUG"},
+		{"🔍 Trace Logs", "TRACE"},
 	}
 
 	// Create dropdown
@@ -127,9 +144,10 @@ func main() {
 	// Set dropdown selection handler
 	dropdown.SetSelectedFunc(func(text string, index int) {
 		currentFilter = logTypes[index].value
-		filteredLogs := logManager.GetFilteredLogs(currentFilter)
-		logsView.SetText(fmt.Sprintf("Current Filter: %s\n\n%s",
-			logTypes[index].label, strings.Join(filteredLogs, "\n")))
+		viewTitle = fmt.Sprintf("Current Filter: %s", logTypes[index].label)
+		viewLogs = func() []string { return logManager.GetFilteredLogs(currentFilter) }
+		viewHighlight = nil
+		showLogs()
 	})
 
 	// Set initial selection
@@ -148,7 +166,14 @@ func main() {
 		AddItem(dropdownRow, 1, 0, true).
 		AddItem(nil, 0, 1, false)
 
-	footer.SetText("Mouse: Use dropdown to filter | '/' Search, 'Q' Quit")
+	updateFooter := func() {
+		hidden := "shown"
+		if hideVerbose {
+			hidden = "hidden"
+		}
+		footer.SetText(fmt.Sprintf("Mouse: Use dropdown to filter | '/' Search, 'G' Group by level (Enter expands), 'H' DEBUG/TRACE (%s), 'X' Clear, 'Q' Quit", hidden))
+	}
+	updateFooter()
 
 	// Main grid layout
 	grid := tview.NewGrid().
@@ -168,66 +193,72 @@ func main() {
 		ticker := time.NewTicker(500 * time.Millisecond)
 		showEmoji := true
 		for range ticker.C {
-			connMutex.Lock()
-			if clientConn != nil && time.Since(lastHeartbeat) > 3*time.Second {
-				clientAlive = false
-			}
-			isConnected := clientConn != nil && clientAlive
-			connMutex.Unlock()
+			clients := server.ConnectedClients()
+			names := server.ConnectedNames()
+			status := logger.ClientsText(clients, names...)
 
 			app.QueueUpdateDraw(func() {
-				if isConnected {
-					if showEmoji {
-						connectionStatus.SetText("Client Connected")
-					} else {
-						connectionStatus.SetText(aliveASCII + " Client Connected")
-					}
+				if clients > 0 {
+					connectionStatus.SetText(tview.Escape(icons.Line(true, showEmoji, status)))
 				} else {
-					connectionStatus.SetText(brokenASCII + " No Client Connected")
+					connectionStatus.SetText(tview.Escape(icons.Line(false, false, status)))
 				}
 			})
 			showEmoji = !showEmoji
 		}
 	}()
 
+	server.OnLog(func(string) {
+		app.QueueUpdateDraw(showLogs)
+	})
+
 	// Start server
-	ln, err := net.Listen("tcp", ":8080")
-	if err != nil {
+	// SIGINT and SIGTERM quit as 'Q' does, so the server is still shut
+	// down cleanly on the way out
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	context.AfterFunc(ctx, app.Stop)
+	if err := server.Start(ctx); err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to start server: %v\n", err)
 		return
 	}
-	defer ln.Close()
-
-	// Accept client connections
-	go func() {
-		for {
-			conn, err := ln.Accept()
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Error accepting connection: %v\n", err)
-				continue
-			}
-
-			connMutex.Lock()
-			if clientConn != nil {
-				clientConn.Close()
-			}
-			clientConn = conn
-			clientAlive = true
-			lastHeartbeat = time.Now()
-			connMutex.Unlock()
-
-			go handleClient(conn, logManager, logsView, app, &connMutex, &clientAlive, &lastHeartbeat, &currentFilter)
-		}
-	}()
+	defer server.Stop()
 
 	// Handle keyboard inputs
 	app.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		// Let the search bar have every key typed into it
+		if searchBar.HasFocus() {
+			return event
+		}
 		switch event.Key() {
 		case tcell.KeyRune:
 			switch event.Rune() {
 			case '/':
 				app.SetFocus(searchBar)
 				return nil
+			case 'g', 'G':
+				grouped = !grouped
+				if grouped {
+					grid.RemoveItem(logsView)
+					grid.AddItem(groupTree, 3, 0, 1, 1, 0, 0, false)
+				} else {
+					grid.RemoveItem(groupTree)
+					grid.AddItem(logsView, 3, 0, 1, 1, 0, 0, false)
+				}
+				showLogs()
+				if grouped {
+					app.SetFocus(groupTree)
+				}
+				return nil
+			case 'h', 'H':
+				hideVerbose = !hideVerbose
+				updateFooter()
+				showLogs()
+				return nil
+			case 'x', 'X':
+				logManager.Clear()
+				showLogs()
+				return nil
 			case 'q', 'Q':
 				app.Stop()
 				return nil
@@ -244,9 +275,10 @@ func main() {
 	})
 
 	searchBar.SetChangedFunc(func(query string) {
-		filteredLogs := logManager.GetSearchFilteredLogs(query)
-		logsView.SetText(fmt.Sprintf("Search Query: %s\n\n%s",
-			query, strings.Join(filteredLogs, "\n")))
+		viewTitle = fmt.Sprintf("Search Query: %s", tview.Escape(query))
+		viewLogs = func() []string { return logManager.GetSearchFilteredLogs(query, "ALL") }
+		viewHighlight, _ = logManager.CompileSearch(query)
+		showLogs()
 	})
 
 	if err := app.SetRoot(grid, true).Run(); err != nil {
@@ -254,50 +286,100 @@ func main() {
 	}
 }
 
-func handleClient(
-	conn net.Conn,
-	logManager *logManager,
-	logsView *tview.TextView,
-	app *tview.Application,
-	connMutex *sync.Mutex,
-	clientAlive *bool,
-	lastHeartbeat *time.Time,
-	currentFilter *string,
-) {
-	defer func() {
-		connMutex.Lock()
-		conn.Close()
-		*clientAlive = false
-		connMutex.Unlock()
-	}()
+// colorizeLog colors log by level, escaped for tview, marking matches of
+// highlight in it when there is one
+func colorizeLog(log string, highlight *regexp.Regexp) string {
+	level, _, _ := logger.ParseLogLine(log)
+	var color, open, close string
+	switch level {
+	case "INFO":
+		color, open, close = "green", "[green]", "[white]"
+	case "WARNING":
+		color, open, close = "yellow", "[yellow]", "[white]"
+	case "ERROR":
+		color, open, close = "red", "[red]", "[white]"
+	case "DEBUG":
+		color, open, close = "gray", "[gray]", "[white]"
+	case "TRACE":
+		color, open, close = "gray", "[gray::d]", "[white::-]"
+	}
+	return open + logger.HighlightMatches(log, highlight, color) + close
+}
 
-	scanner := bufio.NewScanner(conn)
-	for scanner.Scan() {
-		message := scanner.Text()
+// colorizeLogs renders stored logs one per line, colored by level, with
+// matches of highlight marked
+func colorizeLogs(logs []string, highlight *regexp.Regexp) string {
+	colored := make([]string, len(logs))
+	for i, log := range logs {
+		colored[i] = colorizeLog(log, highlight)
+	}
+	return strings.Join(colored, "\n")
+}
+
+// logGroup is a run of consecutive logs at the same level
+type logGroup struct {
+	start int // index of the first log, used to remember expansion
+	level string
+	logs  []string
+}
+
+func groupLogs(logs []string) []logGroup {
+	var groups []logGroup
+	for i, log := range logs {
+		level, _, _ := logger.ParseLogLine(log)
+		if n := len(groups); n > 0 && groups[n-1].level == level {
+			groups[n-1].logs = append(groups[n-1].logs, log)
+			continue
+		}
+		groups = append(groups, logGroup{start: i, level: level, logs: []string{log}})
+	}
+	return groups
+}
+
+// fillGroupTree rebuilds the tree from groups, keeping each group's
+// expanded state in expanded and the cursor on the same group. Matches of
+// highlight are marked in the logs.
+func fillGroupTree(tree *tview.TreeView, title string, groups []logGroup, expanded map[int]bool, highlight *regexp.Regexp) {
+	selected := -1
+	if node := tree.GetCurrentNode(); node != nil {
+		if start, ok := node.GetReference().(int); ok {
+			selected = start
+		}
+	}
 
-		if message == heartbeat {
-			connMutex.Lock()
-			*clientAlive = true
-			*lastHeartbeat = time.Now()
-			connMutex.Unlock()
+	root := tview.NewTreeNode(title)
+	var current *tview.TreeNode
+	for _, group := range groups {
+		// A lone log needs no header
+		if len(group.logs) == 1 {
+			root.AddChild(tview.NewTreeNode(colorizeLog(group.logs[0], highlight)).SetReference(group.start))
 			continue
 		}
 
-		logManager.AddLog(colorizeLog(message))
-		app.QueueUpdateDraw(func() {
-			logsView.SetText(fmt.Sprintf("Current Filter: %s\n\n%s",
-				*currentFilter, strings.Join(logManager.GetFilteredLogs(*currentFilter), "\n")))
+		level := group.level
+		if level == "" {
+			level = "other"
+		}
+		start := group.start
+		header := tview.NewTreeNode(colorizeLog(fmt.Sprintf("%d %s messages", len(group.logs), level), nil)).
+			SetReference(start).
+			SetExpanded(expanded[start])
+		header.SetSelectedFunc(func() {
+			expanded[start] = !expanded[start]
+			header.SetExpanded(expanded[start])
 		})
+		for _, log := range group.logs {
+			header.AddChild(tview.NewTreeNode(colorizeLog(log, highlight)).SetSelectable(false))
+		}
+		root.AddChild(header)
+		if start == selected {
+			current = header
+		}
 	}
-}
 
-func colorizeLog(log string) string {
-	if strings.Contains(log, "INFO") {
-		return fmt.Sprintf("[green]%s[white]", log)
-	} else if strings.Contains(log, "WARNING") {
-		return fmt.Sprintf("[yellow]%s[white]", log)
-	} else if strings.Contains(log, "ERROR") {
-		return fmt.Sprintf("[red]%s[white]", log)
+	tree.SetRoot(root)
+	if current == nil && len(root.GetChildren()) > 0 {
+		current = root.GetChildren()[len(root.GetChildren())-1]
 	}
-	return log
+	tree.SetCurrentNode(current)
 }
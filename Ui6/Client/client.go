@@ -2,6 +2,7 @@ package main
 
 import (
 	"bufio"
+	"flag"
 	"fmt"
 	"net"
 	"os"
@@ -9,15 +10,13 @@ import (
 	"sync"
 	"time"
 
+	"TerminalUI/logger"
+
 	"github.com/gdamore/tcell/v2"
 	"github.com/rivo/tview"
 )
 
-const (
-	aliveASCII  = "🟢"
-	brokenASCII = "🔴"
-	heartbeat   = "_HEARTBEAT_"
-)
+const heartbeat = "_HEARTBEAT_"
 
 type logManager struct {
 	mu   sync.Mutex
@@ -40,6 +39,18 @@ func (lm *logManager) GetLogs(limit int) []string {
 }
 
 func main() {
+	heartbeatInterval := flag.Duration("heartbeat-interval", time.Second, "time between heartbeats; the server's -heartbeat-timeout should be at least twice this")
+	ascii := flag.Bool("ascii", false, "show the connection status as [UP]/[DOWN] instead of emoji")
+	flag.Parse()
+	icons := logger.EmojiIcons
+	if *ascii {
+		icons = logger.ASCIIIcons
+	}
+	if *heartbeatInterval <= 0 {
+		fmt.Fprintf(os.Stderr, "Invalid -heartbeat-interval %v, want a positive duration\n", *heartbeatInterval)
+		os.Exit(1)
+	}
+
 	app := tview.NewApplication()
 
 	// UI Components
@@ -60,17 +71,30 @@ func main() {
 	footer := tview.NewTextView().
 		SetTextAlign(tview.AlignCenter).
 		SetDynamicColors(true).
-		SetText("Press 'I' (Info), 'W' (Warning), 'E' (Error), 'Q' (Quit)")
+		SetText("Press 'I' (Info), 'W' (Warning), 'E' (Error), 'M' (Message), 'Q' (Quit)")
+
+	// Free-form messages: typed text sent at the level picked beside it
+	messageInput := tview.NewInputField().
+		SetLabel("Message: ").
+		SetPlaceholder("Press 'M' to type a log, Enter to send, Esc to leave")
+	levelDropDown := tview.NewDropDown().
+		SetLabel(" Level: ").
+		SetOptions([]string{"INFO", "WARNING", "ERROR"}, nil).
+		SetCurrentOption(0)
+	messageBar := tview.NewFlex().
+		AddItem(messageInput, 0, 1, false).
+		AddItem(levelDropDown, 17, 0, false)
 
 	grid := tview.NewGrid().
-		SetRows(1, 0, 1, 1).
+		SetRows(1, 0, 1, 1, 1).
 		SetColumns(0).
 		SetBorders(true)
 
 	grid.AddItem(logoView, 0, 0, 1, 1, 0, 0, false).
 		AddItem(logsView, 1, 0, 1, 1, 0, 0, true).
-		AddItem(connectionStatus, 2, 0, 1, 1, 0, 0, false).
-		AddItem(footer, 3, 0, 1, 1, 0, 0, false)
+		AddItem(messageBar, 2, 0, 1, 1, 0, 0, false).
+		AddItem(connectionStatus, 3, 0, 1, 1, 0, 0, false).
+		AddItem(footer, 4, 0, 1, 1, 0, 0, false)
 
 	logManager := &logManager{}
 	logLimit := 50
@@ -177,7 +201,7 @@ func main() {
 
 	// Heartbeat and connection checker
 	go func() {
-		heartbeatTicker := time.NewTicker(1 * time.Second)
+		heartbeatTicker := time.NewTicker(*heartbeatInterval)
 		blinkTicker := time.NewTicker(500 * time.Millisecond)
 		showEmoji := true
 
@@ -194,13 +218,9 @@ func main() {
 				connStatus := isConnected
 				app.QueueUpdateDraw(func() {
 					if connStatus {
-						if showEmoji {
-							connectionStatus.SetText("Connected")
-						} else {
-							connectionStatus.SetText(aliveASCII + " Connected")
-						}
+						connectionStatus.SetText(tview.Escape(icons.Line(true, showEmoji, "Connected")))
 					} else {
-						connectionStatus.SetText(brokenASCII + " Disconnected")
+						connectionStatus.SetText(tview.Escape(icons.Line(false, false, "Disconnected")))
 					}
 				})
 				showEmoji = !showEmoji
@@ -208,8 +228,61 @@ func main() {
 		}
 	}()
 
+	// sendLog shows a log and hands it to the sender
+	sendLog := func(logMsg string) {
+		logManager.AddLog(logMsg)
+		updateLogsView(logsView, logManager, logLimit)
+
+		select {
+		case logChan <- logMsg:
+			// Log sent successfully
+		default:
+			logManager.AddLog("Failed to send log to server.")
+			updateLogsView(logsView, logManager, logLimit)
+		}
+	}
+
+	messageInput.SetDoneFunc(func(key tcell.Key) {
+		switch key {
+		case tcell.KeyEnter:
+			text := strings.TrimSpace(messageInput.GetText())
+			if text == "" {
+				return
+			}
+			if !isConnected {
+				logManager.AddLog("Connection is broken. Unable to send log.")
+				updateLogsView(logsView, logManager, logLimit)
+				return
+			}
+			_, level := levelDropDown.GetCurrentOption()
+			timestamp := time.Now().Format("2006-01-02 15:04:05")
+			sendLog(fmt.Sprintf("%s %s: %s", timestamp, level, text))
+			messageInput.SetText("")
+		case tcell.KeyEscape:
+			app.SetFocus(logsView)
+		case tcell.KeyTab, tcell.KeyBacktab:
+			app.SetFocus(levelDropDown)
+		}
+	})
+	levelDropDown.SetDoneFunc(func(key tcell.Key) {
+		switch key {
+		case tcell.KeyEscape:
+			app.SetFocus(logsView)
+		case tcell.KeyTab, tcell.KeyBacktab:
+			app.SetFocus(messageInput)
+		}
+	})
+
 	// Handle keypresses
 	app.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		// Let the message bar have every key typed into it
+		if messageInput.HasFocus() || levelDropDown.HasFocus() {
+			return event
+		}
+		if event.Rune() == 'm' || event.Rune() == 'M' {
+			app.SetFocus(messageInput)
+			return nil
+		}
 		if !isConnected {
 			logManager.AddLog("Connection is broken. Unable to send log.")
 			updateLogsView(logsView, logManager, logLimit)
@@ -233,17 +306,7 @@ func main() {
 			return event
 		}
 
-		logManager.AddLog(logMsg)
-		updateLogsView(logsView, logManager, logLimit)
-
-		select {
-		case logChan <- logMsg:
-			// Log sent successfully
-		default:
-			logManager.AddLog("Failed to send log to server.")
-			updateLogsView(logsView, logManager, logLimit)
-		}
-
+		sendLog(logMsg)
 		return nil
 	})
 
@@ -259,13 +322,13 @@ func updateLogsView(view *tview.TextView, manager *logManager, limit int) {
 	var colorizedLogs []string
 	for _, log := range logs {
 		if strings.Contains(log, "INFO") {
-			colorizedLogs = append(colorizedLogs, fmt.Sprintf("[green]%s[white]", log))
+			colorizedLogs = append(colorizedLogs, fmt.Sprintf("[green]%s[white]", tview.Escape(log)))
 		} else if strings.Contains(log, "WARNING") {
-			colorizedLogs = append(colorizedLogs, fmt.Sprintf("[yellow]%s[white]", log))
+			colorizedLogs = append(colorizedLogs, fmt.Sprintf("[yellow]%s[white]", tview.Escape(log)))
 		} else if strings.Contains(log, "ERROR") {
-			colorizedLogs = append(colorizedLogs, fmt.Sprintf("[red]%s[white]", log))
+			colorizedLogs = append(colorizedLogs, fmt.Sprintf("[red]%s[white]", tview.Escape(log)))
 		} else {
-			colorizedLogs = append(colorizedLogs, log)
+			colorizedLogs = append(colorizedLogs, tview.Escape(log))
 		}
 	}
 
@@ -1,60 +1,326 @@
 package main
 
 import (
-	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
 	"fmt"
+	"io"
+	"log"
 	"net"
+	"net/http"
 	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
+	"text/template"
 	"time"
+	"unicode"
+
+	"TerminalUI/logger"
 
 	"github.com/gdamore/tcell/v2"
 	"github.com/rivo/tview"
 )
 
 const (
-	aliveASCII     = "🟢"
-	brokenASCII    = "🔴"
-	heartbeat      = "_HEARTBEAT_"
-	serverPort     = ":8080"
-	heartbeatTimer = 3 * time.Second
+	viewerWriteTimeout = time.Second
+	demoInterval       = 700 * time.Millisecond
+
+	// Past floodRate logs a second, redraws happen every floodRedraw
+	// instead of once per log
+	floodRate   = 100
+	floodRedraw = 250 * time.Millisecond
+	// Logs waiting for the UI and viewers before new ones skip them
+	logQueueSize = 4096
+
+	// A connection change is posted to -status-webhook once it has held
+	// for webhookDebounce, each post given webhookTimeout
+	webhookDebounce = 2 * time.Second
+	webhookTimeout  = 5 * time.Second
+
+	// -age-fade darkens logs in fadeSteps steps, down to fadeFloor of
+	// their brightness, so redraws are only needed as a step is crossed
+	fadeSteps = 8
+	fadeFloor = 0.4
+
+	// The default template reproduces the log as the client sent it
+	defaultLogTemplate = `{{with .Timestamp}}{{.}}  {{end}}{{with .Source}}{{.}} {{end}}{{with .Level}}{{.}}: {{end}}{{.Message}}`
+)
+
+// Leading timestamps the column layout recognises, e.g. the clients'
+// "2006-01-02 15:04:05", RFC 3339 or a bare "15:04:05"
+var (
+	timestampPattern = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2}[ T]\d{2}:\d{2}:\d{2}(?:\.\d+)?(?:Z|[+-]\d{2}:?\d{2})?|\d{2}:\d{2}:\d{2}(?:\.\d+)?)\s+`)
+	levelPattern     = regexp.MustCompile(`^(INFO|WARNING|ERROR):\s*`)
+	// The tag the logger server puts after the timestamp: a client's
+	// hello name, "<worker>", or with -tag-clients its address,
+	// "[10.0.0.5:51234]"
+	sourcePattern = regexp.MustCompile(`^(<[^<>\s]+>|\[\S+?:\d+\])\s+`)
+
+	// What -smart-colors picks out in a message
+	statusPattern   = regexp.MustCompile(`\b[245]\d{2}\b`)
+	durationPattern = regexp.MustCompile(`\b\d+(?:\.\d+)?(?:ns|us|µs|ms|s|m|h)\b`)
 )
 
-type LogManager struct {
-	mu   sync.Mutex
-	logs []string
+// ViewerHub streams every received log to the viewers connected to the
+// viewer endpoint, each in the framing it negotiated.
+type ViewerHub struct {
+	mu      sync.Mutex
+	viewers map[net.Conn]logger.Framing
+	prefix  string
 }
 
-func (lm *LogManager) AddLog(log string) {
-	lm.mu.Lock()
-	defer lm.mu.Unlock()
-	lm.logs = append(lm.logs, log)
+// SetPrefix puts prefix in front of every log sent to viewers, e.g. to
+// say which server instance it came from.
+func (vh *ViewerHub) SetPrefix(prefix string) {
+	vh.mu.Lock()
+	defer vh.mu.Unlock()
+	vh.prefix = prefix
 }
 
-func (lm *LogManager) GetSearchFilteredLogs(query string, logType string) []string {
-	lm.mu.Lock()
-	defer lm.mu.Unlock()
-	var filteredLogs []string
-	for _, log := range lm.logs {
-		if strings.Contains(strings.ToUpper(log), strings.ToUpper(logType)) {
-			if query == "" || strings.Contains(strings.ToLower(log), strings.ToLower(query)) {
-				filteredLogs = append(filteredLogs, log)
-			}
+func NewViewerHub() *ViewerHub {
+	return &ViewerHub{viewers: make(map[net.Conn]logger.Framing)}
+}
+
+// register adds a viewer after replaying the last backlog logs to it. Both
+// happen under the hub lock so no log is missed in between.
+func (vh *ViewerHub) register(conn net.Conn, framing logger.Framing, logManager *logger.LogManager, backlog int) error {
+	vh.mu.Lock()
+	defer vh.mu.Unlock()
+	for _, log := range logManager.GetRecentLogs(backlog) {
+		conn.SetWriteDeadline(time.Now().Add(viewerWriteTimeout))
+		if _, err := conn.Write(framing.Encode(vh.prefix + log)); err != nil {
+			return err
+		}
+	}
+	vh.viewers[conn] = framing
+	return nil
+}
+
+func (vh *ViewerHub) unregister(conn net.Conn) {
+	vh.mu.Lock()
+	defer vh.mu.Unlock()
+	delete(vh.viewers, conn)
+}
+
+func (vh *ViewerHub) Broadcast(log string) {
+	vh.mu.Lock()
+	defer vh.mu.Unlock()
+	for conn, framing := range vh.viewers {
+		conn.SetWriteDeadline(time.Now().Add(viewerWriteTimeout))
+		if _, err := conn.Write(framing.Encode(vh.prefix + log)); err != nil {
+			conn.Close()
+			delete(vh.viewers, conn)
 		}
 	}
-	return filteredLogs
 }
 
-type ConnectionState struct {
-	conn          net.Conn
-	alive         bool
-	lastHeartbeat time.Time
-	mu            sync.Mutex
+// RedrawThrottle redraws once per log until logs arrive faster than
+// floodRate a second. It then redraws every floodRedraw until a second
+// goes by under the rate, so a flood can't queue a redraw per message.
+type RedrawThrottle struct {
+	redraw  func()
+	onFlood func()
+	clock   logger.Clock
+
+	mu          sync.Mutex
+	windowStart time.Time
+	count       int
+	flooding    bool
+	pending     bool
+}
+
+// NewRedrawThrottle starts the periodic redraw loop. onFlood runs once
+// each time a flood begins. Rates are measured against clock.
+func NewRedrawThrottle(redraw, onFlood func(), clock logger.Clock) *RedrawThrottle {
+	rt := &RedrawThrottle{redraw: redraw, onFlood: onFlood, clock: clock, windowStart: clock.Now()}
+	go rt.run()
+	return rt
+}
+
+// Log records a new log and redraws for it unless flooded.
+func (rt *RedrawThrottle) Log() {
+	rt.mu.Lock()
+	now := rt.clock.Now()
+	if now.Sub(rt.windowStart) >= time.Second {
+		if rt.calmLocked(now) {
+			rt.flooding = false
+		}
+		rt.windowStart, rt.count = now, 0
+	}
+	rt.count++
+	started := !rt.flooding && rt.count > floodRate
+	if started {
+		rt.flooding = true
+	}
+	flooding := rt.flooding
+	rt.pending = rt.pending || flooding
+	rt.mu.Unlock()
+
+	if started {
+		rt.onFlood()
+	}
+	if !flooding {
+		rt.redraw()
+	}
+}
+
+func (rt *RedrawThrottle) Flooding() bool {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	return rt.flooding
+}
+
+// calmLocked reports whether the rate has dropped: the last window ended
+// under floodRate, or a whole second has passed since it ended.
+func (rt *RedrawThrottle) calmLocked(now time.Time) bool {
+	since := now.Sub(rt.windowStart)
+	return since >= 2*time.Second || (since >= time.Second && rt.count <= floodRate)
+}
+
+func (rt *RedrawThrottle) run() {
+	ticker := time.NewTicker(floodRedraw)
+	defer ticker.Stop()
+	for range ticker.C {
+		rt.mu.Lock()
+		if rt.flooding && rt.calmLocked(rt.clock.Now()) {
+			rt.flooding = false
+		}
+		pending := rt.pending
+		rt.pending = false
+		rt.mu.Unlock()
+
+		if pending {
+			rt.redraw()
+		}
+	}
+}
+
+// EventLoopGate holds back updates for an app until its event loop is
+// running. Logs injected or received at startup, as with -demo or
+// -replay, would otherwise fill tview's update queue and block whoever
+// queued them.
+type EventLoopGate struct {
+	app     *tview.Application
+	running atomic.Bool
+}
+
+func NewEventLoopGate(app *tview.Application) *EventLoopGate {
+	return &EventLoopGate{app: app}
+}
+
+// QueueUpdateDraw queues update as the app's does once the loop is
+// running, and drops it until then.
+func (g *EventLoopGate) QueueUpdateDraw(update func()) {
+	if g.running.Load() {
+		g.app.QueueUpdateDraw(update)
+	}
+}
+
+// Open queues first as the loop's first update, letting later ones
+// through once it runs. It returns straight away, so it can be called
+// before Run.
+func (g *EventLoopGate) Open(first func()) {
+	go g.app.QueueUpdateDraw(func() {
+		g.running.Store(true)
+		first()
+	})
+}
+
+// StatusWebhook POSTs a small JSON payload to a URL each time the client
+// connects or disconnects, for monitoring to react to. A change only
+// counts once it has held for webhookDebounce, so a flapping link doesn't
+// post every blip.
+type StatusWebhook struct {
+	url      string
+	instance string
+	clock    logger.Clock
+	client   *http.Client
+	posts    chan statusPayload
+	onError  func(error)
+
+	mu        sync.Mutex
+	reported  bool // the state last posted, starting disconnected
+	candidate bool
+	since     time.Time
+}
+
+type statusPayload struct {
+	Connected bool      `json:"connected"`
+	Instance  string    `json:"instance,omitempty"`
+	Time      time.Time `json:"time"`
+}
+
+// NewStatusWebhook starts the goroutine that posts to url, one change at
+// a time and in order. onError is told of each post that fails.
+func NewStatusWebhook(url, instance string, clock logger.Clock, onError func(error)) *StatusWebhook {
+	sw := &StatusWebhook{
+		url:      url,
+		instance: instance,
+		clock:    clock,
+		client:   &http.Client{Timeout: webhookTimeout},
+		posts:    make(chan statusPayload, 16),
+		onError:  onError,
+	}
+	go sw.run()
+	return sw
+}
+
+// Observe records whether the client is connected now, posting once a
+// change has held long enough. Call it regularly.
+func (sw *StatusWebhook) Observe(connected bool) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+	now := sw.clock.Now()
+	if connected == sw.reported {
+		sw.candidate = connected
+		return
+	}
+	if connected != sw.candidate {
+		sw.candidate, sw.since = connected, now
+	}
+	if now.Sub(sw.since) < webhookDebounce {
+		return
+	}
+	sw.reported = connected
+	select {
+	case sw.posts <- statusPayload{Connected: connected, Instance: sw.instance, Time: now}:
+	default:
+		// The endpoint is that far behind; skip rather than block
+	}
 }
 
-func NewConnectionState() *ConnectionState {
-	return &ConnectionState{}
+func (sw *StatusWebhook) run() {
+	for payload := range sw.posts {
+		if err := sw.post(payload); err != nil && sw.onError != nil {
+			sw.onError(err)
+		}
+	}
+}
+
+func (sw *StatusWebhook) post(payload statusPayload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	resp, err := sw.client.Post(sw.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("status webhook answered %s", resp.Status)
+	}
+	return nil
 }
 
 type UIComponents struct {
@@ -66,6 +332,7 @@ type UIComponents struct {
 	errorLogsView    *tview.TextView
 	searchBar        *tview.InputField
 	connectionStatus *tview.TextView
+	legend           *tview.TextView
 	footer           *tview.TextView
 }
 
@@ -73,6 +340,7 @@ func CreateUIComponents() *UIComponents {
 	ui := &UIComponents{
 		app: tview.NewApplication(),
 	}
+	ui.app.EnableMouse(true)
 
 	ui.logoView = tview.NewTextView()
 	ui.logoView.
@@ -84,6 +352,7 @@ func CreateUIComponents() *UIComponents {
 	ui.infoLogsView.
 		SetDynamicColors(true).
 		SetScrollable(true).
+		SetRegions(true).
 		SetBorder(true).
 		SetTitle("ℹ️ Info Logs")
 
@@ -91,6 +360,7 @@ func CreateUIComponents() *UIComponents {
 	ui.warningLogsView.
 		SetDynamicColors(true).
 		SetScrollable(true).
+		SetRegions(true).
 		SetBorder(true).
 		SetTitle("⚠️ Warning Logs")
 
@@ -98,6 +368,7 @@ func CreateUIComponents() *UIComponents {
 	ui.errorLogsView.
 		SetDynamicColors(true).
 		SetScrollable(true).
+		SetRegions(true).
 		SetBorder(true).
 		SetTitle("❌ Error Logs")
 
@@ -105,7 +376,7 @@ func CreateUIComponents() *UIComponents {
 	ui.searchBar.
 		SetLabel("Search: ").
 		SetFieldWidth(30).
-		SetPlaceholder("Type here to filter logs...").
+		SetPlaceholder("Type here to filter logs, or /regexp/...").
 		SetDoneFunc(func(key tcell.Key) {
 			if key == tcell.KeyEsc {
 				ui.searchBar.SetText("")
@@ -113,107 +384,1210 @@ func CreateUIComponents() *UIComponents {
 			}
 		})
 
+	// The status stands out on its own background and never wraps, so
+	// however long it gets it stays on its one row
 	ui.connectionStatus = tview.NewTextView()
 	ui.connectionStatus.
 		SetTextAlign(tview.AlignCenter).
 		SetDynamicColors(true).
-		SetText("No Client Connected")
+		SetWrap(false).
+		SetText("No Client Connected").
+		SetBackgroundColor(tcell.ColorNavy)
+
+	ui.legend = tview.NewTextView()
+	ui.legend.
+		SetTextAlign(tview.AlignCenter).
+		SetDynamicColors(true)
 
 	ui.footer = tview.NewTextView()
 	ui.footer.
 		SetTextAlign(tview.AlignCenter).
-		SetDynamicColors(true).
-		SetText("Mouse: Use search to filter logs | '/' Search, 'Q' Quit")
+		SetDynamicColors(true)
+
+	ui.grid = tview.NewGrid().
+		SetColumns(0, 0, 0)
 
 	return ui
 }
 
-func main() {
-	logManager := &LogManager{}
-	connState := NewConnectionState()
-	ui := CreateUIComponents()
-
-	ui.grid = tview.NewGrid().
-		SetRows(1, 1, 0, 1, 1).
-		SetColumns(0, 0, 0).
-		SetBorders(true)
-
+// layoutGrid lays the grid out, with notes under the log panes unless it
+// is nil. Every row but the log panes' and the notes' is a fixed single
+// line, so the status keeps its place whatever the panes hold. Compact
+// mode drops the grid's borders and the legend.
+func (ui *UIComponents) layoutGrid(notes tview.Primitive, compact bool) {
+	ui.grid.Clear()
+	ui.grid.SetBorders(!compact)
+	rows := []int{1, 1, 0}
+	if notes != nil {
+		rows = append(rows, 8)
+	}
+	rows = append(rows, 1)
 	ui.grid.AddItem(ui.logoView, 0, 0, 1, 3, 0, 0, false).
 		AddItem(ui.searchBar, 1, 0, 1, 3, 0, 0, false).
 		AddItem(ui.infoLogsView, 2, 0, 1, 1, 0, 0, false).
 		AddItem(ui.warningLogsView, 2, 1, 1, 1, 0, 0, false).
-		AddItem(ui.errorLogsView, 2, 2, 1, 1, 0, 0, false).
-		AddItem(ui.connectionStatus, 3, 0, 1, 3, 0, 0, false).
-		AddItem(ui.footer, 4, 0, 1, 3, 0, 0, false)
+		AddItem(ui.errorLogsView, 2, 2, 1, 1, 0, 0, false)
+	if notes != nil {
+		ui.grid.AddItem(notes, 3, 0, 1, 3, 0, 0, false)
+	}
+	ui.grid.AddItem(ui.connectionStatus, len(rows)-1, 0, 1, 3, 0, 0, false)
+	if !compact {
+		rows = append(rows, 1)
+		ui.grid.AddItem(ui.legend, len(rows)-1, 0, 1, 3, 0, 0, false)
+	}
+	rows = append(rows, 1)
+	ui.grid.AddItem(ui.footer, len(rows)-1, 0, 1, 3, 0, 0, false)
+	ui.grid.SetRows(rows...)
+}
+
+func main() {
+	port := flag.String("port", logger.DefaultPort(), "port to listen for clients on; defaults to $LOGGER_PORT, else 8080")
+	heartbeatTimeout := flag.Duration("heartbeat-timeout", logger.DefaultHeartbeatTimeout, "how long a client may go without a heartbeat before it shows as disconnected; keep it at least twice the client's -heartbeat-interval")
+	tlsCert := flag.String("tls-cert", "", "PEM certificate to accept clients over TLS with, along with -tls-key; plain TCP without")
+	tlsKey := flag.String("tls-key", "", "PEM private key for -tls-cert")
+	metricsAddr := flag.String("metrics-addr", "", "address, such as :9100, to serve Prometheus metrics at /metrics on; none without")
+	viewerAddr := flag.String("viewer-addr", "", "address to stream received logs to viewers on, e.g. :8081")
+	subscribe := flag.String("subscribe", "ALL", "comma-separated levels clients should send, e.g. WARNING,ERROR")
+	ascii := flag.Bool("ascii", false, "show the connection status as [UP]/[DOWN] instead of emoji")
+	idleDim := flag.Duration("idle-dim", 0, "dim the screen after this long without new logs or keypresses, e.g. 5m; 0 never dims")
+	maxLogs := flag.Int("max-logs", 10000, "number of logs to keep before dropping the oldest, 0 for no limit")
+	maxMessage := flag.Int("max-message", logger.DefaultMaxMessageSize, "longest message read from a client whole, in bytes; longer ones are truncated with a warning")
+	logFile := flag.String("log-file", "", "file to append received logs to, reloaded on the next start so their history is shown again")
+	utc := flag.Bool("utc", false, "show timestamps in UTC instead of local time")
+	ageFade := flag.Duration("age-fade", 0, "fade logs gradually as they age, reaching the dimmest at this age, e.g. 10m; 0 never fades")
+	smart := flag.Bool("smart-colors", false, "color HTTP status codes by class and slow durations red within messages")
+	slow := flag.Duration("slow", time.Second, "durations at least this long are colored red with -smart-colors")
+	reverse := flag.Bool("reverse", false, "show the newest logs at the top instead of the bottom")
+	spawnClient := flag.Bool("spawn-client", false, "dev/testing only: run the bundled client headless against this server, stopping it on exit")
+	clientBin := flag.String("client-bin", "Client", "client binary for -spawn-client, looked for next to this one and then on PATH")
+	demo := flag.Bool("demo", false, "inject a stream of synthetic logs to show the UI off without a client")
+	format := flag.String("format", "plain", "format clients' logs are in: "+strings.Join(logger.Formats, ", "))
+	compress := flag.Bool("compress", false, "accept gzip-compressed streams from clients run with -compress")
+	keepBlank := flag.Bool("keep-blank", false, "store blank lines from clients instead of skipping them")
+	minLevel := flag.String("min-level", "", "discard client logs below this level: "+strings.Join(logger.Levels, ", "))
+	contextLines := flag.Int("context", 3, "number of logs shown either side of a log expanded with 'C'")
+	idPattern := flag.String("id-pattern", `\b(?:reqID|request_id|trace_id)=([\w-]+)`, "regexp recognizing request IDs, its first group being the ID; '' turns 'G' off")
+	topErrors := flag.Int("top-errors", 10, "number of distinct error messages listed by 'O'")
+	instanceID := flag.String("instance-id", "", "name of this server in exports and, with -tag-viewers, in logs streamed to viewers; defaults to the hostname")
+	tagViewers := flag.Bool("tag-viewers", false, "prefix logs streamed to viewers with the instance id")
+	tagClients := flag.Bool("tag-clients", false, "tag each log with the address of the client that sent it, to tell several clients apart")
+	toSyslog := flag.Bool("syslog", false, "also forward received logs to the local syslog daemon")
+	statusWebhook := flag.String("status-webhook", "", "URL to POST a JSON payload to whenever the client connects or disconnects")
+	backlog := flag.Int("backlog", 0, "number of recent logs to replay to a viewer when it connects")
+	paletteName := flag.String("palette", "", "level colors: "+strings.Join(logger.PaletteNames(), ", ")+"; defaults to the last one picked with 'P'")
+	logFormat := flag.String("template", defaultLogTemplate, "text/template for each log; fields: .Timestamp .Level .Source (the client's name or, with -tag-clients, address) .Message")
+	flag.Parse()
+
+	addr, err := logger.ListenAddr(*port)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid -port: %v\n", err)
+		os.Exit(1)
+	}
+	if *heartbeatTimeout <= 0 {
+		fmt.Fprintf(os.Stderr, "Invalid -heartbeat-timeout %v, want a positive duration\n", *heartbeatTimeout)
+		os.Exit(1)
+	}
+	tlsConfig, err := logger.LoadServerTLS(*tlsCert, *tlsKey)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid -tls-cert or -tls-key: %v\n", err)
+		os.Exit(1)
+	}
+	logTemplate, err := parseLogTemplate(*logFormat)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid -template: %v\n", err)
+		os.Exit(1)
+	}
+	levels, err := logger.ParseLevels(*subscribe)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid -subscribe: %v\n", err)
+		os.Exit(1)
+	}
+	if _, ok := logger.FindPalette(*paletteName); *paletteName != "" && !ok {
+		fmt.Fprintf(os.Stderr, "Invalid -palette %q, want one of %s\n", *paletteName, strings.Join(logger.PaletteNames(), ", "))
+		os.Exit(1)
+	}
+	var requestIDs *regexp.Regexp
+	if *idPattern != "" {
+		if requestIDs, err = regexp.Compile(*idPattern); err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid -id-pattern: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	parser, err := logger.ParseFormat(*format)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid -format: %v\n", err)
+		os.Exit(1)
+	}
+	if *maxMessage <= 0 {
+		fmt.Fprintf(os.Stderr, "Invalid -max-message %d, want a positive size\n", *maxMessage)
+		os.Exit(1)
+	}
+	*minLevel = strings.ToUpper(*minLevel)
+	if *minLevel != "" && logger.LevelRank(*minLevel) < 0 {
+		fmt.Fprintf(os.Stderr, "Invalid -min-level %q, want one of %s\n", *minLevel, strings.Join(logger.Levels, ", "))
+		os.Exit(1)
+	}
+
+	// One clock for heartbeats, flood detection and idle dimming
+	clock := logger.RealClock
+	server := logger.NewServer(addr)
+	server.SetHeartbeatTimeout(*heartbeatTimeout)
+	server.SetTLSConfig(tlsConfig)
+	server.SetMetricsAddr(*metricsAddr)
+	server.SetClock(clock)
+	server.SetLevels(levels)
+	server.SetKeepBlank(*keepBlank)
+	server.SetCompress(*compress)
+	server.SetClientPrefix(*tagClients)
+	server.SetMaxMessageSize(*maxMessage)
+	if *format != "plain" {
+		server.SetParser(parser)
+	}
+	server.SetMinLevel(*minLevel)
+	server.SetQueueSize(logQueueSize)
+	logManager := server.Logs()
+	logManager.SetLimit(*maxLogs)
+	logManager.SetIDPattern(requestIDs)
+	if *logFile != "" {
+		if _, err := logManager.LoadFromFile(*logFile); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load -log-file: %v\n", err)
+			os.Exit(1)
+		}
+		if err := logManager.SetLogFile(*logFile); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to open -log-file: %v\n", err)
+			os.Exit(1)
+		}
+		defer logManager.CloseLogFile()
+	}
+	if *instanceID == "" {
+		*instanceID, _ = os.Hostname()
+	}
+	viewerHub := NewViewerHub()
+	if *tagViewers && *instanceID != "" {
+		viewerHub.SetPrefix("[" + *instanceID + "] ")
+	}
+	ui := CreateUIComponents()
+
+	// Notes: the operator's own timestamped annotations, kept apart from
+	// the logs and merged back in by Export
+	var notes []note
+	notesView := tview.NewTextView().
+		SetDynamicColors(true).
+		SetScrollable(true)
+	noteInput := tview.NewInputField().
+		SetLabel("Note: ").
+		SetPlaceholder("Enter adds a note, Esc leaves")
+	notesPane := tview.NewFlex().SetDirection(tview.FlexRow).
+		AddItem(notesView, 0, 1, false).
+		AddItem(noteInput, 1, 0, true)
+	notesPane.SetBorder(true).SetTitle("📝 Notes")
+	showNotes := false
+
+	// Compact mode drops the grid's borders and the legend, giving the
+	// rows they took to the log panes
+	prefs := logger.LoadPrefs("server")
+	compact := prefs.Bool("compact", false)
+	layoutGrid := func() {
+		var pane tview.Primitive
+		if showNotes {
+			pane = notesPane
+		}
+		ui.layoutGrid(pane, compact)
+	}
+	layoutGrid()
+
+	// Search state, only touched on the UI goroutine
+	searchQuery := ""
+	searchFocused := false
+	highlightOnly := false
+
+	showTimestamps := prefs.Bool("timestamps", true)
+	if *paletteName == "" {
+		*paletteName = prefs.Get("palette", "default")
+	}
+	palette, ok := logger.FindPalette(*paletteName)
+	if !ok {
+		palette = logger.LevelPalettes[0]
+	}
+	ui.legend.SetText(levelLegend(palette))
+	newestFirst := *reverse
+	inUTC := *utc
+	showInstance := false
+
+	// Rules recategorizing logs, kept in prefs as JSON
+	var levelRules logger.LevelRules
+	json.Unmarshal([]byte(prefs.Get("level-rules", "[]")), &levelRules)
+	logManager.SetLevelRules(levelRules)
+
+	// Each pane's logs in the order drawn, and the pane a block is being
+	// selected in, if any
+	shownLogs := map[*tview.TextView][]string{}
+	var selectView *tview.TextView
+
+	// Set while the top errors table is open, to keep it current
+	var refreshTopErrors func()
 
 	updateLogSections := func(searchQuery string) {
-		ui.app.QueueUpdateDraw(func() {
-			ui.infoLogsView.SetText(strings.Join(logManager.GetSearchFilteredLogs(searchQuery, "INFO"), "\n"))
-			ui.warningLogsView.SetText(strings.Join(logManager.GetSearchFilteredLogs(searchQuery, "WARNING"), "\n"))
-			ui.errorLogsView.SetText(strings.Join(logManager.GetSearchFilteredLogs(searchQuery, "ERROR"), "\n"))
+		render := RenderOptions{Template: logTemplate, HideTimestamps: !showTimestamps, UTC: inUTC, Reverse: newestFirst, Rules: levelRules, Palette: palette, Regions: true}
+		if showInstance {
+			render.Instance = *instanceID
+		}
+		render.Smart, render.Slow = *smart, *slow
+		render.Fade, render.Now = *ageFade, clock.Now()
+		filterQuery := searchQuery
+		if highlightOnly {
+			// Keep every log for context and mark the matches instead
+			render.Highlight = searchQuery
+			render.CaseSensitive = logManager.CaseSensitive()
+			filterQuery = ""
+		}
+		levelViews := map[string]*tview.TextView{
+			"INFO":    ui.infoLogsView,
+			"WARNING": ui.warningLogsView,
+			"ERROR":   ui.errorLogsView,
+		}
+		// A regular expression that doesn't compile is reported in place
+		// of the logs until it is fixed
+		if _, err := logManager.CompileSearch(searchQuery); searchQuery != "" && err != nil {
+			for _, view := range levelViews {
+				view.SetText("[red]" + tview.Escape(err.Error()) + "[white]")
+				shownLogs[view] = nil
+			}
+			return
+		}
+		for level, view := range levelViews {
+			// Acknowledged errors are drawn dimmed
+			logs, seqs := logManager.GetSearchFilteredLogSeqs(filterQuery, level)
+			render.Dim = func(i int) bool { return logManager.Acked(seqs[i]) }
+			view.SetText(renderLogs(logs, render))
+			shownLogs[view] = slices.Clone(logs)
+			if newestFirst {
+				slices.Reverse(shownLogs[view])
+			}
+			// Follow the newest log, wherever it is drawn, unless a block
+			// is being selected
+			if view == selectView {
+				view.ScrollToHighlight()
+			} else if newestFirst {
+				view.ScrollToBeginning()
+			} else {
+				view.ScrollToEnd()
+			}
+		}
+		if refreshTopErrors != nil {
+			refreshTopErrors()
+		}
+	}
+
+	// Last new log or keypress, for -idle-dim
+	lastActivity := clock.Now()
+	dimmed := func() bool {
+		return *idleDim > 0 && clock.Now().Sub(lastActivity) >= *idleDim
+	}
+
+	// Redraw for newly arrived logs. While a query is being typed the
+	// results are held still and catch up once the search bar loses focus.
+	// Until the event loop runs nothing is queued; its first update draws
+	// everything stored by then.
+	gate := NewEventLoopGate(ui.app)
+	refreshLogSections := func() {
+		gate.QueueUpdateDraw(func() {
+			lastActivity = clock.Now()
+			if searchFocused && searchQuery != "" {
+				return
+			}
+			updateLogSections(searchQuery)
 		})
 	}
 
+	// Fading logs are redrawn as they cross into the next step, without
+	// that counting as activity for -idle-dim
+	if *ageFade > 0 {
+		go func() {
+			ticker := time.NewTicker(max(time.Second, *ageFade/fadeSteps))
+			defer ticker.Stop()
+			for range ticker.C {
+				gate.QueueUpdateDraw(func() {
+					if !searchFocused || searchQuery == "" {
+						updateLogSections(searchQuery)
+					}
+				})
+			}
+		}()
+	}
+
 	ui.searchBar.SetChangedFunc(func(query string) {
+		searchQuery = query
 		updateLogSections(query)
 	})
+	ui.searchBar.SetFocusFunc(func() {
+		searchFocused = true
+	})
+	ui.searchBar.SetBlurFunc(func() {
+		searchFocused = false
+		updateLogSections(searchQuery)
+	})
 
-	ui.app.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+	// Help screen over the log grid, closed with any key
+	pages := tview.NewPages().AddPage("logs", ui.grid, true, true)
+	keymap := logger.NewKeymap()
+	showHelp := func() {
+		help := tview.NewModal().
+			SetText(keymap.Help()).
+			AddButtons([]string{"Close"}).
+			SetDoneFunc(func(int, string) {
+				pages.RemovePage("help")
+			})
+		pages.AddPage("help", help, true, true)
+	}
+
+	keymap.RegisterKey('/', "Search", func() {
+		ui.app.SetFocus(ui.searchBar)
+	})
+	keymap.RegisterKey('h', "Filter/Highlight", func() {
+		highlightOnly = !highlightOnly
+		if highlightOnly {
+			ui.searchBar.SetLabel("Highlight: ")
+		} else {
+			ui.searchBar.SetLabel("Search: ")
+		}
+		updateLogSections(searchQuery)
+	})
+	keymap.RegisterKey('r', "Newest First", func() {
+		newestFirst = !newestFirst
+		updateLogSections(searchQuery)
+	})
+	keymap.RegisterKey('t', "Timestamps", func() {
+		showTimestamps = !showTimestamps
+		prefs.SetBool("timestamps", showTimestamps)
+		updateLogSections(searchQuery)
+	})
+	// Diff mode: mark a range A and a range B of logs, then compare their
+	// messages with timestamps stripped
+	showDiffPicker := func() {
+		logs := logManager.GetSearchFilteredLogs("", "")
+		table := tview.NewTable().SetSelectable(true, false)
+		table.SetBorder(true).SetTitle("Diff: 'A'/'B' mark range ends, 'D' compare, Esc close")
+		for i, log := range logs {
+			table.SetCell(i, 0, tview.NewTableCell(fmt.Sprintf("%d", i+1)).SetTextColor(tcell.ColorGray))
+			table.SetCell(i, 1, tview.NewTableCell(tview.Escape(log)).SetExpansion(1))
+		}
+
+		// Each range is one or two marked rows
+		var marks [2][]int
+		inRange := func(r []int, row int) bool {
+			return len(r) > 0 && row >= min(r[0], r[len(r)-1]) && row <= max(r[0], r[len(r)-1])
+		}
+		messages := func(r []int) []string {
+			var msgs []string
+			for row := min(r[0], r[len(r)-1]); row <= max(r[0], r[len(r)-1]); row++ {
+				_, msg := splitTimestamp(logs[row])
+				msgs = append(msgs, msg)
+			}
+			return msgs
+		}
+		paint := func() {
+			for row := range logs {
+				color := tcell.ColorDefault
+				switch {
+				case inRange(marks[0], row):
+					color = tcell.ColorDarkBlue
+				case inRange(marks[1], row):
+					color = tcell.ColorDarkMagenta
+				}
+				table.GetCell(row, 1).SetBackgroundColor(color)
+			}
+		}
+
+		table.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+			if event.Key() == tcell.KeyEsc {
+				pages.RemovePage("diff")
+				return nil
+			}
+			switch r := unicode.ToLower(event.Rune()); r {
+			case 'a', 'b':
+				row, _ := table.GetSelection()
+				if len(logs) == 0 {
+					return nil
+				}
+				i := int(r - 'a')
+				if len(marks[i]) == 2 {
+					marks[i] = nil
+				}
+				marks[i] = append(marks[i], row)
+				paint()
+				return nil
+			case 'd':
+				if len(marks[0]) == 0 || len(marks[1]) == 0 {
+					return nil
+				}
+				result := tview.NewTextView().
+					SetDynamicColors(true).
+					SetScrollable(true).
+					SetText(renderDiff(diffLines(messages(marks[0]), messages(marks[1]))))
+				result.SetBorder(true).SetTitle("Diff A → B (Esc back)")
+				result.SetDoneFunc(func(tcell.Key) {
+					pages.RemovePage("diff-result")
+				})
+				pages.AddPage("diff-result", result, true, true)
+				return nil
+			}
+			return event
+		})
+
+		pages.AddPage("diff", table, true, true)
+	}
+
+	keymap.RegisterKey('d', "Diff", showDiffPicker)
+	// Context: pick one of the current results and see the logs around it
+	// in the unfiltered buffer, like grep -C
+	showContextPicker := func() {
+		query := searchQuery
+		if highlightOnly {
+			query = ""
+		}
+		logs, seqs := logManager.GetSearchFilteredLogSeqs(query, "")
+		table := tview.NewTable().SetSelectable(true, false)
+		table.SetBorder(true).SetTitle(fmt.Sprintf("Context: Enter shows %d logs either side, Esc close", *contextLines))
+		for i, log := range logs {
+			table.SetCell(i, 0, tview.NewTableCell(tview.Escape(log)).SetTextColor(tcell.GetColor(palette.Color(levelRules.Level(log)))).SetExpansion(1))
+		}
+		if len(logs) > 0 {
+			table.Select(len(logs)-1, 0)
+		}
+		table.SetDoneFunc(func(key tcell.Key) {
+			if key == tcell.KeyEsc {
+				pages.RemovePage("context")
+			}
+		})
+		table.SetSelectedFunc(func(row, _ int) {
+			around, match := logManager.GetContext(seqs[row], *contextLines)
+			lines := make([]string, len(around))
+			for i, log := range around {
+				lines[i] = colorize(tview.Escape(log), palette.Color(levelRules.Level(log)))
+				if i != match {
+					lines[i] = "[::d]" + lines[i] + "[::-]"
+				}
+			}
+			result := tview.NewTextView().
+				SetDynamicColors(true).
+				SetScrollable(true).
+				SetText(strings.Join(lines, "\n"))
+			result.SetBorder(true).SetTitle("Context (Esc back)")
+			result.SetDoneFunc(func(tcell.Key) {
+				pages.RemovePage("context-result")
+			})
+			pages.AddPage("context-result", result, true, true)
+		})
+		pages.AddPage("context", table, true, true)
+	}
+
+	keymap.RegisterKey('c', "Context", showContextPicker)
+
+	// Request: pick one of the current results carrying a request ID and
+	// see every log with that ID, at any level, as the request's timeline
+	showRequestPicker := func() {
+		query := searchQuery
+		if highlightOnly {
+			query = ""
+		}
+		logs, _ := logManager.GetSearchFilteredLogSeqs(query, "")
+		var ids []string
+		table := tview.NewTable().SetSelectable(true, false)
+		table.SetBorder(true).SetTitle("Request: Enter shows every log with the request's ID, Esc close")
+		for _, log := range logs {
+			id := logManager.RequestID(log)
+			if id == "" {
+				continue
+			}
+			table.SetCell(len(ids), 0, tview.NewTableCell(tview.Escape(id)).SetTextColor(tcell.ColorAqua))
+			table.SetCell(len(ids), 1, tview.NewTableCell(tview.Escape(log)).SetTextColor(tcell.GetColor(palette.Color(levelRules.Level(log)))).SetExpansion(1))
+			ids = append(ids, id)
+		}
+		if len(ids) > 0 {
+			table.Select(len(ids)-1, 0)
+		}
+		table.SetDoneFunc(func(key tcell.Key) {
+			if key == tcell.KeyEsc {
+				pages.RemovePage("request")
+			}
+		})
+		table.SetSelectedFunc(func(row, _ int) {
+			timeline, _ := logManager.GetLogsByID(ids[row])
+			lines := make([]string, len(timeline))
+			for i, log := range timeline {
+				lines[i] = colorize(tview.Escape(log), palette.Color(levelRules.Level(log)))
+			}
+			result := tview.NewTextView().
+				SetDynamicColors(true).
+				SetScrollable(true).
+				SetText(strings.Join(lines, "\n"))
+			result.SetBorder(true).SetTitle(tview.Escape(fmt.Sprintf("Request %s: %d logs (Esc back)", ids[row], len(timeline))))
+			result.SetDoneFunc(func(tcell.Key) {
+				pages.RemovePage("request-result")
+			})
+			pages.AddPage("request-result", result, true, true)
+		})
+		pages.AddPage("request", table, true, true)
+	}
+	if requestIDs != nil {
+		keymap.RegisterKey('g', "Request", showRequestPicker)
+	}
+
+	// Level rules: add "logs containing X are level Y" rules, or remove one
+	showRulesForm := func() {
+		setRules := func(rules logger.LevelRules) {
+			levelRules = rules
+			logManager.SetLevelRules(rules)
+			if data, err := json.Marshal(rules); err == nil {
+				prefs.Set("level-rules", string(data))
+			}
+			updateLogSections(searchQuery)
+		}
+
+		list := tview.NewList().ShowSecondaryText(false)
+		fillList := func() {
+			list.Clear()
+			for i, rule := range levelRules {
+				list.AddItem(tview.Escape(fmt.Sprintf("%d. Containing %q → %s", i+1, rule.Match, rule.Level)), "", 0, nil)
+			}
+		}
+		list.SetSelectedFunc(func(i int, _, _ string, _ rune) {
+			setRules(slices.Delete(slices.Clone(levelRules), i, i+1))
+			fillList()
+		})
+		fillList()
+
+		closeForm := func() { pages.RemovePage("rules") }
+		match := tview.NewInputField().SetLabel("Containing").SetFieldWidth(30)
+		level := tview.NewDropDown().SetLabel("Level").SetOptions(logger.Levels, nil).SetCurrentOption(logger.LevelRank("WARNING"))
+		form := tview.NewForm().
+			AddFormItem(match).
+			AddFormItem(level).
+			AddButton("Add", func() {
+				_, lvl := level.GetCurrentOption()
+				if strings.TrimSpace(match.GetText()) == "" {
+					return
+				}
+				setRules(append(slices.Clone(levelRules), logger.LevelRule{Match: match.GetText(), Level: lvl}))
+				fillList()
+				match.SetText("")
+			}).
+			AddButton("Close", closeForm).
+			SetCancelFunc(closeForm)
+		list.SetDoneFunc(closeForm)
+
+		rules := tview.NewFlex().SetDirection(tview.FlexRow).
+			AddItem(list, 0, 1, false).
+			AddItem(form, 7, 0, true)
+		rules.SetBorder(true).SetTitle("Level Rules: Enter on a rule removes it, Shift-Tab switches list/form, Esc close")
+		rules.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+			if event.Key() == tcell.KeyBacktab {
+				if list.HasFocus() {
+					ui.app.SetFocus(form)
+				} else {
+					ui.app.SetFocus(list)
+				}
+				return nil
+			}
+			return event
+		})
+		pages.AddPage("rules", rules, true, true)
+	}
+	keymap.RegisterKey('l', "Level Rules", showRulesForm)
+
+	// Find: fuzzy-match the logs in the panes and jump to the chosen one
+	showFinder := func() {
+		type candidate struct {
+			view  *tview.TextView
+			index int
+			log   string
+			score int
+		}
+		var all []candidate
+		for _, view := range []*tview.TextView{ui.infoLogsView, ui.warningLogsView, ui.errorLogsView} {
+			for i, log := range shownLogs[view] {
+				all = append(all, candidate{view: view, index: i, log: log})
+			}
+		}
+		slices.Reverse(all)
+
+		input := tview.NewInputField().SetLabel("Find: ")
+		results := tview.NewTable().SetSelectable(true, false)
+		var matches []candidate
+		filter := func(query string) {
+			matches = matches[:0]
+			for _, c := range all {
+				if score, ok := fuzzyScore(query, parseLogFields(c.log).Message); ok {
+					c.score = score
+					matches = append(matches, c)
+				}
+			}
+			// Best first, newest first among equals
+			slices.SortStableFunc(matches, func(a, b candidate) int { return b.score - a.score })
+			results.Clear()
+			for i, c := range matches {
+				results.SetCell(i, 0, tview.NewTableCell(tview.Escape(c.log)).SetTextColor(tcell.GetColor(palette.Color(levelRules.Level(c.log)))).SetExpansion(1))
+			}
+			results.Select(0, 0).ScrollToBeginning()
+		}
+		input.SetChangedFunc(filter)
+		filter("")
+
+		input.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+			row, _ := results.GetSelection()
+			switch event.Key() {
+			case tcell.KeyUp:
+				results.Select(max(0, row-1), 0)
+				return nil
+			case tcell.KeyDown:
+				results.Select(min(len(matches)-1, row+1), 0)
+				return nil
+			}
+			return event
+		})
+		input.SetDoneFunc(func(key tcell.Key) {
+			pages.RemovePage("find")
+			row, _ := results.GetSelection()
+			if key != tcell.KeyEnter || row >= len(matches) {
+				return
+			}
+			c := matches[row]
+			c.view.Highlight(strconv.Itoa(c.index))
+			c.view.ScrollToHighlight()
+			ui.app.SetFocus(c.view)
+		})
+
+		finder := tview.NewFlex().SetDirection(tview.FlexRow).
+			AddItem(input, 1, 0, true).
+			AddItem(results, 0, 1, false)
+		finder.SetBorder(true).SetTitle("Find: type to fuzzy match, ↑/↓ choose, Enter jump, Esc close")
+		pages.AddPage("find", finder, true, true)
+	}
+	keymap.RegisterKey('f', "Find", showFinder)
+	showErrors := func() {
+		ui.app.SetFocus(ui.errorLogsView)
+		if newestFirst {
+			ui.errorLogsView.ScrollToBeginning()
+		} else {
+			ui.errorLogsView.ScrollToEnd()
+		}
+	}
+	keymap.RegisterKey('e', "Errors", showErrors)
+
+	// Top errors: the most frequent error messages, kept current as logs
+	// arrive. Enter searches for the chosen one.
+	showTopErrors := func() {
+		table := tview.NewTable().SetSelectable(true, false).SetFixed(1, 0)
+		table.SetBorder(true).SetTitle("Top Errors: Enter filters to a message, O flips the order, Esc close")
+		ascending := false
+		var counts []logger.ErrorCount
+		fill := func() {
+			selected := ""
+			if row, _ := table.GetSelection(); row > 0 && row <= len(counts) {
+				selected = counts[row-1].Message
+			}
+			counts = logManager.TopErrors(*topErrors)
+			if ascending {
+				slices.Reverse(counts)
+			}
+			table.Clear()
+			table.SetCell(0, 0, tview.NewTableCell("Count").SetSelectable(false).SetTextColor(tcell.ColorYellow))
+			table.SetCell(0, 1, tview.NewTableCell("Message").SetSelectable(false).SetTextColor(tcell.ColorYellow))
+			row := 1
+			for i, count := range counts {
+				table.SetCell(i+1, 0, tview.NewTableCell(strconv.Itoa(count.Count)).SetAlign(tview.AlignRight))
+				table.SetCell(i+1, 1, tview.NewTableCell(tview.Escape(count.Message)).SetTextColor(tcell.GetColor(palette.Color("ERROR"))).SetExpansion(1))
+				if count.Message == selected {
+					row = i + 1
+				}
+			}
+			table.Select(row, 0)
+		}
+		fill()
+		closeTable := func() {
+			refreshTopErrors = nil
+			pages.RemovePage("top-errors")
+		}
+		table.SetDoneFunc(func(key tcell.Key) {
+			if key == tcell.KeyEsc {
+				closeTable()
+			}
+		})
+		table.SetSelectedFunc(func(row, _ int) {
+			if row < 1 || row > len(counts) {
+				return
+			}
+			message := counts[row-1].Message
+			closeTable()
+			ui.searchBar.SetText(message)
+			showErrors()
+		})
+		table.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+			if unicode.ToLower(event.Rune()) == 'o' {
+				ascending = !ascending
+				fill()
+				return nil
+			}
+			return event
+		})
+		refreshTopErrors = fill
+		pages.AddPage("top-errors", table, true, true)
+	}
+	keymap.RegisterKey('o', "Top Errors", showTopErrors)
+	ui.logoView.SetMouseCapture(func(action tview.MouseAction, event *tcell.EventMouse) (tview.MouseAction, *tcell.EventMouse) {
+		if action == tview.MouseLeftClick && logManager.ActiveErrors() > 0 {
+			showErrors()
+			return action, nil
+		}
+		return action, event
+	})
+	keymap.RegisterKey('k', "Ack Error", func() {
+		if logManager.AckLastError() {
+			updateLogSections(searchQuery)
+		}
+	})
+	keymap.RegisterKey('a', "Ack All Errors", func() {
+		logManager.AckAllErrors()
+		updateLogSections(searchQuery)
+	})
+	// The other servers clear with 'X', but here 'X' is Export
+	keymap.RegisterKey('w', "Clear Logs", func() {
+		logManager.Clear()
+		updateLogSections(searchQuery)
+	})
+
+	// 'M' steps the minimum level up through each level to ERROR and back
+	// to keeping all
+	nextMinLevel := map[string]string{
+		"":        "TRACE",
+		"TRACE":   "DEBUG",
+		"DEBUG":   "INFO",
+		"INFO":    "WARNING",
+		"WARNING": "ERROR",
+		"ERROR":   "",
+	}
+	keymap.RegisterKey('m', "Min Level", func() {
+		server.SetMinLevel(nextMinLevel[server.MinLevel()])
+	})
+
+	// saveText writes text to a timestamped file named after what it is,
+	// and says where it went or why it couldn't
+	saveText := func(what, text string) {
+		path := fmt.Sprintf("%s-%s.txt", what, clock.Now().Format("20060102-150405"))
+		message := fmt.Sprintf("Saved %s to %s", what, path)
+		if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+			message = fmt.Sprintf("Failed to save %s: %v", what, err)
+		}
+		modal := tview.NewModal().
+			SetText(tview.Escape(message)).
+			AddButtons([]string{"OK"}).
+			SetDoneFunc(func(int, string) {
+				pages.RemovePage("saved")
+			})
+		pages.AddPage("saved", modal, false, true)
+	}
+
+	// Screenshot: dump the screen as last drawn, as plain text
+	var lastScreen tcell.Screen
+	keymap.RegisterKey('s', "Screenshot", func() {
+		if lastScreen != nil {
+			saveText("screenshot", screenText(lastScreen))
+		}
+	})
+
+	// Block selection in the focused pane: ↑/↓ move, Space drops the
+	// anchor, Enter saves the lines between anchor and cursor, Esc ends
+	selectAnchor, selectCursor := 0, 0
+	highlightSelection := func() {
+		var ids []string
+		for i := min(selectAnchor, selectCursor); i <= max(selectAnchor, selectCursor); i++ {
+			ids = append(ids, strconv.Itoa(i))
+		}
+		selectView.Highlight(ids...)
+		selectView.ScrollToHighlight()
+	}
+	keymap.RegisterKey('v', "Select", func() {
+		selectView = ui.infoLogsView
+		for _, view := range []*tview.TextView{ui.warningLogsView, ui.errorLogsView} {
+			if view.HasFocus() {
+				selectView = view
+			}
+		}
+		if len(shownLogs[selectView]) == 0 {
+			selectView = nil
+			return
+		}
+		selectAnchor = len(shownLogs[selectView]) - 1
+		if newestFirst {
+			selectAnchor = 0
+		}
+		selectCursor = selectAnchor
+		highlightSelection()
+	})
+	handleSelection := func(event *tcell.EventKey) {
+		last := len(shownLogs[selectView]) - 1
 		switch event.Key() {
+		case tcell.KeyUp:
+			selectCursor = max(0, selectCursor-1)
+		case tcell.KeyDown:
+			selectCursor = min(last, selectCursor+1)
+		case tcell.KeyEnter:
+			start, end := min(selectAnchor, selectCursor), min(last, max(selectAnchor, selectCursor))
+			if start <= end {
+				saveText("selection", strings.Join(shownLogs[selectView][start:end+1], "\n")+"\n")
+			}
+		case tcell.KeyEsc:
+			selectView.Highlight()
+			selectView = nil
+			return
 		case tcell.KeyRune:
-			switch event.Rune() {
-			case '/':
-				ui.app.SetFocus(ui.searchBar)
-			case 'q', 'Q':
-				ui.app.Stop()
+			if event.Rune() == ' ' {
+				selectAnchor = selectCursor
 			}
+		}
+		selectCursor = min(selectCursor, last)
+		selectAnchor = min(selectAnchor, last)
+		highlightSelection()
+	}
+	noteInput.SetDoneFunc(func(key tcell.Key) {
+		switch key {
+		case tcell.KeyEnter:
+			if strings.TrimSpace(noteInput.GetText()) == "" {
+				return
+			}
+			notes = append(notes, note{at: clock.Now(), text: noteInput.GetText()})
+			fmt.Fprintf(notesView, "[yellow]%s[white] %s\n", notes[len(notes)-1].at.Format("15:04:05"), tview.Escape(noteInput.GetText()))
+			notesView.ScrollToEnd()
+			noteInput.SetText("")
 		case tcell.KeyEsc:
-			ui.searchBar.SetText("")
 			ui.app.SetFocus(ui.grid)
 		}
+	})
+	keymap.RegisterKey('n', "Notes", func() {
+		showNotes = !showNotes
+		layoutGrid()
+		if showNotes {
+			ui.app.SetFocus(noteInput)
+		}
+	})
+
+	// Export: every stored log with the notes merged in by time, each
+	// tagged with the instance so exports from several servers can be
+	// told apart once combined
+	keymap.RegisterKey('x', "Export", func() {
+		lines := mergeNotes(logManager.GetFilteredLogs("ALL"), notes)
+		if *instanceID != "" {
+			for i := range lines {
+				lines[i] = "[" + *instanceID + "] " + lines[i]
+			}
+		}
+		saveText("export", strings.Join(lines, "\n")+"\n")
+	})
+	keymap.RegisterKey('z', "Compact", func() {
+		compact = !compact
+		prefs.SetBool("compact", compact)
+		layoutGrid()
+	})
+	keymap.RegisterKey('i', "Instance", func() {
+		showInstance = !showInstance
+		updateLogSections(searchQuery)
+	})
+
+	// footerNote reports the outcome of the last action until the next key
+	footerNote := ""
+	updateFooter := func() {
+		zone := "Local"
+		if inUTC {
+			zone = "UTC"
+		}
+		matchCase := "ignored"
+		if logManager.CaseSensitive() {
+			matchCase = "exact"
+		}
+		text := "Mouse: Use search to filter logs (case " + matchCase + ") | " + keymap.Footer() + " | Zone: " + zone
+		if footerNote != "" {
+			text = footerNote + " | " + text
+		}
+		ui.footer.SetText(text)
+	}
+
+	// Alt+C flips whether searches match case, in the search bar too,
+	// where plain keys are typed
+	keymap.RegisterSpecialKey(tcell.KeyRune, 'c', tcell.ModAlt, "Match Case", func() {
+		logManager.SetCaseSensitive(!logManager.CaseSensitive())
+		updateFooter()
+		updateLogSections(searchQuery)
+	})
+	ui.searchBar.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Modifiers()&tcell.ModAlt != 0 && keymap.HandleEvent(event) {
+			return nil
+		}
+		return event
+	})
+	keymap.RegisterSpecialKey(tcell.KeyEsc, 0, 0, "Clear Search", func() {
+		ui.searchBar.SetText("")
+		ui.app.SetFocus(ui.grid)
+	})
+
+	// Copy every log the panes are showing, as plain stored text
+	keymap.RegisterKey('y', "Copy All", func() {
+		query := searchQuery
+		if highlightOnly {
+			query = ""
+		}
+		logs := logManager.GetSearchFilteredLogs(query, "")
+		footerNote = fmt.Sprintf("[green]Copied %d logs[white]", len(logs))
+		if err := logger.CopyToClipboard(strings.Join(logs, "\n") + "\n"); err != nil {
+			footerNote = "[red]" + tview.Escape(fmt.Sprintf("Copy failed: %v", err)) + "[white]"
+		}
+		updateFooter()
+	})
+	keymap.RegisterKey('u', "UTC", func() {
+		inUTC = !inUTC
+		updateFooter()
+		updateLogSections(searchQuery)
+	})
+	// 'P' steps through the palettes, remembering the choice
+	keymap.RegisterKey('p', "Palette", func() {
+		next := 0
+		for i, p := range logger.LevelPalettes {
+			if p.Name == palette.Name {
+				next = (i + 1) % len(logger.LevelPalettes)
+			}
+		}
+		palette = logger.LevelPalettes[next]
+		prefs.Set("palette", palette.Name)
+		ui.legend.SetText(levelLegend(palette))
+		footerNote = tview.Escape(fmt.Sprintf("Palette: %s, %s", palette.Name, palette.About))
+		updateFooter()
+		updateLogSections(searchQuery)
+	})
+	keymap.RegisterKey('?', "Help", showHelp)
+	keymap.RegisterKey('q', "Quit", ui.app.Stop)
+	updateFooter()
+
+	ui.app.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		// The key that wakes a dimmed screen does nothing else
+		wasDimmed := dimmed()
+		lastActivity = clock.Now()
+		if wasDimmed {
+			return nil
+		}
+		// Let the search bar and any screen over the logs have every key
+		if front, _ := pages.GetFrontPage(); ui.searchBar.HasFocus() || noteInput.HasFocus() || front != "logs" {
+			return event
+		}
+		if selectView != nil {
+			handleSelection(event)
+			return nil
+		}
+		if footerNote != "" {
+			footerNote = ""
+			updateFooter()
+		}
+		if keymap.HandleEvent(event) {
+			return nil
+		}
 		return event
 	})
 
-	go monitorConnection(ui, connState)
-	go acceptConnections(connState, logManager, updateLogSections)
+	throttle := NewRedrawThrottle(refreshLogSections, func() {
+		server.InjectLog("WARNING", fmt.Sprintf("More than %d logs a second, redrawing every %v until it calms down", floodRate, floodRedraw))
+	}, clock)
+	// -syslog is dropped with a warning where there is no syslog to reach
+	var forwarder *logger.SyslogForwarder
+	var syslogErr error
+	if *toSyslog {
+		if forwarder, syslogErr = logger.NewSyslogForwarder("", "", "server-logger"); syslogErr == nil {
+			defer forwarder.Close()
+		}
+	}
+	server.OnLog(func(log string) {
+		viewerHub.Broadcast(log)
+		if forwarder != nil {
+			forwarder.Forward(log)
+		}
+		throttle.Log()
+	})
+	// SIGINT and SIGTERM quit as 'Q' does, so the server is still shut
+	// down cleanly on the way out
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	context.AfterFunc(ctx, ui.app.Stop)
+	if err := server.Start(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to start server: %v\n", err)
+		os.Exit(1)
+	}
+	defer server.Stop()
+
+	// Output through the standard log package, libraries' included, would
+	// otherwise scribble over the screen; show it as logs instead
+	log.SetOutput(logger.NewColorWriter(server, "WARNING"))
 
-	if err := ui.app.SetRoot(ui.grid, true).Run(); err != nil {
+	icons := logger.EmojiIcons
+	if *ascii {
+		icons = logger.ASCIIIcons
+	}
+	go monitorConnection(ui, server, icons, throttle)
+	if *statusWebhook != "" {
+		webhook := NewStatusWebhook(*statusWebhook, *instanceID, clock, func(err error) {
+			server.InjectLog("WARNING", fmt.Sprintf("-status-webhook: %v", err))
+		})
+		go func() {
+			ticker := time.NewTicker(500 * time.Millisecond)
+			defer ticker.Stop()
+			for range ticker.C {
+				webhook.Observe(server.Connected())
+			}
+		}()
+	}
+	if *demo {
+		go runDemo(server)
+	}
+	if *viewerAddr != "" {
+		go acceptViewers(*viewerAddr, viewerHub, logManager, *backlog)
+	}
+	if syslogErr != nil {
+		server.InjectLog("WARNING", fmt.Sprintf("-syslog disabled: %v", syslogErr))
+	}
+	if *spawnClient {
+		if stop, err := startClient(*clientBin, "localhost"+addr); err != nil {
+			server.InjectLog("ERROR", fmt.Sprintf("-spawn-client: %v", err))
+		} else {
+			defer stop()
+		}
+	}
+
+	// Dim every cell once idle; the status line's redraws keep this
+	// checked, and the next log or key draws at full brightness again
+	ui.app.SetAfterDrawFunc(func(screen tcell.Screen) {
+		lastScreen = screen
+		if !dimmed() {
+			return
+		}
+		width, height := screen.Size()
+		for y := 0; y < height; y++ {
+			for x := 0; x < width; {
+				mainc, combc, style, cells := screen.GetContent(x, y)
+				screen.SetContent(x, y, mainc, combc, style.Dim(true))
+				x += max(cells, 1)
+			}
+		}
+	})
+
+	gate.Open(func() {
+		updateLogSections(searchQuery)
+	})
+	if err := ui.app.SetRoot(pages, true).Run(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error running application: %v\n", err)
 	}
 }
 
-func monitorConnection(ui *UIComponents, connState *ConnectionState) {
+// monitorConnection keeps the status line current: the connection, and
+// whether logs are flooding in or being dropped to stay under the cap.
+func monitorConnection(ui *UIComponents, server *logger.Server, icons logger.StatusIcons, throttle *RedrawThrottle) {
 	ticker := time.NewTicker(500 * time.Millisecond)
 	defer ticker.Stop()
 
 	showEmoji := true
 	for range ticker.C {
-		connState.mu.Lock()
-		if connState.conn != nil && time.Since(connState.lastHeartbeat) > heartbeatTimer {
-			connState.alive = false
+		clients := server.ConnectedClients()
+		names := server.ConnectedNames()
+		status := icons.Line(false, false, logger.ClientsText(clients, names...))
+		if clients > 0 {
+			status = icons.Line(true, showEmoji, logger.ClientsText(clients, names...))
+		}
+		status = tview.Escape(status)
+		if throttle.Flooding() {
+			status += " | [yellow]Flood: throttling redraws[white]"
+		}
+		if dropped := server.Logs().Dropped(); dropped > 0 {
+			status += fmt.Sprintf(" | Dropped: %d", dropped)
+		}
+		if skipped := server.QueueDropped(); skipped > 0 {
+			status += fmt.Sprintf(" | [yellow]Backlogged: %d logs not shown live[white]", skipped)
+		}
+		if minLevel := server.MinLevel(); minLevel != "" {
+			status += fmt.Sprintf(" | Min level: %s (%d discarded)", minLevel, server.BelowMinLevel())
+		}
+
+		// Keep unacknowledged errors in the title row until they are acked
+		banner := "[yellow]SERVER LOGGER[white]"
+		if active := server.Logs().ActiveErrors(); active > 0 {
+			banner += fmt.Sprintf("  [red]⚠ %d unacknowledged errors — press E to view[white]", active)
 		}
-		isConnected := connState.conn != nil && connState.alive
-		connState.mu.Unlock()
 
 		ui.app.QueueUpdateDraw(func() {
-			if isConnected {
-				if showEmoji {
-					ui.connectionStatus.SetText("Client Connected")
-				} else {
-					ui.connectionStatus.SetText(aliveASCII + " Client Connected")
-				}
-			} else {
-				ui.connectionStatus.SetText(brokenASCII + " No Client Connected")
-			}
+			ui.connectionStatus.SetText(status)
+			ui.logoView.SetText(banner)
 		})
 		showEmoji = !showEmoji
 	}
 }
 
-func acceptConnections(connState *ConnectionState, logManager *LogManager, updateLogSections func(string)) {
-	ln, err := net.Listen("tcp", serverPort)
+// demoLogs are what -demo cycles through, one every demoInterval
+var demoLogs = []struct{ level, msg string }{
+	{"INFO", "Server started"},
+	{"INFO", "User alice logged in"},
+	{"WARNING", "Cache miss rate above 20%"},
+	{"INFO", "Processed 128 requests"},
+	{"ERROR", "Database connection lost"},
+	{"WARNING", "Retrying database connection"},
+	{"INFO", "Database connection restored"},
+	{"INFO", "User alice logged out"},
+}
+
+// startClient runs the client binary headless against addr, as a dev and
+// testing convenience, and returns a func that stops it. A bare name is
+// looked for next to this binary before PATH.
+func startClient(bin, addr string) (func(), error) {
+	path := bin
+	if !strings.ContainsRune(bin, filepath.Separator) {
+		path = ""
+		if exe, err := os.Executable(); err == nil {
+			if local := filepath.Join(filepath.Dir(exe), bin); fileExists(local) {
+				path = local
+			}
+		}
+		if path == "" {
+			found, err := exec.LookPath(bin)
+			if err != nil {
+				return nil, fmt.Errorf("client binary %q not found; build it with go build ./Ui4/Client", bin)
+			}
+			path = found
+		}
+	}
+
+	cmd := exec.Command(path, "-headless", "-addr", addr)
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}, nil
+}
+
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
+
+func runDemo(server *logger.Server) {
+	ticker := time.NewTicker(demoInterval)
+	defer ticker.Stop()
+	for i := 0; ; i++ {
+		log := demoLogs[i%len(demoLogs)]
+		server.InjectLog(log.level, log.msg)
+		<-ticker.C
+	}
+}
+
+func acceptViewers(addr string, viewerHub *ViewerHub, logManager *logger.LogManager, backlog int) {
+	ln, err := net.Listen("tcp", addr)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to start server: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Failed to start viewer endpoint: %v\n", err)
 		return
 	}
 	defer ln.Close()
@@ -221,55 +1595,433 @@ func acceptConnections(connState *ConnectionState, logManager *LogManager, updat
 	for {
 		conn, err := ln.Accept()
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Error accepting connection: %v\n", err)
+			fmt.Fprintf(os.Stderr, "Error accepting viewer: %v\n", err)
 			continue
 		}
-
-		connState.mu.Lock()
-		if connState.conn != nil {
-			connState.conn.Close()
-		}
-		connState.conn = conn
-		connState.alive = true
-		connState.lastHeartbeat = time.Now()
-		connState.mu.Unlock()
-
-		go handleClient(conn, connState, logManager, updateLogSections)
+		go handleViewer(conn, viewerHub, logManager, backlog)
 	}
 }
 
-func handleClient(conn net.Conn, connState *ConnectionState, logManager *LogManager, updateLogSections func(string)) {
+// handleViewer registers a viewer once its first message arrives, so a
+// framing handshake is applied before any log is streamed to it. The
+// last backlog logs are replayed first so the viewer starts with context.
+func handleViewer(conn net.Conn, viewerHub *ViewerHub, logManager *logger.LogManager, backlog int) {
 	defer func() {
-		connState.mu.Lock()
+		viewerHub.unregister(conn)
 		conn.Close()
-		connState.alive = false
-		connState.mu.Unlock()
 	}()
 
-	scanner := bufio.NewScanner(conn)
+	framer := logger.NewFramer()
+	scanner := logger.NewScanner(conn, framer)
+	registered := false
 	for scanner.Scan() {
-		message := scanner.Text()
-		if message == heartbeat {
-			connState.mu.Lock()
-			connState.alive = true
-			connState.lastHeartbeat = time.Now()
-			connState.mu.Unlock()
+		if framing, ok := logger.ParseFramingRequest(scanner.Text()); ok {
+			framer.SetFraming(framing)
+		}
+		if !registered {
+			if err := viewerHub.register(conn, framer.Framing(), logManager, backlog); err != nil {
+				return
+			}
+			registered = true
+		}
+	}
+}
+
+// note is one of the operator's annotations
+type note struct {
+	at   time.Time
+	text string
+}
+
+func (n note) String() string {
+	return fmt.Sprintf("%s NOTE: %s", logger.FormatTimestamp(n.at, false), n.text)
+}
+
+// mergeNotes places each note before the first log stamped later than it,
+// so an export reads as one timeline. Logs without a usable timestamp
+// stay where they are.
+func mergeNotes(logs []string, notes []note) []string {
+	merged := make([]string, 0, len(logs)+len(notes))
+	next := 0
+	for _, log := range logs {
+		ts, _ := splitTimestamp(log)
+		if at, ok := logger.ParseTimestamp(ts); ok {
+			for next < len(notes) && notes[next].at.Before(at) {
+				merged = append(merged, notes[next].String())
+				next++
+			}
+		}
+		merged = append(merged, log)
+	}
+	for _, n := range notes[next:] {
+		merged = append(merged, n.String())
+	}
+	return merged
+}
+
+// screenText reads the screen back as plain text, one line per row with
+// trailing blanks trimmed.
+func screenText(screen tcell.Screen) string {
+	width, height := screen.Size()
+	lines := make([]string, height)
+	for y := 0; y < height; y++ {
+		var line strings.Builder
+		for x := 0; x < width; {
+			mainc, combc, _, cells := screen.GetContent(x, y)
+			if mainc == 0 {
+				mainc = ' '
+			}
+			line.WriteRune(mainc)
+			for _, c := range combc {
+				line.WriteRune(c)
+			}
+			x += max(cells, 1)
+		}
+		lines[y] = strings.TrimRight(line.String(), " ")
+	}
+	return strings.TrimRight(strings.Join(lines, "\n"), "\n") + "\n"
+}
+
+// splitTimestamp separates a recognised leading timestamp from the rest
+// of the log. Logs without one return an empty timestamp.
+func splitTimestamp(log string) (string, string) {
+	loc := timestampPattern.FindStringSubmatchIndex(log)
+	if loc == nil {
+		return "", log
+	}
+	return log[loc[2]:loc[3]], log[loc[1]:]
+}
+
+// LogFields are the parts of a log a -template can refer to. Source is
+// the sending client's tag as the server wrote it, such as "<worker>".
+type LogFields struct {
+	Timestamp string
+	Level     string
+	Source    string
+	Message   string
+}
+
+// parseLogFields splits a raw log into its timestamp, the client's tag,
+// a leading "LEVEL:" token and the message.
+func parseLogFields(log string) LogFields {
+	var fields LogFields
+	fields.Timestamp, fields.Message = splitTimestamp(log)
+	if match := sourcePattern.FindStringSubmatch(fields.Message); match != nil {
+		fields.Source = match[1]
+		fields.Message = fields.Message[len(match[0]):]
+	}
+	if match := levelPattern.FindStringSubmatch(fields.Message); match != nil {
+		fields.Level = match[1]
+		fields.Message = fields.Message[len(match[0]):]
+	}
+	return fields
+}
+
+// parseLogTemplate parses text and checks it renders, so a bad -template
+// is reported at startup rather than on the first log.
+func parseLogTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("log").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	if err := tmpl.Execute(io.Discard, LogFields{}); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// RenderOptions control how renderLogs lays logs out
+type RenderOptions struct {
+	Template *template.Template
+	// Highlight marks matches of this query, read as by
+	// logger.CompileSearch, ignoring case unless CaseSensitive
+	Highlight     string
+	CaseSensitive bool
+	// HideTimestamps leaves the timestamp out of the rendered text; the
+	// stored log keeps it
+	HideTimestamps bool
+	// UTC shows timestamps in UTC rather than local time
+	UTC bool
+	// Reverse draws the newest log first
+	Reverse bool
+	// Dim, when set, reports which logs, by index, to draw dimmed
+	Dim func(i int) bool
+	// Rules recategorize logs, changing their color and shown level
+	Rules logger.LevelRules
+	// Palette colors each level and may mark it with a symbol
+	Palette logger.LevelPalette
+	// Instance, when set, is shown in front of every log
+	Instance string
+	// Smart colors HTTP status codes by class and durations of at least
+	// Slow red, over the level color
+	Smart bool
+	Slow  time.Duration
+	// Regions tags each drawn line as a region named by its position on
+	// screen, "0" for the top one, so lines can be highlighted
+	Regions bool
+	// Fade, when set, darkens logs by how long before Now they were
+	// stamped, reaching the dimmest at Fade old
+	Fade time.Duration
+	Now  time.Time
+}
+
+// renderLogs lays logs out through the template, with the timestamp
+// padded to the widest one shown so messages line up in a column. Logs
+// without a timestamp leave the column blank.
+func renderLogs(logs []string, opts RenderOptions) string {
+	fields := make([]LogFields, len(logs))
+	fade := make([]int, len(logs))
+	width := 0
+	for i, log := range logs {
+		fields[i] = parseLogFields(log)
+		if t, ok := logger.ParseTimestamp(fields[i].Timestamp); ok && opts.Fade > 0 {
+			fade[i] = int(min(fadeSteps, fadeSteps*opts.Now.Sub(t)/opts.Fade))
+		}
+		if rule, ok := opts.Rules.Match(log); ok && fields[i].Level != "" {
+			fields[i].Level = rule.Level
+		}
+		if opts.HideTimestamps {
+			fields[i].Timestamp = ""
+		} else if fields[i].Timestamp != "" {
+			fields[i].Timestamp = logger.ConvertTimestamp(fields[i].Timestamp, opts.UTC)
+		}
+		width = max(width, len(fields[i].Timestamp))
+	}
+
+	var highlight *regexp.Regexp
+	if opts.Highlight != "" {
+		highlight, _ = logger.CompileSearch(opts.Highlight, opts.CaseSensitive)
+	}
+
+	lines := make([]string, len(logs))
+	var line strings.Builder
+	for i, log := range logs {
+		if width > 0 {
+			fields[i].Timestamp = fmt.Sprintf("%-*s", width, fields[i].Timestamp)
+		}
+		text := log
+		line.Reset()
+		if err := opts.Template.Execute(&line, fields[i]); err == nil {
+			text = line.String()
+		}
+		level := opts.Rules.Level(log)
+		color := fadeColor(opts.Palette.Color(level), fade[i])
+		if opts.Smart {
+			text = smartColors(text, opts.Slow, color, highlight)
+		} else {
+			text = logger.HighlightMatches(text, highlight, color)
+		}
+		lines[i] = colorize(tview.Escape(opts.Palette.Symbol(level))+text, color)
+		if opts.Instance != "" {
+			lines[i] = "[gray]" + tview.Escape("["+opts.Instance+"]") + "[white] " + lines[i]
+		}
+		if opts.Dim != nil && opts.Dim(i) {
+			lines[i] = "[::d]" + lines[i] + "[::-]"
+		}
+	}
+	if opts.Reverse {
+		slices.Reverse(lines)
+	}
+	if opts.Regions {
+		for i := range lines {
+			lines[i] = fmt.Sprintf(`["%d"]%s[""]`, i, lines[i])
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// smartColors escapes text for tview, coloring HTTP status codes by class
+// and durations of at least slow red, then going back to color. A number
+// inside an address or a time, like 10.0.200.1 or 12:500, is left alone.
+// Matches of highlight are marked as HighlightMatches does, over any
+// status code or duration they overlap.
+func smartColors(text string, slow time.Duration, color string, highlight *regexp.Regexp) string {
+	restore := "[-]"
+	if color != "" {
+		restore = "[" + color + "]"
+	}
+
+	type token struct {
+		start, end int
+		tag        string
+		restore    string
+	}
+	var marks []token
+	if highlight != nil {
+		unmark := "[-:-]"
+		if color != "" {
+			unmark = "[" + color + ":-]"
+		}
+		for _, m := range highlight.FindAllStringIndex(text, -1) {
+			if m[0] < m[1] {
+				marks = append(marks, token{m[0], m[1], "[black:yellow]", unmark})
+			}
+		}
+	}
+	marked := func(start, end int) bool {
+		return slices.ContainsFunc(marks, func(t token) bool { return start < t.end && t.start < end })
+	}
+	tokens := marks
+	for _, m := range statusPattern.FindAllStringIndex(text, -1) {
+		if m[0] > 0 && strings.ContainsRune(".:", rune(text[m[0]-1])) ||
+			m[1] < len(text) && strings.ContainsRune(".:", rune(text[m[1]])) || marked(m[0], m[1]) {
+			continue
+		}
+		tokens = append(tokens, token{m[0], m[1], "[" + map[byte]string{'2': "green", '4': "yellow", '5': "red"}[text[m[0]]] + "]", restore})
+	}
+	for _, m := range durationPattern.FindAllStringIndex(text, -1) {
+		if d, err := time.ParseDuration(text[m[0]:m[1]]); err == nil && d >= slow && !marked(m[0], m[1]) {
+			tokens = append(tokens, token{m[0], m[1], "[red]", restore})
+		}
+	}
+	slices.SortFunc(tokens, func(a, b token) int { return a.start - b.start })
+
+	var b strings.Builder
+	last := 0
+	for _, t := range tokens {
+		if t.start < last {
 			continue
 		}
-		logManager.AddLog(colorizeLog(message))
-		updateLogSections("")
+		b.WriteString(tview.Escape(text[last:t.start]))
+		b.WriteString(t.tag)
+		b.WriteString(tview.Escape(text[t.start:t.end]))
+		b.WriteString(t.restore)
+		last = t.end
 	}
+	b.WriteString(tview.Escape(text[last:]))
+	return b.String()
 }
 
-func colorizeLog(log string) string {
-	switch {
-	case strings.Contains(log, "INFO"):
-		return fmt.Sprintf("[green]%s[white]", log)
-	case strings.Contains(log, "WARNING"):
-		return fmt.Sprintf("[yellow]%s[white]", log)
-	case strings.Contains(log, "ERROR"):
-		return fmt.Sprintf("[red]%s[white]", log)
-	default:
-		return log
+// fuzzyScore reports whether every character of pattern appears in text
+// in order, ignoring case, and scores how well: characters that follow
+// each other or start a word score more, gaps between them cost.
+func fuzzyScore(pattern, text string) (int, bool) {
+	pattern = strings.ToLower(pattern)
+	runes := []rune(strings.ToLower(text))
+	score, last := 0, -1
+	i := 0
+	for _, p := range pattern {
+		for i < len(runes) && runes[i] != p {
+			i++
+		}
+		if i == len(runes) {
+			return 0, false
+		}
+		switch {
+		case i == last+1:
+			score += 3
+		case i == 0 || !unicode.IsLetter(runes[i-1]) && !unicode.IsDigit(runes[i-1]):
+			score += 2
+		default:
+			score -= min(i-last-1, 3)
+		}
+		score++
+		last = i
+		i++
+	}
+	return score, true
+}
+
+// fadeColor darkens color, white when it is "", by step of fadeSteps
+// towards fadeFloor.
+func fadeColor(color string, step int) string {
+	if step <= 0 {
+		return color
+	}
+	base := tcell.ColorWhite
+	if color != "" {
+		base = tcell.GetColor(color)
+	}
+	r, g, b := base.RGB()
+	k := 1 - (1-fadeFloor)*float64(step)/fadeSteps
+	return fmt.Sprintf("#%02x%02x%02x", int(float64(r)*k), int(float64(g)*k), int(float64(b)*k))
+}
+
+// levelLegend shows each level in the color palette gives it
+func levelLegend(palette logger.LevelPalette) string {
+	entries := make([]string, len(logger.Levels))
+	for i, level := range logger.Levels {
+		entries[i] = colorize("■ "+tview.Escape(palette.Symbol(level))+level, palette.Color(level))
+	}
+	return "Levels: " + strings.Join(entries, "  ")
+}
+
+func colorize(text, color string) string {
+	if color == "" {
+		return text
+	}
+	return fmt.Sprintf("[%s]%s[white]", color, text)
+}
+
+type diffOp int
+
+const (
+	diffSame diffOp = iota
+	diffRemoved
+	diffAdded
+)
+
+type diffLine struct {
+	op   diffOp
+	text string
+}
+
+// diffLines computes a line diff from a to b using their longest common
+// subsequence.
+func diffLines(a, b []string) []diffLine {
+	// lcs[i][j] is the LCS length of a[i:] and b[j:]
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var lines []diffLine
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			lines = append(lines, diffLine{diffSame, a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			lines = append(lines, diffLine{diffRemoved, a[i]})
+			i++
+		default:
+			lines = append(lines, diffLine{diffAdded, b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		lines = append(lines, diffLine{diffRemoved, a[i]})
+	}
+	for ; j < len(b); j++ {
+		lines = append(lines, diffLine{diffAdded, b[j]})
+	}
+	return lines
+}
+
+// renderDiff renders a unified diff, removals in red and additions in green
+func renderDiff(lines []diffLine) string {
+	out := make([]string, len(lines))
+	for i, line := range lines {
+		text := tview.Escape(line.text)
+		switch line.op {
+		case diffRemoved:
+			out[i] = colorize("- "+text, "red")
+		case diffAdded:
+			out[i] = colorize("+ "+text, "green")
+		default:
+			out[i] = "  " + text
+		}
 	}
+	return strings.Join(out, "\n")
 }
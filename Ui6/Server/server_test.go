@@ -0,0 +1,573 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"text/template"
+	"time"
+
+	"TerminalUI/logger"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+// within fails the test unless f returns before timeout.
+func within(t *testing.T, timeout time.Duration, what string, f func()) {
+	t.Helper()
+	done := make(chan struct{})
+	go func() {
+		f()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		t.Fatalf("timed out: %s", what)
+	}
+}
+
+func TestEventLoopGateBeforeRun(t *testing.T) {
+	app := tview.NewApplication().SetScreen(tcell.NewSimulationScreen("UTF-8"))
+	app.SetRoot(tview.NewBox(), true)
+	gate := NewEventLoopGate(app)
+
+	// Far more than fit in tview's update queue, as a -replay would inject
+	var early atomic.Int32
+	within(t, time.Second, "queueing updates before Run", func() {
+		for i := 0; i < 1000; i++ {
+			gate.QueueUpdateDraw(func() { early.Add(1) })
+		}
+	})
+
+	opened := make(chan struct{})
+	gate.Open(func() { close(opened) })
+	stopped := make(chan error)
+	go func() { stopped <- app.Run() }()
+	within(t, time.Second, "the first update", func() { <-opened })
+	if n := early.Load(); n != 0 {
+		t.Errorf("%d updates queued before Run were run, want them dropped", n)
+	}
+
+	ran := make(chan struct{})
+	within(t, time.Second, "an update once running", func() {
+		gate.QueueUpdateDraw(func() { close(ran) })
+		<-ran
+	})
+	app.Stop()
+	within(t, time.Second, "Run to return", func() {
+		if err := <-stopped; err != nil {
+			t.Errorf("Run: %v", err)
+		}
+	})
+}
+
+// render renders logs with the default template and palette, after
+// setup adjusts the options.
+func render(t *testing.T, logs []string, setup func(opts *RenderOptions)) string {
+	t.Helper()
+	tmpl, err := parseLogTemplate(defaultLogTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := RenderOptions{Template: tmpl, Palette: logger.LevelPalettes[0]}
+	if setup != nil {
+		setup(&opts)
+	}
+	return renderLogs(logs, opts)
+}
+
+func TestRenderLogs(t *testing.T) {
+	tests := []struct {
+		name  string
+		logs  []string
+		setup func(opts *RenderOptions)
+		want  []string
+	}{
+		{
+			name: "timestamps line up",
+			logs: []string{"2024-01-01 10:00:00 INFO: started", "10:00:01 WARNING: slow", "no timestamp"},
+			want: []string{
+				"[green]2024-01-01 10:00:00  INFO: started[white]",
+				"[yellow]10:00:01             WARNING: slow[white]",
+				"                     no timestamp",
+			},
+		},
+		{
+			name: "no timestamps",
+			logs: []string{"ERROR: disk full", "plain"},
+			want: []string{"[red]ERROR: disk full[white]", "plain"},
+		},
+		{
+			name: "custom template",
+			logs: []string{"2024-01-01 10:00:00 ERROR: disk full", "plain"},
+			setup: func(opts *RenderOptions) {
+				opts.Template = template.Must(template.New("log").Parse("{{.Level}}|{{.Message}}|{{.Timestamp}}"))
+			},
+			want: []string{"[red]ERROR|disk full|2024-01-01 10:00:00[white]", "|plain|                   "},
+		},
+		{
+			name: "source",
+			logs: []string{"2024-01-01 10:00:00 <worker> ERROR: disk full", "[127.0.0.1:51234] plain"},
+			setup: func(opts *RenderOptions) {
+				opts.Template = template.Must(template.New("log").Parse("{{.Source}}|{{.Level}}|{{.Message}}"))
+			},
+			want: []string{"[red]<worker>|ERROR|disk full[white]", "[127.0.0.1:51234[]||plain"},
+		},
+		{
+			name: "source with the default template",
+			logs: []string{"2024-01-01 10:00:00 <worker> ERROR: disk full"},
+			want: []string{"[red]2024-01-01 10:00:00  <worker> ERROR: disk full[white]"},
+		},
+		{
+			name:  "newest first",
+			logs:  []string{"INFO: first", "ERROR: second", "third"},
+			setup: func(opts *RenderOptions) { opts.Reverse = true },
+			want:  []string{"third", "[red]ERROR: second[white]", "[green]INFO: first[white]"},
+		},
+		{
+			name:  "in UTC",
+			logs:  []string{"2024-01-01T10:00:00+02:00 INFO: started"},
+			setup: func(opts *RenderOptions) { opts.UTC = true },
+			want:  []string{"[green]2024-01-01 08:00:00Z  INFO: started[white]"},
+		},
+		{
+			name:  "level rules",
+			logs:  []string{"INFO: deprecated flag", "deprecated, no level"},
+			setup: func(opts *RenderOptions) { opts.Rules = logger.LevelRules{{Match: "deprecated", Level: "WARNING"}} },
+			want:  []string{"[yellow]WARNING: deprecated flag[white]", "[yellow]deprecated, no level[white]"},
+		},
+		{
+			name: "escaped",
+			logs: []string{"INFO: got [red] back"},
+			want: []string{"[green]INFO: got [red[] back[white]"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := render(t, tt.logs, tt.setup); got != strings.Join(tt.want, "\n") {
+				t.Errorf("renderLogs(%q) =\n%s\nwant\n%s", tt.logs, got, strings.Join(tt.want, "\n"))
+			}
+		})
+	}
+}
+
+func TestParseLogFields(t *testing.T) {
+	tests := []struct {
+		log  string
+		want LogFields
+	}{
+		{"2024-01-01 10:00:00 INFO: started", LogFields{Timestamp: "2024-01-01 10:00:00", Level: "INFO", Message: "started"}},
+		{"2024-01-01T10:00:00.123Z WARNING:slow", LogFields{Timestamp: "2024-01-01T10:00:00.123Z", Level: "WARNING", Message: "slow"}},
+		{"10:00:00 ERROR: disk full", LogFields{Timestamp: "10:00:00", Level: "ERROR", Message: "disk full"}},
+		{"plain output", LogFields{Message: "plain output"}},
+		{"an ERROR: mid-line", LogFields{Message: "an ERROR: mid-line"}},
+		{"2024-01-01 10:00:00 <worker@host1> ERROR: disk full", LogFields{Timestamp: "2024-01-01 10:00:00", Level: "ERROR", Source: "<worker@host1>", Message: "disk full"}},
+		{"[127.0.0.1:51234] INFO: started", LogFields{Level: "INFO", Source: "[127.0.0.1:51234]", Message: "started"}},
+		{"[[::1]:51234] started", LogFields{Source: "[[::1]:51234]", Message: "started"}},
+		{"[INFO] started", LogFields{Message: "[INFO] started"}},
+	}
+	for _, tt := range tests {
+		if got := parseLogFields(tt.log); got != tt.want {
+			t.Errorf("parseLogFields(%q) = %+v, want %+v", tt.log, got, tt.want)
+		}
+	}
+}
+
+func TestParseLogTemplate(t *testing.T) {
+	tests := []struct {
+		text string
+		ok   bool
+	}{
+		{defaultLogTemplate, true},
+		{"{{.Source}} {{.Message}}", true},
+		{"{{.Message", false},
+		{"{{.Host}}", false},
+	}
+	for _, tt := range tests {
+		if _, err := parseLogTemplate(tt.text); (err == nil) != tt.ok {
+			t.Errorf("parseLogTemplate(%q) error = %v, want ok %v", tt.text, err, tt.ok)
+		}
+	}
+}
+
+func TestViewerHubBacklog(t *testing.T) {
+	tests := []struct {
+		name    string
+		backlog int
+		want    []string
+	}{
+		{"none", 0, []string{"live"}},
+		{"last two", 2, []string{"INFO: 2", "INFO: 3", "live"}},
+		{"more than kept", 10, []string{"INFO: 1", "INFO: 2", "INFO: 3", "live"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logManager := logger.NewLogManager(0)
+			for i := 1; i <= 3; i++ {
+				logManager.AddLog(fmt.Sprintf("INFO: %d", i))
+			}
+			hub := NewViewerHub()
+			server, viewer := net.Pipe()
+			defer viewer.Close()
+
+			read := make(chan []string)
+			go func() {
+				var lines []string
+				scanner := bufio.NewScanner(viewer)
+				for len(lines) < len(tt.want) && scanner.Scan() {
+					lines = append(lines, scanner.Text())
+				}
+				read <- lines
+			}()
+			if err := hub.register(server, logger.LineFraming, logManager, tt.backlog); err != nil {
+				t.Fatalf("register: %v", err)
+			}
+			hub.Broadcast("live")
+			select {
+			case got := <-read:
+				if !slices.Equal(got, tt.want) {
+					t.Errorf("viewer read %q, want %q", got, tt.want)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("timed out reading the viewer")
+			}
+		})
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []string
+		want []string // each line marked " ", "-" or "+"
+	}{
+		{"same", []string{"x", "y"}, []string{"x", "y"}, []string{" x", " y"}},
+		{"both empty", nil, nil, nil},
+		{"all added", nil, []string{"x"}, []string{"+x"}},
+		{"all removed", []string{"x"}, nil, []string{"-x"}},
+		{"changed middle", []string{"a", "b", "c"}, []string{"a", "B", "c"}, []string{" a", "-b", "+B", " c"}},
+		{"inserted", []string{"a", "c"}, []string{"a", "b", "c"}, []string{" a", "+b", " c"}},
+		{"reordered", []string{"a", "b"}, []string{"b", "a"}, []string{"-a", " b", "+a"}},
+	}
+	marks := map[diffOp]string{diffSame: " ", diffRemoved: "-", diffAdded: "+"}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, line := range diffLines(tt.a, tt.b) {
+				got = append(got, marks[line.op]+line.text)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("diffLines(%q, %q) = %q, want %q", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderDiff(t *testing.T) {
+	lines := []diffLine{{diffSame, "a"}, {diffRemoved, "[b]"}, {diffAdded, "c"}}
+	want := "  a\n[red]- [b[][white]\n[green]+ c[white]"
+	if got := renderDiff(lines); got != want {
+		t.Errorf("renderDiff() = %q, want %q", got, want)
+	}
+}
+
+// fakeClock is a logger.Clock that only moves when told to.
+type fakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func TestRedrawThrottle(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)}
+	var redraws, floods atomic.Int32
+	rt := NewRedrawThrottle(func() { redraws.Add(1) }, func() { floods.Add(1) }, clock)
+
+	// Up to floodRate a second each log redraws
+	for i := 0; i < floodRate; i++ {
+		rt.Log()
+	}
+	if rt.Flooding() || redraws.Load() != floodRate || floods.Load() != 0 {
+		t.Fatalf("at floodRate: flooding %v, %d redraws, %d floods, want false, %d, 0", rt.Flooding(), redraws.Load(), floods.Load(), floodRate)
+	}
+
+	// One more starts a flood, reported once, and stops per-log redraws
+	for i := 0; i < 50; i++ {
+		rt.Log()
+	}
+	if !rt.Flooding() || floods.Load() != 1 {
+		t.Fatalf("past floodRate: flooding %v, %d floods, want true, 1", rt.Flooding(), floods.Load())
+	}
+	if got := redraws.Load(); got > floodRate+1 {
+		t.Errorf("%d redraws during the flood, want at most the periodic one", got-floodRate)
+	}
+
+	// A quiet second ends it
+	clock.Advance(2 * time.Second)
+	before := redraws.Load()
+	rt.Log()
+	if rt.Flooding() {
+		t.Error("still flooding after a quiet second")
+	}
+	if redraws.Load() == before {
+		t.Error("no redraw for a log after the flood ended")
+	}
+}
+
+func TestFuzzyScore(t *testing.T) {
+	matches := []struct {
+		pattern, text string
+		ok            bool
+	}{
+		{"err", "ERROR: disk full", true},
+		{"dfl", "disk full", true},
+		{"", "anything", true},
+		{"lluf", "disk full", false},
+		{"x", "disk full", false},
+	}
+	for _, tt := range matches {
+		if _, ok := fuzzyScore(tt.pattern, tt.text); ok != tt.ok {
+			t.Errorf("fuzzyScore(%q, %q) matched %v, want %v", tt.pattern, tt.text, ok, tt.ok)
+		}
+	}
+
+	// Each pair's first text should score higher for the pattern
+	better := []struct {
+		pattern, higher, lower string
+	}{
+		{"disk", "disk full", "d-i-s-k full"},
+		{"full", "disk full", "diskfull"},
+		{"df", "disk full", "adfoo"},
+		{"err", "error", "e r r"},
+	}
+	for _, tt := range better {
+		high, _ := fuzzyScore(tt.pattern, tt.higher)
+		low, _ := fuzzyScore(tt.pattern, tt.lower)
+		if high <= low {
+			t.Errorf("fuzzyScore(%q): %q scored %d, not above %q's %d", tt.pattern, tt.higher, high, tt.lower, low)
+		}
+	}
+}
+
+func TestLayoutGridKeepsStatus(t *testing.T) {
+	const width, height = 80, 24
+	tests := []struct {
+		name    string
+		notes   bool
+		compact bool
+		row     int // the status's row, counting from the bottom
+	}{
+		{"bordered", false, false, 6},
+		{"bordered with notes", true, false, 6},
+		{"compact", false, true, 2},
+		{"compact with notes", true, true, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			screen := tcell.NewSimulationScreen("UTF-8")
+			if err := screen.Init(); err != nil {
+				t.Fatal(err)
+			}
+			defer screen.Fini()
+			screen.SetSize(width, height)
+
+			ui := CreateUIComponents()
+			for i := 0; i < 200; i++ {
+				fmt.Fprintf(ui.infoLogsView, "INFO: log %d\n", i)
+			}
+			ui.connectionStatus.SetText(strings.Repeat("status ", 40))
+			var notes tview.Primitive
+			if tt.notes {
+				notes = tview.NewTextView().SetText(strings.Repeat("note\n", 50))
+			}
+			ui.layoutGrid(notes, tt.compact)
+			ui.grid.SetRect(0, 0, width, height)
+			ui.grid.Draw(screen)
+			screen.Show()
+
+			lines := strings.Split(screenText(screen), "\n")
+			var rows []int
+			for i, line := range lines {
+				if strings.Contains(line, "status status") {
+					rows = append(rows, i)
+				}
+			}
+			if want := height - tt.row; len(rows) != 1 || rows[0] != want {
+				t.Errorf("status on rows %v, want just %d:\n%s", rows, want, strings.Join(lines, "\n"))
+			}
+		})
+	}
+}
+
+func TestMergeNotes(t *testing.T) {
+	at := func(hms string) time.Time {
+		ts, _ := logger.ParseTimestamp("2024-01-01 " + hms)
+		return ts
+	}
+	first := note{at("10:00:30"), "first"}
+	second := note{at("10:01:30"), "second"}
+	tests := []struct {
+		name  string
+		logs  []string
+		notes []note
+		want  []string
+	}{
+		{
+			"between logs",
+			[]string{"2024-01-01 10:00:00 INFO: a", "2024-01-01 10:01:00 INFO: b", "2024-01-01 10:02:00 INFO: c"},
+			[]note{first, second},
+			[]string{"2024-01-01 10:00:00 INFO: a", first.String(), "2024-01-01 10:01:00 INFO: b", second.String(), "2024-01-01 10:02:00 INFO: c"},
+		},
+		{
+			"after the last log",
+			[]string{"2024-01-01 10:00:00 INFO: a"},
+			[]note{first, second},
+			[]string{"2024-01-01 10:00:00 INFO: a", first.String(), second.String()},
+		},
+		{
+			"logs without timestamps stay put",
+			[]string{"INFO: a", "2024-01-01 10:01:00 INFO: b", "10:02:00 INFO: c"},
+			[]note{first, second},
+			[]string{"INFO: a", first.String(), "2024-01-01 10:01:00 INFO: b", "10:02:00 INFO: c", second.String()},
+		},
+		{
+			"no notes",
+			[]string{"INFO: a"},
+			nil,
+			[]string{"INFO: a"},
+		},
+	}
+	for _, tt := range tests {
+		if got := mergeNotes(tt.logs, tt.notes); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: mergeNotes = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSmartColors(t *testing.T) {
+	tests := []struct {
+		name      string
+		text      string
+		color     string
+		highlight string
+		want      string
+	}{
+		{"status classes", "200 404 503", "", "", "[green]200[-] [yellow]404[-] [red]503[-]"},
+		{"back to color", "GET /x 500", "red", "", "GET /x [red]500[red]"},
+		{"slow only", "took 2s, then 10ms", "", "", "took [red]2s[-], then 10ms"},
+		{"addresses and times", "10.0.200.1 at 12:500", "", "", "10.0.200.1 at 12:500"},
+		{"not a status", "1500 2000 600", "", "", "1500 2000 600"},
+		{"escaped", "[a] 200", "", "", "[a[] [green]200[-]"},
+		{"highlight", "GET /x 500 in 2s", "", "x", "GET /[black:yellow]x[-:-] [red]500[-] in [red]2s[-]"},
+		{"highlight over a status", "GET /x 500 in 2s [a]", "red", "500 in", "GET /x [black:yellow]500 in[red:-] [red]2s[red] [a[]"},
+		{"highlight inside a duration", "took 3250ms", "", "25", "took 3[black:yellow]25[-:-]0ms"},
+	}
+	for _, tt := range tests {
+		var highlight *regexp.Regexp
+		if tt.highlight != "" {
+			highlight = regexp.MustCompile(regexp.QuoteMeta(tt.highlight))
+		}
+		if got := smartColors(tt.text, time.Second, tt.color, highlight); got != tt.want {
+			t.Errorf("%s: smartColors(%q) = %q, want %q", tt.name, tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestStatusWebhook(t *testing.T) {
+	posts := make(chan statusPayload, 16)
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload statusPayload
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil || r.Method != http.MethodPost {
+			t.Errorf("%s with %v, want a POST of a status", r.Method, err)
+		}
+		posts <- payload
+	}))
+	defer endpoint.Close()
+
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)}
+	sw := NewStatusWebhook(endpoint.URL, "node-1", clock, func(err error) { t.Errorf("post failed: %v", err) })
+	steps := []struct {
+		what      string
+		advance   time.Duration
+		connected bool
+	}{
+		{"connects", 0, true},
+		{"not yet held", webhookDebounce / 2, true},
+		{"blips", webhookDebounce / 2, false},
+		{"back, so the wait restarts", 0, true},
+		{"still not held", webhookDebounce - time.Millisecond, true},
+		{"held", time.Millisecond, true}, // posts connected
+		{"drops", time.Second, false},
+		{"stays down", webhookDebounce, false}, // posts disconnected
+		{"stays down after posting", webhookDebounce, false},
+	}
+	for _, step := range steps {
+		clock.Advance(step.advance)
+		sw.Observe(step.connected)
+	}
+
+	start := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	want := []statusPayload{
+		{Connected: true, Instance: "node-1", Time: start.Add(2 * webhookDebounce)},
+		{Connected: false, Instance: "node-1", Time: start.Add(3*webhookDebounce + time.Second)},
+	}
+	for _, w := range want {
+		select {
+		case got := <-posts:
+			if got.Connected != w.Connected || got.Instance != w.Instance || !got.Time.Equal(w.Time) {
+				t.Errorf("posted %+v, want %+v", got, w)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for %+v", w)
+		}
+	}
+	select {
+	case got := <-posts:
+		t.Errorf("posted %+v after the changes", got)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestStatusWebhookError(t *testing.T) {
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer endpoint.Close()
+
+	clock := &fakeClock{now: time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)}
+	errs := make(chan error, 1)
+	sw := NewStatusWebhook(endpoint.URL, "", clock, func(err error) { errs <- err })
+	sw.Observe(true)
+	clock.Advance(webhookDebounce)
+	sw.Observe(true)
+	select {
+	case err := <-errs:
+		if !strings.Contains(err.Error(), "503") {
+			t.Errorf("error %q, want the endpoint's status", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no error for a post the endpoint refused")
+	}
+}
@@ -1,76 +1,66 @@
 package main
 
 import (
-	"bufio"
+	"context"
+	"flag"
 	"fmt"
-	"net"
 	"os"
+	"os/signal"
+	"regexp"
 	"strings"
-	"sync"
+	"syscall"
 	"time"
 
+	"TerminalUI/logger"
+
 	"github.com/gdamore/tcell/v2"
 	"github.com/rivo/tview"
 )
 
 const (
-	aliveASCII  = "🟢"
-	brokenASCII = "🔴"
-	heartbeat   = "_HEARTBEAT_"
+	// Below this width the four panes are too narrow to read
+	narrowWidth = 120
 )
 
-type clientState struct {
-	isAlive       bool
-	lastHeartbeat time.Time
-}
-
-type logManager struct {
-	mu   sync.Mutex
-	logs []string
-}
-
-func (lm *logManager) AddLog(log string) {
-	lm.mu.Lock()
-	defer lm.mu.Unlock()
-	lm.logs = append(lm.logs, log)
-}
-
-func (lm *logManager) GetFilteredLogs(filter string) []string {
-	lm.mu.Lock()
-	defer lm.mu.Unlock()
-	if filter == "ALL" {
-		return append([]string(nil), lm.logs...)
+func main() {
+	layout := flag.String("layout", "auto", "pane layout: auto, single or multi")
+	port := flag.String("port", logger.DefaultPort(), "port to listen for clients on; defaults to $LOGGER_PORT, else 8080")
+	heartbeatTimeout := flag.Duration("heartbeat-timeout", logger.DefaultHeartbeatTimeout, "how long a client may go without a heartbeat before it shows as disconnected; keep it at least twice the client's -heartbeat-interval")
+	tlsCert := flag.String("tls-cert", "", "PEM certificate to accept clients over TLS with, along with -tls-key; plain TCP without")
+	tlsKey := flag.String("tls-key", "", "PEM private key for -tls-cert")
+	metricsAddr := flag.String("metrics-addr", "", "address, such as :9100, to serve Prometheus metrics at /metrics on; none without")
+	tagClients := flag.Bool("tag-clients", false, "tag each log with the address of the client that sent it, to tell several clients apart")
+	ascii := flag.Bool("ascii", false, "show the connection status as [UP]/[DOWN] instead of emoji")
+	flag.Parse()
+	icons := logger.EmojiIcons
+	if *ascii {
+		icons = logger.ASCIIIcons
 	}
-	filteredLogs := []string{}
-	for _, log := range lm.logs {
-		if strings.Contains(strings.ToUpper(log), strings.ToUpper(filter)) {
-			filteredLogs = append(filteredLogs, log)
-		}
+	if *layout != "auto" && *layout != "single" && *layout != "multi" {
+		fmt.Fprintf(os.Stderr, "Invalid -layout %q, want auto, single or multi\n", *layout)
+		os.Exit(1)
 	}
-	return filteredLogs
-}
-
-func (lm *logManager) GetSearchFilteredLogs(query string) []string {
-	lm.mu.Lock()
-	defer lm.mu.Unlock()
-	if query == "" {
-		return append([]string(nil), lm.logs...)
+	addr, err := logger.ListenAddr(*port)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid -port: %v\n", err)
+		os.Exit(1)
 	}
-	filteredLogs := []string{}
-	for _, log := range lm.logs {
-		if strings.Contains(strings.ToLower(log), strings.ToLower(query)) {
-			filteredLogs = append(filteredLogs, log)
-		}
+	if *heartbeatTimeout <= 0 {
+		fmt.Fprintf(os.Stderr, "Invalid -heartbeat-timeout %v, want a positive duration\n", *heartbeatTimeout)
+		os.Exit(1)
+	}
+	tlsConfig, err := logger.LoadServerTLS(*tlsCert, *tlsKey)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid -tls-cert or -tls-key: %v\n", err)
+		os.Exit(1)
 	}
-	return filteredLogs
-}
 
-func main() {
 	app := tview.NewApplication()
-	var clientConn net.Conn
-	var clientAlive bool
-	var lastHeartbeat time.Time
-	var connMutex sync.Mutex
+	server := logger.NewServer(addr)
+	server.SetHeartbeatTimeout(*heartbeatTimeout)
+	server.SetTLSConfig(tlsConfig)
+	server.SetMetricsAddr(*metricsAddr)
+	server.SetClientPrefix(*tagClients)
 
 	app.EnableMouse(true)
 
@@ -116,30 +106,65 @@ func main() {
 
 	footer := tview.NewTextView().
 		SetTextAlign(tview.AlignCenter).
-		SetDynamicColors(true).
-		SetText("Press '/' to focus Search Bar, 'Q' to Quit")
+		SetDynamicColors(true)
 
 	searchBar := tview.NewInputField().
 		SetLabel("Search: ").
 		SetFieldWidth(30).
 		SetPlaceholder("Type here to filter logs...")
 
-	logManager := &logManager{}
+	logManager := server.Logs()
 
-	// Main grid layout
+	// Main grid layout, either the four panes side by side or, on narrow
+	// terminals, just the all-logs pane
 	grid := tview.NewGrid().
-		SetRows(1, 1, 0, 1, 1).
-		SetColumns(0, 0, 0, 0).
 		SetBorders(true)
 
-	grid.AddItem(logoView, 0, 0, 1, 4, 0, 0, false).
-		AddItem(searchBar, 1, 0, 1, 4, 0, 0, false).
-		AddItem(allLogsView, 2, 0, 1, 1, 0, 0, false).
-		AddItem(infoLogsView, 2, 1, 1, 1, 0, 0, false).
-		AddItem(warningLogsView, 2, 2, 1, 1, 0, 0, false).
-		AddItem(errorLogsView, 2, 3, 1, 1, 0, 0, false).
-		AddItem(connectionStatus, 3, 0, 1, 4, 0, 0, false).
-		AddItem(footer, 4, 0, 1, 4, 0, 0, false)
+	multiPane := false
+	setLayout := func(multi bool) {
+		multiPane = multi
+		columns := 1
+		grid.Clear()
+		if multi {
+			columns = 4
+			grid.SetRows(1, 1, 0, 1, 1).SetColumns(0, 0, 0, 0)
+			grid.AddItem(allLogsView, 2, 0, 1, 1, 0, 0, false).
+				AddItem(infoLogsView, 2, 1, 1, 1, 0, 0, false).
+				AddItem(warningLogsView, 2, 2, 1, 1, 0, 0, false).
+				AddItem(errorLogsView, 2, 3, 1, 1, 0, 0, false)
+		} else {
+			grid.SetRows(1, 1, 0, 1, 1).SetColumns(0)
+			grid.AddItem(allLogsView, 2, 0, 1, 1, 0, 0, false)
+		}
+		grid.AddItem(logoView, 0, 0, 1, columns, 0, 0, false).
+			AddItem(searchBar, 1, 0, 1, columns, 0, 0, false).
+			AddItem(connectionStatus, 3, 0, 1, columns, 0, 0, false).
+			AddItem(footer, 4, 0, 1, columns, 0, 0, false)
+	}
+	updateFooter := func() {
+		footer.SetText(fmt.Sprintf("Press '/' to focus Search Bar, 'L' Layout ([yellow]%s[white]), 'X' Clear, 'Q' to Quit", *layout))
+	}
+	setLayout(*layout == "multi")
+	updateFooter()
+
+	// Pick the layout from the screen width on every draw, so resizes
+	// are followed unless the user has fixed the layout
+	app.SetBeforeDrawFunc(func(screen tcell.Screen) bool {
+		if *layout == "auto" {
+			width, _ := screen.Size()
+			if multi := width >= narrowWidth; multi != multiPane {
+				setLayout(multi)
+			}
+		}
+		return false
+	})
+
+	// 'L' steps through auto → multi → single → auto
+	nextLayout := map[string]string{
+		"auto":   "multi",
+		"multi":  "single",
+		"single": "auto",
+	}
 
 	// Monitor client connection status with blinking emoji
 	// Monitor client connection status with blinking emoji
@@ -147,66 +172,67 @@ func main() {
 		ticker := time.NewTicker(500 * time.Millisecond)
 		showEmoji := true
 		for range ticker.C {
-			connMutex.Lock()
-			if clientConn != nil && time.Since(lastHeartbeat) > 3*time.Second {
-				clientAlive = false
-			}
-			isConnected := clientConn != nil && clientAlive
-			connMutex.Unlock()
+			clients := server.ConnectedClients()
+			names := server.ConnectedNames()
+			status := logger.ClientsText(clients, names...)
 
 			app.QueueUpdateDraw(func() {
-				if isConnected {
-					if showEmoji {
-						connectionStatus.SetText("Client Connected")
-					} else {
-						connectionStatus.SetText(aliveASCII + " Client Connected")
-					}
+				if clients > 0 {
+					connectionStatus.SetText(tview.Escape(icons.Line(true, showEmoji, status)))
 				} else {
-					connectionStatus.SetText(brokenASCII + " No Client Connected")
+					connectionStatus.SetText(tview.Escape(icons.Line(false, false, status)))
 				}
 			})
 			showEmoji = !showEmoji
 		}
 	}()
 
+	// Refresh every pane as logs arrive
+	refreshPanes := func() {
+		allLogsView.SetText(colorizeLogs(logManager.GetFilteredLogs("ALL"), nil))
+		infoLogsView.SetText(colorizeLogs(logManager.GetFilteredLogs("INFO"), nil))
+		warningLogsView.SetText(colorizeLogs(logManager.GetFilteredLogs("WARNING"), nil))
+		errorLogsView.SetText(colorizeLogs(logManager.GetFilteredLogs("ERROR"), nil))
+	}
+	server.OnLog(func(string) {
+		app.QueueUpdateDraw(refreshPanes)
+	})
+
 	// Start server
-	ln, err := net.Listen("tcp", ":8080")
-	if err != nil {
+	// SIGINT and SIGTERM quit as 'Q' does, so the server is still shut
+	// down cleanly on the way out
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	context.AfterFunc(ctx, app.Stop)
+	if err := server.Start(ctx); err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to start server: %v\n", err)
 		return
 	}
-	defer ln.Close()
-
-	// Accept client connections
-	go func() {
-		for {
-			conn, err := ln.Accept()
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Error accepting connection: %v\n", err)
-				continue
-			}
-
-			connMutex.Lock()
-			if clientConn != nil {
-				clientConn.Close()
-			}
-			clientConn = conn
-			// clientAlive = true
-			lastHeartbeat = time.Now()
-			connMutex.Unlock()
-
-			go handleClient(conn, logManager, &connMutex, &clientAlive, &lastHeartbeat, allLogsView, infoLogsView, warningLogsView, errorLogsView, app)
-		}
-	}()
+	defer server.Stop()
 
 	// Handle keyboard inputs
 	app.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		// Let the search bar have every key typed into it
+		if searchBar.HasFocus() {
+			return event
+		}
 		switch event.Key() {
 		case tcell.KeyRune:
 			switch event.Rune() {
 			case '/':
 				app.SetFocus(searchBar)
 				return nil
+			case 'l', 'L':
+				*layout = nextLayout[*layout]
+				if *layout != "auto" {
+					setLayout(*layout == "multi")
+				}
+				updateFooter()
+				return nil
+			case 'x', 'X':
+				logManager.Clear()
+				refreshPanes()
+				return nil
 			case 'q', 'Q':
 				app.Stop()
 				return nil
@@ -216,9 +242,13 @@ func main() {
 	})
 
 	// Search bar functionality
+	searchBar.SetDoneFunc(func(key tcell.Key) {
+		app.SetFocus(allLogsView)
+	})
 	searchBar.SetChangedFunc(func(query string) {
-		filteredLogs := logManager.GetSearchFilteredLogs(query)
-		allLogsView.SetText(strings.Join(filteredLogs, "\n"))
+		filteredLogs := logManager.GetSearchFilteredLogs(query, "ALL")
+		highlight, _ := logManager.CompileSearch(query)
+		allLogsView.SetText(colorizeLogs(filteredLogs, highlight))
 	})
 
 	if err := app.SetRoot(grid, true).Run(); err != nil {
@@ -226,49 +256,32 @@ func main() {
 	}
 }
 
-func handleClient(
-	conn net.Conn,
-	logManager *logManager,	connMutex *sync.Mutex,
-	clientAlive *bool,	lastHeartbeat *time.Time,
-	allLogsView, infoLogsView, warningLogsView, errorLogsView *tview.TextView,
-	app *tview.Application,
-) {
-	defer func() {
-		connMutex.Lock()
-		conn.Close()
-		*clientAlive = false
-		connMutex.Unlock()
-	}()
-
-	scanner := bufio.NewScanner(conn)
-	for scanner.Scan() {
-		message := scanner.Text()
-
-		if message == heartbeat {
-			connMutex.Lock()
-			*clientAlive = true
-			*lastHeartbeat = time.Now()
-			connMutex.Unlock()
-			continue
-		}
-
-		logManager.AddLog(colorizeLog(message))
-		app.QueueUpdateDraw(func() {
-			allLogsView.SetText(strings.Join(logManager.GetFilteredLogs("ALL"), "\n"))
-			infoLogsView.SetText(strings.Join(logManager.GetFilteredLogs("INFO"), "\n"))
-			warningLogsView.SetText(strings.Join(logManager.GetFilteredLogs("WARNING"), "\n"))
-			errorLogsView.SetText(strings.Join(logManager.GetFilteredLogs("ERROR"), "\n"))
-		})
+// colorizeLog colors log by level, escaped for tview, marking matches of
+// highlight in it when there is one
+func colorizeLog(log string, highlight *regexp.Regexp) string {
+	level, _, _ := logger.ParseLogLine(log)
+	var color, open, close string
+	switch level {
+	case "INFO":
+		color, open, close = "green", "[green]", "[white]"
+	case "WARNING":
+		color, open, close = "yellow", "[yellow]", "[white]"
+	case "ERROR":
+		color, open, close = "red", "[red]", "[white]"
+	case "DEBUG":
+		color, open, close = "gray", "[gray]", "[white]"
+	case "TRACE":
+		color, open, close = "gray", "[gray::d]", "[white::-]"
 	}
+	return open + logger.HighlightMatches(log, highlight, color) + close
 }
 
-func colorizeLog(log string) string {
-	if strings.Contains(log, "INFO") {
-		return fmt.Sprintf("[green]%s[white]", log)
-	} else if strings.Contains(log, "WARNING") {
-		return fmt.Sprintf("[yellow]%s[white]", log)
-	} else if strings.Contains(log, "ERROR") {
-		return fmt.Sprintf("[red]%s[white]", log)
+// colorizeLogs renders stored logs one per line, colored by level, with
+// matches of highlight marked
+func colorizeLogs(logs []string, highlight *regexp.Regexp) string {
+	colored := make([]string, len(logs))
+	for i, log := range logs {
+		colored[i] = colorizeLog(log, highlight)
 	}
-	return log
+	return strings.Join(colored, "\n")
 }
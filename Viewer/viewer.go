@@ -0,0 +1,182 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"TerminalUI/logger"
+
+	"github.com/gdamore/tcell/v2"
+	"github.com/rivo/tview"
+)
+
+const logLimit = 1000
+
+// logManager keeps the most recent logLimit logs, dropping older ones so a
+// viewer left tailing doesn't grow without bound.
+type logManager struct {
+	mu   sync.Mutex
+	logs []string
+}
+
+func (lm *logManager) AddLog(log string) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	lm.logs = append(lm.logs, log)
+	if over := len(lm.logs) - logLimit; over > 0 {
+		// Clear the dropped logs so they can be freed before append next
+		// moves the window to a new array
+		clear(lm.logs[:over])
+		lm.logs = lm.logs[over:]
+	}
+}
+
+func (lm *logManager) GetLogs(limit int) []string {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	if len(lm.logs) > limit {
+		return append([]string(nil), lm.logs[len(lm.logs)-limit:]...)
+	}
+	return append([]string(nil), lm.logs...)
+}
+
+func main() {
+	servers := flag.String("servers", "localhost:8081", "comma-separated viewer endpoints of the servers to tail")
+	framed := flag.Bool("framed", false, "use length-prefixed framing so messages may contain newlines; same as -framing length")
+	framingName := flag.String("framing", "line", "message framing: line, length, or nul for NUL-terminated records")
+	ascii := flag.Bool("ascii", false, "show connection status as [UP]/[DOWN] instead of emoji")
+	flag.Parse()
+
+	framing, err := logger.ParseFraming(*framingName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid -framing: %v\n", err)
+		os.Exit(1)
+	}
+	if *framed {
+		framing = logger.LengthFraming
+	}
+	icons := logger.EmojiIcons
+	if *ascii {
+		icons = logger.ASCIIIcons
+	}
+
+	var addrs []string
+	for _, addr := range strings.Split(*servers, ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			addrs = append(addrs, addr)
+		}
+	}
+	if len(addrs) == 0 {
+		fmt.Fprintln(os.Stderr, "No servers given, use -servers host:port,...")
+		os.Exit(1)
+	}
+
+	app := tview.NewApplication()
+
+	// UI Components
+	logoView := tview.NewTextView().
+		SetTextAlign(tview.AlignCenter).
+		SetDynamicColors(true).
+		SetText("[yellow]LOG VIEWER[white]")
+
+	logsView := tview.NewTextView().
+		SetDynamicColors(true).
+		SetScrollable(true)
+
+	connectionStatus := tview.NewTextView().
+		SetTextAlign(tview.AlignCenter).
+		SetDynamicColors(true)
+
+	footer := tview.NewTextView().
+		SetTextAlign(tview.AlignCenter).
+		SetDynamicColors(true).
+		SetText("Press 'Q' (Quit)")
+
+	grid := tview.NewGrid().
+		SetRows(1, 0, 1, 1).
+		SetColumns(0).
+		SetBorders(true)
+
+	grid.AddItem(logoView, 0, 0, 1, 1, 0, 0, false).
+		AddItem(logsView, 1, 0, 1, 1, 0, 0, true).
+		AddItem(connectionStatus, 2, 0, 1, 1, 0, 0, false).
+		AddItem(footer, 3, 0, 1, 1, 0, 0, false)
+
+	logManager := &logManager{}
+
+	// One reconnecting client per server, each tagging logs with its source
+	// in that source's own color
+	sourceColors := logger.NewSourceColors()
+	clients := make([]*logger.Client, len(addrs))
+	for i, addr := range addrs {
+		source := colorize(tview.Escape("["+addr+"]"), sourceColors.Color(addr))
+		client := logger.NewClient(addr, framing)
+		client.SetHandshake(logger.ViewerHello)
+		client.SetMessageFunc(func(msg string) {
+			logManager.AddLog(fmt.Sprintf("%s %s", source, colorizeLog(msg)))
+			app.QueueUpdateDraw(func() {
+				logsView.SetText(strings.Join(logManager.GetLogs(logLimit), "\n"))
+				logsView.ScrollToEnd()
+			})
+		})
+		client.Start()
+		defer client.Stop()
+		clients[i] = client
+	}
+
+	// Per-server connection status
+	go func() {
+		ticker := time.NewTicker(500 * time.Millisecond)
+		for range ticker.C {
+			statuses := make([]string, len(clients))
+			for i, client := range clients {
+				statuses[i] = tview.Escape(icons.Line(client.Connected(), false, client.Addr()))
+			}
+			app.QueueUpdateDraw(func() {
+				connectionStatus.SetText(strings.Join(statuses, " | "))
+			})
+		}
+	}()
+
+	app.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch event.Rune() {
+		case 'q', 'Q':
+			app.Stop()
+			return nil
+		}
+		return event
+	})
+
+	if err := app.SetRoot(grid, true).Run(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error running app: %v\n", err)
+	}
+}
+
+// colorizeLog escapes log and colors it by level, so markup in a remote
+// message can't restyle the view.
+func colorizeLog(log string) string {
+	level, _, _ := logger.ParseLogLine(log)
+	log = tview.Escape(log)
+	switch level {
+	case "INFO":
+		return fmt.Sprintf("[green]%s[white]", log)
+	case "WARNING":
+		return fmt.Sprintf("[yellow]%s[white]", log)
+	case "ERROR":
+		return fmt.Sprintf("[red]%s[white]", log)
+	case "DEBUG":
+		return fmt.Sprintf("[gray]%s[white]", log)
+	case "TRACE":
+		return fmt.Sprintf("[gray::d]%s[white::-]", log)
+	default:
+		return log
+	}
+}
+
+func colorize(text, color string) string {
+	return fmt.Sprintf("[%s]%s[white]", color, text)
+}
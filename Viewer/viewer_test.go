@@ -0,0 +1,33 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestLogManagerLimit(t *testing.T) {
+	lm := &logManager{}
+	for i := 0; i < logLimit+10; i++ {
+		lm.AddLog(fmt.Sprint(i))
+	}
+	logs := lm.GetLogs(logLimit * 2)
+	if len(logs) != logLimit || logs[0] != "10" || logs[len(logs)-1] != fmt.Sprint(logLimit+9) {
+		t.Errorf("kept %d logs from %s to %s, want the last %d", len(logs), logs[0], logs[len(logs)-1], logLimit)
+	}
+}
+
+func TestColorizeLog(t *testing.T) {
+	tests := []struct {
+		log  string
+		want string
+	}{
+		{"ERROR: disk full", "[red]ERROR: disk full[white]"},
+		{"INFO: [red]not red[::b]", "[green]INFO: [red[]not red[::b[][white]"},
+		{"plain [yellow]", "plain [yellow[]"},
+	}
+	for _, tt := range tests {
+		if got := colorizeLog(tt.log); got != tt.want {
+			t.Errorf("colorizeLog(%q) = %q, want %q", tt.log, got, tt.want)
+		}
+	}
+}
@@ -3,23 +3,180 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
 	"strings"
+	"sync"
+	"syscall"
 	"time"
 
 	"github.com/gdamore/tcell/v2"
 	"github.com/rivo/tview"
 )
 
+// Defaults for the flags below, which $HLF_NETWORK_SCRIPT and the like
+// override in turn
 const (
 	NETWORK_SCRIPT = "/home/fabric-samples/test-network/network.sh"
 	CHAINCODE_NAME = "basic"
 	CHAINCODE_PATH = "../asset-transfer-basic/chaincode-go"
 	CHAINCODE_LANG = "go"
+	CHANNEL_NAME   = "mychannel"
 )
 
+// envOr returns the environment variable key, or def when it is unset.
+func envOr(key, def string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return def
+}
+
+// checkScript returns why path can't be run as the network script, or
+// nil if it can.
+func checkScript(path string) error {
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%s is a directory", path)
+	}
+	if info.Mode()&0111 == 0 {
+		return fmt.Errorf("%s is not executable", path)
+	}
+	return nil
+}
+
+// containerFilters are the docker ps name filters the log dropdown finds
+// containers by: peers, orderers and fabric-ca servers.
+var containerFilters = []string{"peer", "orderer", "ca_"}
+
+// errCancelled is why a command cancelled from the Cancel button or
+// Ctrl-C stopped, as opposed to a follow being replaced or turned off.
+var errCancelled = errors.New("cancelled by user")
+
+// listContainers returns the names of the running Fabric containers,
+// sorted by label, so each org's peers and CA are listed together.
+func listContainers() ([]string, error) {
+	args := []string{"ps", "--format", "{{.Names}}"}
+	for _, filter := range containerFilters {
+		args = append(args, "--filter", "name="+filter)
+	}
+	output, err := exec.Command("docker", args...).Output()
+	if err != nil {
+		return nil, err
+	}
+	names := strings.Fields(string(output))
+	slices.SortFunc(names, func(a, b string) int {
+		return strings.Compare(containerLabel(a), containerLabel(b))
+	})
+	return names, nil
+}
+
+var (
+	// peerName matches a peer container's name, such as
+	// peer0.org1.example.com, capturing the peer and its org
+	peerName = regexp.MustCompile(`^(peer\d+)\.(\w+)\.`)
+	// caName matches a fabric-ca container's name, such as ca_org1
+	caName = regexp.MustCompile(`^ca_(\w+)$`)
+)
+
+// capitalize upper-cases the first letter of s.
+func capitalize(s string) string {
+	if s == "" {
+		return s
+	}
+	return strings.ToUpper(s[:1]) + s[1:]
+}
+
+// containerLabel names a container for the log dropdown: "Org1 Peer0" for
+// peer0.org1.example.com, "Org1 CA" for ca_org1, "Orderer" for
+// orderer.example.com, and anything else by its own name.
+func containerLabel(name string) string {
+	if m := peerName.FindStringSubmatch(name); m != nil {
+		return capitalize(m[2]) + " " + capitalize(m[1])
+	}
+	if m := caName.FindStringSubmatch(name); m != nil {
+		return capitalize(m[1]) + " CA"
+	}
+	if name == "orderer.example.com" {
+		return "Orderer"
+	}
+	return name
+}
+
+// peerCommand returns a peer CLI command run as Org1's admin against the
+// test network in testNetwork, set up the way the network's own scripts
+// do. The peer binary from fabric-samples/bin is used when there is one.
+func peerCommand(ctx context.Context, testNetwork string, args ...string) *exec.Cmd {
+	peer := filepath.Join(testNetwork, "..", "bin", "peer")
+	if _, err := os.Stat(peer); err != nil {
+		peer = "peer"
+	}
+	org1 := filepath.Join(testNetwork, "organizations", "peerOrganizations", "org1.example.com")
+	cmd := exec.CommandContext(ctx, peer, args...)
+	cmd.Dir = testNetwork
+	cmd.Env = append(os.Environ(),
+		"FABRIC_CFG_PATH="+filepath.Join(testNetwork, "..", "config"),
+		"CORE_PEER_TLS_ENABLED=true",
+		"CORE_PEER_LOCALMSPID=Org1MSP",
+		"CORE_PEER_TLS_ROOTCERT_FILE="+filepath.Join(org1, "peers", "peer0.org1.example.com", "tls", "ca.crt"),
+		"CORE_PEER_MSPCONFIGPATH="+filepath.Join(org1, "users", "Admin@org1.example.com", "msp"),
+		"CORE_PEER_ADDRESS=localhost:7051")
+	return cmd
+}
+
+// chaincodeArgs returns the peer arguments to invoke or query function
+// with args on the chaincode name in channel. An invoke is endorsed by
+// both organizations' peers and ordered, as the test network requires.
+func chaincodeArgs(testNetwork, mode, channel, name, function string, args []string) []string {
+	ctor, _ := json.Marshal(struct {
+		Function string   `json:"function"`
+		Args     []string `json:"Args"`
+	}{function, args})
+	if mode == "query" {
+		return []string{"chaincode", "query", "-C", channel, "-n", name, "-c", string(ctor)}
+	}
+	orgs := filepath.Join(testNetwork, "organizations")
+	return []string{"chaincode", "invoke",
+		"-o", "localhost:7050", "--ordererTLSHostnameOverride", "orderer.example.com",
+		"--tls", "--cafile", filepath.Join(orgs, "ordererOrganizations", "example.com", "orderers", "orderer.example.com", "msp", "tlscacerts", "tlsca.example.com-cert.pem"),
+		"-C", channel, "-n", name,
+		"--peerAddresses", "localhost:7051", "--tlsRootCertFiles", filepath.Join(orgs, "peerOrganizations", "org1.example.com", "peers", "peer0.org1.example.com", "tls", "ca.crt"),
+		"--peerAddresses", "localhost:9051", "--tlsRootCertFiles", filepath.Join(orgs, "peerOrganizations", "org2.example.com", "peers", "peer0.org2.example.com", "tls", "ca.crt"),
+		"-c", string(ctor)}
+}
+
+// splitArgs splits comma-separated chaincode arguments, trimming each;
+// none for a blank line.
+func splitArgs(line string) []string {
+	if strings.TrimSpace(line) == "" {
+		return []string{}
+	}
+	args := strings.Split(line, ",")
+	for i := range args {
+		args[i] = strings.TrimSpace(args[i])
+	}
+	return args
+}
+
 func main() {
+	networkScript := flag.String("network-script", envOr("HLF_NETWORK_SCRIPT", NETWORK_SCRIPT), "fabric-samples test-network script, run from its own directory; defaults to $HLF_NETWORK_SCRIPT")
+	chaincodeName := flag.String("chaincode-name", envOr("HLF_CHAINCODE_NAME", CHAINCODE_NAME), "name to deploy the chaincode as; defaults to $HLF_CHAINCODE_NAME")
+	chaincodePath := flag.String("chaincode-path", envOr("HLF_CHAINCODE_PATH", CHAINCODE_PATH), "chaincode source, relative to the network script's directory; defaults to $HLF_CHAINCODE_PATH")
+	chaincodeLang := flag.String("chaincode-lang", envOr("HLF_CHAINCODE_LANG", CHAINCODE_LANG), "language of the chaincode; defaults to $HLF_CHAINCODE_LANG")
+	channel := flag.String("channel", envOr("HLF_CHANNEL", CHANNEL_NAME), "channel to create, deploy on and invoke or query the chaincode in; defaults to $HLF_CHANNEL")
+	flag.Parse()
+
 	app := tview.NewApplication()
 
 	// Create main layout
@@ -85,7 +242,7 @@ func main() {
 	helpView.SetBorder(true).SetTitle("[::u]Help & Instructions").SetBorderColor(tcell.ColorYellow)
 
 	// Instruction message
-	helpMessage := `[yellow]Instructions: [white]Use [lime]Tab[white] to switch focus, [lime]Enter[white] to execute, and [lime]Esc[white] to exit. Commands: [lime]Up[white]=Start Network, [lime]Down[white]=Stop Network, [lime]Deploy[white]=Deploy Chaincode, [lime]Clear[white]=Logs. Logs: [lime]Green[white]=Success, [red]Red[white]=Error, [yellow]Yellow[white]=Info.`
+	helpMessage := `[yellow]Instructions: [white]Use [lime]Tab[white] to switch focus, [lime]Enter[white] to execute, and [lime]Esc[white] to exit. Commands: [lime]Up[white]=Start Network, [lime]Down[white]=Stop Network, [lime]Deploy[white]=Deploy Chaincode, [lime]Invoke[white]/[lime]Query[white]=Call Chaincode (args comma-separated), [lime]Follow[white]=Stream Container Logs Live, [lime]Cancel[white]/[lime]Ctrl-C[white]=Stop Running Command or Follow, [lime]Clear[white]=Logs. Logs: [lime]Green[white]=Success, [red]Red[white]=Error, [yellow]Yellow[white]=Info.`
 	paddingWidth := 50
 	paddedMessage := fmt.Sprintf("%s%s", helpMessage, strings.Repeat(" ", paddingWidth))
 
@@ -133,10 +290,43 @@ func main() {
 		logView.ScrollToEnd()
 	}
 
-	// Function to execute a command and append output to logs
-	executeCommand := func(args ...string) {
-		cmd := exec.Command(NETWORK_SCRIPT, args...)
-		cmd.Dir = "/home/fabric-samples/test-network"
+	// Commands running, by the cancel func of each one's context
+	var runningMu sync.Mutex
+	running := map[*context.CancelCauseFunc]bool{}
+
+	// Function to cancel every running command, returning how many
+	cancelCommands := func() int {
+		runningMu.Lock()
+		defer runningMu.Unlock()
+		for cancel := range running {
+			(*cancel)(errCancelled)
+		}
+		return len(running)
+	}
+
+	// Function to run the command newCmd makes and stream its output to
+	// logs, stdout and stderr lines under the given log types, until it
+	// ends or parent is done. It is run in a process group of its own,
+	// all of which cancelling kills, so the scripts network.sh starts
+	// stop with it. When parent is done the caller says why.
+	streamCommand := func(parent context.Context, newCmd func(ctx context.Context) *exec.Cmd, outType, errType string) {
+		ctx, cancel := context.WithCancelCause(parent)
+		runningMu.Lock()
+		running[&cancel] = true
+		runningMu.Unlock()
+		defer func() {
+			runningMu.Lock()
+			delete(running, &cancel)
+			runningMu.Unlock()
+			cancel(nil)
+		}()
+
+		cmd := newCmd(ctx)
+		cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+		cmd.Cancel = func() error {
+			return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		}
+		cmd.WaitDelay = 2 * time.Second
 
 		stdoutPipe, err := cmd.StdoutPipe()
 		if err != nil {
@@ -150,7 +340,7 @@ func main() {
 			return
 		}
 
-		appendLog(fmt.Sprintf("Executing: %s %s", NETWORK_SCRIPT, strings.Join(args, " ")), "system")
+		appendLog(fmt.Sprintf("Executing: %s", strings.Join(cmd.Args, " ")), "system")
 
 		// Start the command
 		if err := cmd.Start(); err != nil {
@@ -189,13 +379,13 @@ func main() {
 					if !ok {
 						stdoutChan = nil
 					} else {
-						appendLog(line, "info")
+						appendLog(line, outType)
 					}
 				case line, ok := <-stderrChan:
 					if !ok {
 						stderrChan = nil
 					} else {
-						appendLog(line, "error")
+						appendLog(line, errType)
 					}
 				}
 
@@ -210,27 +400,40 @@ func main() {
 		<-done
 
 		// Wait for the command to finish
-		if err := cmd.Wait(); err != nil {
+		if err := cmd.Wait(); errors.Is(context.Cause(ctx), errCancelled) {
+			appendLog("Command cancelled by user", "error")
+		} else if parent.Err() != nil {
+			return
+		} else if err != nil {
 			appendLog(fmt.Sprintf("Command finished with error: %v", err), "error")
 		} else {
 			appendLog("Command completed successfully", "success")
 		}
 	}
 
-	// Improved fetchPeerLogs function
-	fetchPeerLogs := func(peerName string) {
-		appendLog(fmt.Sprintf("Fetching logs for peer: %s", peerName), "peer")
+	// Function to execute the network script and append output to logs
+	executeCommand := func(args ...string) {
+		streamCommand(context.Background(), func(ctx context.Context) *exec.Cmd {
+			cmd := exec.CommandContext(ctx, *networkScript, args...)
+			cmd.Dir = filepath.Dir(*networkScript)
+			return cmd
+		}, "info", "error")
+	}
+
+	// Function to fetch a peer, orderer or CA container's logs
+	fetchContainerLogs := func(containerName string) {
+		appendLog(fmt.Sprintf("Fetching logs for container: %s", containerName), "peer")
 
 		// Check if container exists and is running
-		checkCmd := exec.Command("docker", "ps", "--format", "{{.Names}}", "--filter", fmt.Sprintf("name=%s", peerName))
+		checkCmd := exec.Command("docker", "ps", "--format", "{{.Names}}", "--filter", fmt.Sprintf("name=%s", containerName))
 		checkOutput, err := checkCmd.CombinedOutput()
 		if err != nil || len(checkOutput) == 0 {
-			appendLog(fmt.Sprintf("Error: Peer container %s is not running", peerName), "error")
+			appendLog(fmt.Sprintf("Error: Container %s is not running", containerName), "error")
 			return
 		}
 
 		// Execute docker logs command with proper parameters
-		cmd := exec.Command("docker", "logs", "--tail", "1000", "--timestamps", peerName)
+		cmd := exec.Command("docker", "logs", "--tail", "1000", "--timestamps", containerName)
 
 		var outBuf, errBuf bytes.Buffer
 		cmd.Stdout = &outBuf
@@ -248,9 +451,9 @@ func main() {
 		// Process stdout logs
 		logs := outBuf.String()
 		if logs == "" {
-			appendLog(fmt.Sprintf("No stdout logs found for peer %s", peerName), "info")
+			appendLog(fmt.Sprintf("No stdout logs found for container %s", containerName), "info")
 		} else {
-			appendLog("Found logs for peer. Processing...", "info")
+			appendLog("Found logs for container. Processing...", "info")
 			logLines := strings.Split(logs, "\n")
 			for _, line := range logLines {
 				if strings.TrimSpace(line) != "" {
@@ -274,38 +477,122 @@ func main() {
 		appendLog("Finished fetching logs", "success")
 	}
 
-	// Define peer containers mapping
-	peerContainers := map[string]string{
-		"Org1 Peer0": "peer0.org1.example.com",
-		// "Org1 Peer1": "peer1.org1.example.com",
-		"Org2 Peer0": "peer0.org2.example.com",
-		// "Org2 Peer1": "peer1.org2.example.com",
+	// In follow mode a container's logs are streamed live, with docker
+	// logs -f, instead of fetched once; stopFollow ends the stream
+	following := false
+	var followMu sync.Mutex
+	stopFollow := func() {}
+	endFollow := func() {
+		followMu.Lock()
+		defer followMu.Unlock()
+		stopFollow()
+		stopFollow = func() {}
 	}
 
-	// Create peer options for dropdown
-	peerOptions := make([]string, 0, len(peerContainers))
-	for label := range peerContainers {
-		peerOptions = append(peerOptions, label)
+	// Function to stream a container's logs as it writes them, after its
+	// last 100 lines, ending any stream already running
+	followContainerLogs := func(containerName string) {
+		ctx, cancel := context.WithCancel(context.Background())
+		followMu.Lock()
+		stopFollow()
+		stopFollow = cancel
+		followMu.Unlock()
+		defer cancel()
+
+		appendLog(fmt.Sprintf("Following logs for container: %s", containerName), "peer")
+		streamCommand(ctx, func(ctx context.Context) *exec.Cmd {
+			return exec.CommandContext(ctx, "docker", "logs", "--follow", "--tail", "100", "--timestamps", containerName)
+		}, "peer", "error")
+		if ctx.Err() != nil {
+			appendLog(fmt.Sprintf("Stopped following %s", containerName), "system")
+		}
 	}
 
-	// Create improved dropdown for peer logs
-	peerDropdown := tview.NewDropDown().
-		SetLabel("Select Peer: ").
-		SetOptions(peerOptions, func(option string, index int) {
-			if containerName, ok := peerContainers[option]; ok {
-				logView.Clear()
-				appendLog(fmt.Sprintf("Selected peer: %s (%s)", option, containerName), "system")
-				go func() {
-					fetchPeerLogs(containerName)
-				}()
+	// Dropdown for container logs, listing the containers running
+	containerDropdown := tview.NewDropDown().
+		SetLabel("Select Container: ")
+	containerDropdown.SetBorder(true).SetTitle("Container Logs")
+	var containers []string
+	showContainerLogs := func(label, containerName string) {
+		logView.Clear()
+		appendLog(fmt.Sprintf("Selected container: %s (%s)", label, containerName), "system")
+		if following {
+			go followContainerLogs(containerName)
+			return
+		}
+		endFollow()
+		go func() {
+			fetchContainerLogs(containerName)
+		}()
+	}
+	selectContainer := func(label string, index int) {
+		showContainerLogs(label, containers[index])
+	}
+
+	// Function to relist the containers, keeping the one selected, so
+	// ones started since show up. docker ps runs in the background and
+	// the list is updated once it's done, one relisting at a time.
+	refreshing := false
+	setContainers := func(names []string) {
+		if slices.Equal(names, containers) {
+			return
+		}
+		selected := ""
+		if index, _ := containerDropdown.GetCurrentOption(); index >= 0 {
+			selected = containers[index]
+		}
+		containers = names
+		labels := make([]string, len(names))
+		for i, name := range names {
+			labels[i] = containerLabel(name)
+		}
+		containerDropdown.SetOptions(labels, nil)
+		if index := slices.Index(names, selected); index >= 0 {
+			containerDropdown.SetCurrentOption(index)
+		}
+		containerDropdown.SetSelectedFunc(selectContainer)
+	}
+	refreshContainers := func() {
+		if refreshing {
+			return
+		}
+		refreshing = true
+		go func() {
+			names, err := listContainers()
+			if err != nil {
+				appendLog(fmt.Sprintf("Error listing containers: %v", err), "error")
 			}
-		})
-	peerDropdown.SetBorder(true).SetTitle("Peer Logs")
+			app.QueueUpdateDraw(func() {
+				refreshing = false
+				if err == nil {
+					setContainers(names)
+				}
+			})
+		}()
+	}
+
+	// The containers are relisted as the dropdown opens, from one of the
+	// keys that open it or a click on it
+	containerDropdown.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch event.Key() {
+		case tcell.KeyEnter, tcell.KeyRune, tcell.KeyDown:
+			if !containerDropdown.IsOpen() {
+				refreshContainers()
+			}
+		}
+		return event
+	})
+	containerDropdown.SetMouseCapture(func(action tview.MouseAction, event *tcell.EventMouse) (tview.MouseAction, *tcell.EventMouse) {
+		if action == tview.MouseLeftDown && !containerDropdown.IsOpen() && containerDropdown.InRect(event.Position()) {
+			refreshContainers()
+		}
+		return action, event
+	})
 
 	// Create buttons
 	networkUpBtn := tview.NewButton("Network Up").
 		SetSelectedFunc(func() {
-			go executeCommand("up", "createChannel")
+			go executeCommand("up", "createChannel", "-c", *channel)
 		})
 
 	networkDownBtn := tview.NewButton("Network Down").
@@ -318,12 +605,65 @@ func main() {
 			go func() {
 				appendLog("Starting chaincode deployment process...", "chaincode")
 				executeCommand("deployCC",
-					"-ccn", CHAINCODE_NAME,
-					"-ccp", CHAINCODE_PATH,
-					"-ccl", CHAINCODE_LANG)
+					"-c", *channel,
+					"-ccn", *chaincodeName,
+					"-ccp", *chaincodePath,
+					"-ccl", *chaincodeLang)
 			}()
 		})
 
+	// Pages hold the main layout, and over it the chaincode form while it
+	// is open
+	pages := tview.NewPages()
+
+	// Function to prompt for a chaincode function and args, then invoke
+	// or query it
+	showChaincodeForm := func(mode string) {
+		form := tview.NewForm().
+			AddInputField("Function", "", 30, nil, nil).
+			AddInputField("Args", "", 30, nil, nil)
+		title := capitalize(mode)
+		closeForm := func() {
+			pages.RemovePage("chaincode")
+			app.SetFocus(buttonFlex)
+		}
+		form.AddButton(title, func() {
+			function := form.GetFormItemByLabel("Function").(*tview.InputField).GetText()
+			args := splitArgs(form.GetFormItemByLabel("Args").(*tview.InputField).GetText())
+			closeForm()
+			if function == "" {
+				appendLog("No chaincode function given", "error")
+				return
+			}
+			testNetwork := filepath.Dir(*networkScript)
+			go streamCommand(context.Background(), func(ctx context.Context) *exec.Cmd {
+				return peerCommand(ctx, testNetwork, chaincodeArgs(testNetwork, mode, *channel, *chaincodeName, function, args)...)
+			}, "chaincode", "chaincode")
+		})
+		form.AddButton("Cancel", closeForm)
+		form.SetCancelFunc(closeForm)
+		form.SetBorder(true).SetTitle(fmt.Sprintf("%s %s on %s", title, *chaincodeName, *channel))
+		modal := tview.NewFlex().
+			AddItem(nil, 0, 1, false).
+			AddItem(tview.NewFlex().SetDirection(tview.FlexRow).
+				AddItem(nil, 0, 1, false).
+				AddItem(form, 9, 0, true).
+				AddItem(nil, 0, 1, false), 50, 0, true).
+			AddItem(nil, 0, 1, false)
+		pages.AddPage("chaincode", modal, true, true)
+		app.SetFocus(form)
+	}
+
+	invokeBtn := tview.NewButton("Invoke").
+		SetSelectedFunc(func() {
+			showChaincodeForm("invoke")
+		})
+
+	queryBtn := tview.NewButton("Query").
+		SetSelectedFunc(func() {
+			showChaincodeForm("query")
+		})
+
 	fetchNetworkSpecs := func() string {
 		var specs strings.Builder
 		specs.WriteString("=== Network Specifications ===\n")
@@ -382,6 +722,27 @@ func main() {
 			}()
 		})
 
+	cancelBtn := tview.NewButton("Cancel").
+		SetSelectedFunc(func() {
+			if cancelCommands() == 0 {
+				appendLog("No command running", "system")
+			}
+		})
+
+	followBtn := tview.NewButton("Follow: Off")
+	followBtn.SetSelectedFunc(func() {
+		following = !following
+		if !following {
+			followBtn.SetLabel("Follow: Off")
+			endFollow()
+			return
+		}
+		followBtn.SetLabel("Follow: On")
+		if index, label := containerDropdown.GetCurrentOption(); index >= 0 {
+			showContainerLogs(label, containers[index])
+		}
+	})
+
 	clearLogsBtn := tview.NewButton("Clear Logs").
 		SetSelectedFunc(func() {
 			logBuffer = []string{} // Clear the log buffer
@@ -392,12 +753,16 @@ func main() {
 		// layout setup in the main function
 	searchPeerFlex := tview.NewFlex().SetDirection(tview.FlexColumn)
 	searchPeerFlex.AddItem(searchInput, 0, 1, true)
-	searchPeerFlex.AddItem(peerDropdown, 0, 1, false)
+	searchPeerFlex.AddItem(containerDropdown, 0, 1, false)
 
 	// buttons to the button panel
 	buttonFlex.AddItem(networkUpBtn, 0, 1, true)
 	buttonFlex.AddItem(networkDownBtn, 0, 1, true)
 	buttonFlex.AddItem(deployChaincodeBtn, 0, 1, true)
+	buttonFlex.AddItem(invokeBtn, 0, 1, true)
+	buttonFlex.AddItem(queryBtn, 0, 1, true)
+	buttonFlex.AddItem(followBtn, 0, 1, true)
+	buttonFlex.AddItem(cancelBtn, 0, 1, true)
 	buttonFlex.AddItem(clearLogsBtn, 0, 1, true)
 	buttonFlex.AddItem(networkInfoBtn, 0, 1, true)
 
@@ -408,14 +773,24 @@ func main() {
 	mainFlex.AddItem(helpView, 3, 1, false)
 	// Set up key bindings
 	app.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		// The chaincode form handles its own keys: Tab between fields and
+		// Esc to close it
+		if pages.HasPage("chaincode") {
+			return event
+		}
 		switch event.Key() {
 		case tcell.KeyEscape:
 			app.Stop()
 			return nil
+		case tcell.KeyCtrlC:
+			// Cancels a running command, and only quits with none
+			if cancelCommands() > 0 {
+				return nil
+			}
 		case tcell.KeyTab:
 			if buttonFlex.HasFocus() {
-				app.SetFocus(peerDropdown)
-			} else if peerDropdown.HasFocus() {
+				app.SetFocus(containerDropdown)
+			} else if containerDropdown.HasFocus() {
 				app.SetFocus(logView)
 			} else {
 				app.SetFocus(buttonFlex)
@@ -428,8 +803,13 @@ func main() {
 	// Initialize with welcome message
 	appendLog("Welcome to Hyperledger Fabric Test Network Control", "info")
 	appendLog("Application started - See help section below for instructions", "system")
+	refreshContainers()
+	if err := checkScript(*networkScript); err != nil {
+		appendLog(fmt.Sprintf("Network script unusable: %v. Set -network-script or HLF_NETWORK_SCRIPT to fabric-samples/test-network/network.sh", err), "error")
+	}
 
-	if err := app.SetRoot(mainFlex, true).EnableMouse(true).Run(); err != nil {
+	pages.AddPage("main", mainFlex, true, true)
+	if err := app.SetRoot(pages, true).EnableMouse(true).Run(); err != nil {
 		panic(err)
 	}
 }
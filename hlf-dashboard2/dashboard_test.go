@@ -0,0 +1,82 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		line string
+		want []string
+	}{
+		{"", []string{}},
+		{"   ", []string{}},
+		{"asset1", []string{"asset1"}},
+		{" asset1 , blue ,5", []string{"asset1", "blue", "5"}},
+		{"a,,b", []string{"a", "", "b"}},
+	}
+	for _, tt := range tests {
+		if got := splitArgs(tt.line); !slices.Equal(got, tt.want) {
+			t.Errorf("splitArgs(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestChaincodeArgs(t *testing.T) {
+	network := filepath.Join("fabric-samples", "test-network")
+	orgs := filepath.Join(network, "organizations")
+	tests := []struct {
+		name     string
+		mode     string
+		function string
+		args     []string
+		want     []string
+	}{
+		{
+			"query", "query", "ReadAsset", []string{"asset1"},
+			[]string{"chaincode", "query", "-C", "mychannel", "-n", "basic", "-c", `{"function":"ReadAsset","Args":["asset1"]}`},
+		},
+		{
+			"query without args", "query", "GetAllAssets", []string{},
+			[]string{"chaincode", "query", "-C", "mychannel", "-n", "basic", "-c", `{"function":"GetAllAssets","Args":[]}`},
+		},
+		{
+			"invoke", "invoke", "CreateAsset", []string{"asset7", `say "hi"`},
+			[]string{"chaincode", "invoke",
+				"-o", "localhost:7050", "--ordererTLSHostnameOverride", "orderer.example.com",
+				"--tls", "--cafile", filepath.Join(orgs, "ordererOrganizations", "example.com", "orderers", "orderer.example.com", "msp", "tlscacerts", "tlsca.example.com-cert.pem"),
+				"-C", "mychannel", "-n", "basic",
+				"--peerAddresses", "localhost:7051", "--tlsRootCertFiles", filepath.Join(orgs, "peerOrganizations", "org1.example.com", "peers", "peer0.org1.example.com", "tls", "ca.crt"),
+				"--peerAddresses", "localhost:9051", "--tlsRootCertFiles", filepath.Join(orgs, "peerOrganizations", "org2.example.com", "peers", "peer0.org2.example.com", "tls", "ca.crt"),
+				"-c", `{"function":"CreateAsset","Args":["asset7","say \"hi\""]}`},
+		},
+	}
+	for _, tt := range tests {
+		if got := chaincodeArgs(network, tt.mode, "mychannel", "basic", tt.function, tt.args); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: chaincodeArgs =\n%q\nwant\n%q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestContainerLabel(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"peer0.org1.example.com", "Org1 Peer0"},
+		{"peer1.org2.example.com", "Org2 Peer1"},
+		{"ca_org1", "Org1 CA"},
+		{"ca_orderer", "Orderer CA"},
+		{"orderer.example.com", "Orderer"},
+		{"orderer2.example.com", "orderer2.example.com"},
+		{"dev-peer0.org1.example.com-basic_1.0", "dev-peer0.org1.example.com-basic_1.0"},
+		{"peer0", "peer0"},
+	}
+	for _, tt := range tests {
+		if got := containerLabel(tt.name); got != tt.want {
+			t.Errorf("containerLabel(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
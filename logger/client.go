@@ -0,0 +1,447 @@
+package logger
+
+import (
+	"compress/gzip"
+	"crypto/tls"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"regexp"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	Heartbeat = "_HEARTBEAT_"
+	// ViewerHello is the handshake a viewer sends to a server's viewer
+	// endpoint so it starts streaming logs straight away.
+	ViewerHello = "_VIEWER_"
+	// Ack is a server's reply to each heartbeat, showing it is still
+	// reading rather than leaving writes to pile up in a buffer.
+	Ack = "_ACK_"
+
+	// DefaultHeartbeatInterval is how often a client sends a heartbeat,
+	// unless SetHeartbeatInterval says otherwise.
+	DefaultHeartbeatInterval = 1 * time.Second
+	// ackTimeout is how long a client waits for an Ack before it reports
+	// the server as unresponsive, or three heartbeat intervals if longer.
+	ackTimeout = 3 * time.Second
+	// compressFlushDelay is how long compressed writes are held so they
+	// go out together. Flushing every message on its own costs more in
+	// block overhead than compression saves.
+	compressFlushDelay = 100 * time.Millisecond
+
+	// After a failed dial the client waits minRetryDelay, doubling after
+	// each further failure up to maxRetryDelay, before dialing again
+	minRetryDelay = 500 * time.Millisecond
+	maxRetryDelay = 30 * time.Second
+)
+
+var ErrNotConnected = errors.New("logger: not connected")
+
+// ErrQueued is returned by Send for a message held in the offline queue,
+// to be sent once the client reconnects. ErrQueueFull is returned instead
+// when the oldest queued message had to be dropped to make room.
+var (
+	ErrQueued    = errors.New("logger: not connected, message queued")
+	ErrQueueFull = errors.New("logger: offline queue full, oldest message dropped")
+)
+
+// controlPattern matches the shape every protocol control message has, an
+// upper-case word between underscores such as "_HEARTBEAT_", alone or
+// followed by arguments.
+var controlPattern = regexp.MustCompile(`(?s)^\s*_[A-Z]+(?:_[A-Z]+)*_(?:\s.*)?$`)
+
+// IsControlMessage reports whether msg is, or looks like, a protocol
+// control message rather than a log. Ones a peer doesn't know, say from a
+// newer version, still match, so they are never shown as logs.
+func IsControlMessage(msg string) bool {
+	return controlPattern.MatchString(msg)
+}
+
+// Client keeps a connection to a logger server open, reconnecting when it
+// drops, and sends heartbeats so the server can tell the link is alive.
+// Messages the server writes back are handed to the message func.
+type Client struct {
+	addr       string
+	framing    Framing
+	handshake  []string
+	onMessage  func(string)
+	maxRetries int
+	clock      Clock
+	compress   bool
+	interval   time.Duration // between heartbeats
+	tlsConfig  *tls.Config
+	queueSize  int // offline queue capacity, 0 for none
+
+	mu        sync.Mutex
+	conn      net.Conn
+	w         io.Writer // conn, or zw writing to it
+	zw        *gzip.Writer
+	flushing  bool // a flush of zw is scheduled
+	wire      *countingWriter
+	sent      int64 // message bytes written, before compression
+	connected bool
+	levels    []string // levels the server subscribed to, nil for all
+	failures  int      // failed dials since the last connection
+	dialErr   error    // why the last dial failed
+	queue     []string // messages waiting for a connection, oldest first
+	retryAt   time.Time
+	gaveUp    bool
+	lastAck   time.Time
+	done      chan struct{}
+	stopOnce  sync.Once
+}
+
+func NewClient(addr string, framing Framing) *Client {
+	return &Client{
+		addr:     addr,
+		framing:  framing,
+		clock:    RealClock,
+		interval: DefaultHeartbeatInterval,
+		done:     make(chan struct{}),
+	}
+}
+
+func (c *Client) Addr() string {
+	return c.addr
+}
+
+// SetHandshake sets lines sent, after framing is negotiated, every time
+// the client (re)connects. Call before Start.
+func (c *Client) SetHandshake(lines ...string) {
+	c.handshake = lines
+}
+
+// SetMessageFunc sets the handler for messages received from the server.
+// It runs on the client's reader goroutine. Call before Start.
+func (c *Client) SetMessageFunc(handler func(msg string)) {
+	c.onMessage = handler
+}
+
+// SetMaxRetries makes the client give up after a failed dial and this
+// many retries, until Reconnect is called. 0, the default, retries for
+// ever. Call before Start.
+func (c *Client) SetMaxRetries(n int) {
+	c.maxRetries = n
+}
+
+// SetHeartbeatInterval sets how often the client sends a heartbeat,
+// DefaultHeartbeatInterval by default. The server's heartbeat timeout
+// should be at least twice this. Call before Start.
+func (c *Client) SetHeartbeatInterval(interval time.Duration) {
+	c.interval = interval
+}
+
+// SetTLSConfig makes the client dial over TLS with config, from
+// LoadClientTLS. nil, the default, dials plain TCP. Call before Start.
+func (c *Client) SetTLSConfig(config *tls.Config) {
+	c.tlsConfig = config
+}
+
+// SetOfflineQueue makes Send hold up to size messages while the client is
+// disconnected, sending them in order once it reconnects. When the queue
+// is full the oldest is dropped. 0, the default, queues nothing. Call
+// before Start.
+func (c *Client) SetOfflineQueue(size int) {
+	c.queueSize = size
+}
+
+// Queued returns how many messages are waiting to be sent on reconnect.
+func (c *Client) Queued() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.queue)
+}
+
+// SetClock replaces the clock acks are timed against. Call before Start.
+func (c *Client) SetClock(clock Clock) {
+	c.clock = clock
+}
+
+// SetCompress makes the client gzip everything it writes, for servers
+// started with compression allowed. Call before Start.
+func (c *Client) SetCompress(compress bool) {
+	c.compress = compress
+}
+
+// BytesSent returns how many bytes of messages, framing included, the
+// client has written since it started, and how many went on the wire.
+// The two differ when compressing.
+func (c *Client) BytesSent() (int64, int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	wire := c.sent
+	if c.wire != nil {
+		wire = c.wire.n
+	}
+	return c.sent, wire
+}
+
+// Start connects and keeps the connection alive in the background.
+func (c *Client) Start() {
+	go c.run()
+}
+
+func (c *Client) Stop() {
+	c.stopOnce.Do(func() {
+		close(c.done)
+		c.mu.Lock()
+		c.dropLocked(c.conn)
+		c.mu.Unlock()
+	})
+}
+
+func (c *Client) Connected() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.connected
+}
+
+// Responsive reports whether the client is connected and the server has
+// acked a heartbeat recently. A half-open connection can stay Connected,
+// with writes succeeding, long after the server stopped reading.
+func (c *Client) Responsive() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.connected && c.clock.Now().Sub(c.lastAck) <= max(ackTimeout, 3*c.interval)
+}
+
+// GaveUp reports whether the client has run out of retries.
+func (c *Client) GaveUp() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.gaveUp
+}
+
+// RetryIn returns how long until the client dials again after a failed
+// dial, or 0 when it isn't waiting to.
+func (c *Client) RetryIn() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.connected || c.gaveUp {
+		return 0
+	}
+	return max(0, c.retryAt.Sub(c.clock.Now()))
+}
+
+// DialErr returns why the last dial failed, such as a TLS handshake
+// error, or nil once connected.
+func (c *Client) DialErr() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.dialErr
+}
+
+// Reconnect starts retrying again after the client gave up.
+func (c *Client) Reconnect() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gaveUp = false
+	c.failures = 0
+}
+
+// Send writes one message to the server. Logs with a level outside those
+// the server subscribed to are dropped without error, while ones with no
+// level are always sent. With an offline queue, a message that can't be
+// written is queued, as ErrQueued reports.
+func (c *Client) Send(msg string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if level, _, _ := ParseLogLine(msg); level != "" && c.levels != nil && !slices.Contains(c.levels, level) {
+		return nil
+	}
+	err := c.writeLocked(msg)
+	if err == nil || c.queueSize <= 0 {
+		return err
+	}
+	if len(c.queue) < c.queueSize {
+		c.queue = append(c.queue, msg)
+		return ErrQueued
+	}
+	c.queue = append(c.queue[1:], msg)
+	return ErrQueueFull
+}
+
+func (c *Client) sendHeartbeat() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.writeLocked(Heartbeat)
+}
+
+func (c *Client) run() {
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		wait := ticker.C
+		if !c.Connected() {
+			if !c.GaveUp() {
+				if delay := c.connect(); delay > 0 {
+					wait = time.After(delay)
+				}
+			}
+		} else {
+			c.sendHeartbeat()
+		}
+
+		select {
+		case <-c.done:
+			return
+		case <-wait:
+		}
+	}
+}
+
+// retryDelay is how long to wait after the nth failed dial in a row:
+// minRetryDelay doubled for each failure before it, up to maxRetryDelay,
+// less up to half at random so many clients don't retry in step.
+func retryDelay(failures int) time.Duration {
+	delay := maxRetryDelay
+	if shift := failures - 1; shift < 16 {
+		delay = min(delay, minRetryDelay<<shift)
+	}
+	return delay - rand.N(delay/2)
+}
+
+// connect dials the server, returning on failure how long to wait before
+// dialing again, and otherwise 0.
+func (c *Client) connect() time.Duration {
+	var conn net.Conn
+	var err error
+	if c.tlsConfig != nil {
+		conn, err = (&tls.Dialer{Config: c.tlsConfig}).Dial("tcp", c.addr)
+	} else {
+		conn, err = net.Dial("tcp", c.addr)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.dialErr = err
+	if err != nil {
+		c.failures++
+		c.gaveUp = c.maxRetries > 0 && c.failures > c.maxRetries
+		delay := retryDelay(c.failures)
+		c.retryAt = c.clock.Now().Add(delay)
+		return delay
+	}
+	c.failures = 0
+	select {
+	case <-c.done:
+		conn.Close()
+		return 0
+	default:
+	}
+
+	c.conn = conn
+	c.connected = true
+	c.levels = nil
+	c.lastAck = c.clock.Now()
+	c.w = conn
+	if c.compress {
+		if c.wire == nil {
+			c.wire = &countingWriter{}
+		}
+		c.wire.w = conn
+		c.zw = gzip.NewWriter(c.wire)
+		c.w = c.zw
+	}
+
+	// Negotiate framing before anything else is written
+	if c.framing != LineFraming {
+		if err := c.writeBytesLocked(LineFraming.Encode(c.framing.Request())); err != nil {
+			return 0
+		}
+	}
+	for _, line := range c.handshake {
+		if err := c.writeLocked(line); err != nil {
+			return 0
+		}
+	}
+	// Then what was sent while disconnected, before anything new
+	for len(c.queue) > 0 {
+		if err := c.writeLocked(c.queue[0]); err != nil {
+			return 0
+		}
+		c.queue = c.queue[1:]
+	}
+	c.queue = nil
+
+	go c.read(conn)
+	return 0
+}
+
+func (c *Client) read(conn net.Conn) {
+	framer := NewFramer()
+	framer.SetFraming(c.framing)
+	scanner := NewScanner(conn, framer)
+	for scanner.Scan() {
+		msg := scanner.Text()
+		if msg == Ack {
+			c.mu.Lock()
+			c.lastAck = c.clock.Now()
+			c.mu.Unlock()
+			continue
+		}
+		if levels, ok := ParseSubscribe(msg); ok {
+			c.mu.Lock()
+			c.levels = levels
+			c.mu.Unlock()
+			continue
+		}
+		if IsControlMessage(msg) {
+			continue
+		}
+		if c.onMessage != nil {
+			c.onMessage(msg)
+		}
+	}
+
+	c.mu.Lock()
+	c.dropLocked(conn)
+	c.mu.Unlock()
+}
+
+func (c *Client) writeLocked(msg string) error {
+	return c.writeBytesLocked(c.framing.Encode(msg))
+}
+
+func (c *Client) writeBytesLocked(data []byte) error {
+	if c.conn == nil || !c.connected {
+		return ErrNotConnected
+	}
+	if _, err := c.w.Write(data); err != nil {
+		c.dropLocked(c.conn)
+		return err
+	}
+	c.sent += int64(len(data))
+	if c.zw != nil && !c.flushing {
+		c.flushing = true
+		time.AfterFunc(compressFlushDelay, c.flush)
+	}
+	return nil
+}
+
+// flush sends what the compressor has buffered.
+func (c *Client) flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.flushing = false
+	if c.connected {
+		if err := c.zw.Flush(); err != nil {
+			c.dropLocked(c.conn)
+		}
+	}
+}
+
+// dropLocked closes conn if it is still the current connection.
+func (c *Client) dropLocked(conn net.Conn) {
+	if conn == nil || conn != c.conn {
+		return
+	}
+	conn.Close()
+	c.conn = nil
+	c.connected = false
+}
@@ -0,0 +1,353 @@
+package logger
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// closedAddr returns an address nothing is listening on.
+func closedAddr(t *testing.T) string {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().String()
+	ln.Close()
+	return addr
+}
+
+func TestClientSendSubscribedLevels(t *testing.T) {
+	tests := []struct {
+		name   string
+		levels []string
+		msg    string
+		sent   bool
+	}{
+		{"all levels", nil, "INFO: started", true},
+		{"subscribed level", []string{"ERROR", "WARNING"}, "ERROR: disk full", true},
+		{"unsubscribed level", []string{"ERROR", "WARNING"}, "INFO: started", false},
+		{"no level", []string{"ERROR"}, "plain output", true},
+		{"no level, all levels", nil, "plain output", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			local, remote := net.Pipe()
+			defer remote.Close()
+			c := NewClient("", LineFraming)
+			c.conn, c.w, c.connected = local, local, true
+			c.levels = tt.levels
+
+			read := make(chan string, 1)
+			go func() {
+				line, _ := bufio.NewReader(remote).ReadString('\n')
+				read <- line
+			}()
+			if err := c.Send(tt.msg); err != nil {
+				t.Fatalf("Send: %v", err)
+			}
+			// End the read whether or not anything was written
+			local.Close()
+			got := <-read
+			if sent := got == tt.msg+"\n"; sent != tt.sent {
+				t.Errorf("Send(%q) with levels %q wrote %q, want sent %v", tt.msg, tt.levels, got, tt.sent)
+			}
+		})
+	}
+}
+
+func TestClientMaxRetries(t *testing.T) {
+	tests := []struct {
+		name       string
+		maxRetries int
+		dials      int
+		gaveUp     bool
+	}{
+		{"retries for ever", 0, 10, false},
+		{"within the limit", 2, 2, false},
+		{"the last retry", 2, 3, true},
+		{"no retries", 1, 2, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewClient(closedAddr(t), LineFraming)
+			c.SetMaxRetries(tt.maxRetries)
+			for i := 0; i < tt.dials; i++ {
+				if delay := c.connect(); delay <= 0 {
+					t.Fatalf("dial %d: connect() = %v, want a delay before retrying", i+1, delay)
+				}
+			}
+			if c.GaveUp() != tt.gaveUp {
+				t.Errorf("GaveUp() after %d failed dials = %v, want %v", tt.dials, c.GaveUp(), tt.gaveUp)
+			}
+			if c.DialErr() == nil {
+				t.Error("DialErr() = nil after failed dials")
+			}
+
+			c.Reconnect()
+			if c.GaveUp() {
+				t.Error("GaveUp() after Reconnect")
+			}
+		})
+	}
+}
+
+func TestClientResponsive(t *testing.T) {
+	tests := []struct {
+		name      string
+		interval  time.Duration
+		since     time.Duration // since the last ack
+		connected bool
+		want      bool
+	}{
+		{"just acked", time.Second, 0, true, true},
+		{"within ackTimeout", time.Second, ackTimeout, true, true},
+		{"past ackTimeout", time.Second, ackTimeout + time.Millisecond, true, false},
+		{"slow heartbeats get three intervals", 5 * time.Second, 15 * time.Second, true, true},
+		{"past three intervals", 5 * time.Second, 15*time.Second + time.Millisecond, true, false},
+		{"disconnected", time.Second, 0, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := newFakeClock()
+			c := NewClient("", LineFraming)
+			c.SetClock(clock)
+			c.SetHeartbeatInterval(tt.interval)
+			c.connected, c.lastAck = tt.connected, clock.Now()
+			clock.Advance(tt.since)
+			if got := c.Responsive(); got != tt.want {
+				t.Errorf("Responsive() %v after the last ack = %v, want %v", tt.since, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHeartbeatAcked(t *testing.T) {
+	// The server acks each heartbeat
+	s := NewServer("")
+	server, remote := net.Pipe()
+	defer remote.Close()
+	go s.ServeConn(server)
+	send(t, remote, Heartbeat)
+	reply, err := bufio.NewReader(remote).ReadString('\n')
+	if err != nil || reply != Ack+"\n" {
+		t.Fatalf("server replied %q, %v to a heartbeat, want %q", reply, err, Ack+"\n")
+	}
+
+	// and the client times its responsiveness from the ack
+	clock := newFakeClock()
+	c := NewClient("", LineFraming)
+	c.SetClock(clock)
+	local, peer := net.Pipe()
+	defer peer.Close()
+	c.conn, c.w, c.connected = local, local, true
+	go c.read(local)
+	clock.Advance(time.Minute)
+	if c.Responsive() {
+		t.Fatal("Responsive() before any ack")
+	}
+	if _, err := peer.Write(LineFraming.Encode(Ack)); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "the ack to be read", c.Responsive)
+}
+
+func TestClientCompress(t *testing.T) {
+	for _, framing := range []Framing{LineFraming, LengthFraming} {
+		t.Run(framing.String(), func(t *testing.T) {
+			s := NewServer("127.0.0.1:0")
+			s.SetCompress(true)
+			if err := s.Start(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			defer s.Stop()
+
+			c := NewClient(s.Addr(), framing)
+			c.SetCompress(true)
+			c.Start()
+			defer c.Stop()
+			waitFor(t, "the client to connect", c.Connected)
+			var want []string
+			for i := 0; i < 50; i++ {
+				msg := fmt.Sprintf("INFO: request %d served in 12ms\nfrom the cache", i)
+				if framing == LineFraming {
+					msg = strings.ReplaceAll(msg, "\n", " ")
+				}
+				if err := c.Send(msg); err != nil {
+					t.Fatalf("Send: %v", err)
+				}
+				want = append(want, msg)
+			}
+			waitFor(t, "the logs to arrive", func() bool { return len(s.Logs().GetFilteredLogs("ALL")) == len(want) })
+			if got := s.Logs().GetFilteredLogs("ALL"); !slices.Equal(got, want) {
+				t.Errorf("server stored %q, want %q", got, want)
+			}
+			if sent, wire := c.BytesSent(); wire <= 0 || wire >= sent {
+				t.Errorf("BytesSent() = %d, %d, want fewer bytes on the wire than sent", sent, wire)
+			}
+		})
+	}
+}
+
+func TestServerRejectsCompressed(t *testing.T) {
+	s := NewServer("")
+	server, client := net.Pipe()
+	served := make(chan struct{})
+	go func() {
+		s.ServeConn(server)
+		close(served)
+	}()
+	go func() {
+		zw := gzip.NewWriter(client)
+		zw.Write(LineFraming.Encode("INFO: compressed"))
+		zw.Close()
+	}()
+	select {
+	case <-served:
+	case <-time.After(time.Second):
+		t.Fatal("a compressed stream was served without SetCompress")
+	}
+	client.Close()
+	if got := s.Logs().GetFilteredLogs("ALL"); len(got) != 0 {
+		t.Errorf("stored %q from a compressed stream without SetCompress", got)
+	}
+}
+
+func TestIsControlMessage(t *testing.T) {
+	tests := []struct {
+		msg  string
+		want bool
+	}{
+		{Heartbeat, true},
+		{Ack, true},
+		{Probe, true},
+		{ProbeReply, true},
+		{LengthFraming.Request(), true},
+		{HelloMessage("worker"), true},
+		// Ones this version doesn't know
+		{"_VERSION_ 2", true},
+		{"  _AUTH_TOKEN_\tabc", true},
+		{"_VERSION_", true},
+		{"INFO: _HEARTBEAT_", false},
+		{"_heartbeat_", false},
+		{"_VERSION_2", false},
+		{"__", false},
+		{"_A__B_", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := IsControlMessage(tt.msg); got != tt.want {
+			t.Errorf("IsControlMessage(%q) = %v, want %v", tt.msg, got, tt.want)
+		}
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		failures int
+		base     time.Duration // before jitter
+	}{
+		{1, minRetryDelay},
+		{2, 2 * minRetryDelay},
+		{3, 4 * minRetryDelay},
+		{20, maxRetryDelay},
+		{1000, maxRetryDelay},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 100; i++ {
+			if delay := retryDelay(tt.failures); delay <= tt.base/2 || delay > tt.base {
+				t.Fatalf("retryDelay(%d) = %v, want within (%v, %v]", tt.failures, delay, tt.base/2, tt.base)
+			}
+		}
+	}
+}
+
+func TestClientRetryIn(t *testing.T) {
+	clock := newFakeClock()
+	c := NewClient(closedAddr(t), LineFraming)
+	c.SetClock(clock)
+	if got := c.RetryIn(); got != 0 {
+		t.Errorf("RetryIn() before dialing = %v, want 0", got)
+	}
+	delay := c.connect()
+	if got := c.RetryIn(); got != delay {
+		t.Errorf("RetryIn() after a failed dial = %v, want the retry delay %v", got, delay)
+	}
+	clock.Advance(delay / 2)
+	if got := c.RetryIn(); got != delay-delay/2 {
+		t.Errorf("RetryIn() halfway = %v, want %v", got, delay-delay/2)
+	}
+	clock.Advance(delay)
+	if got := c.RetryIn(); got != 0 {
+		t.Errorf("RetryIn() past the retry time = %v, want 0", got)
+	}
+
+	c.SetMaxRetries(1)
+	c.connect()
+	if !c.GaveUp() || c.RetryIn() != 0 {
+		t.Errorf("after giving up GaveUp() = %v, RetryIn() = %v, want true, 0", c.GaveUp(), c.RetryIn())
+	}
+}
+
+func TestClientOfflineQueue(t *testing.T) {
+	s := NewServer("127.0.0.1:0")
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+
+	c := NewClient(s.Addr(), LineFraming)
+	c.SetOfflineQueue(3)
+	sends := []struct {
+		msg  string
+		want error
+	}{
+		{"INFO: one", ErrQueued},
+		{"INFO: two", ErrQueued},
+		{"INFO: three", ErrQueued},
+		{"INFO: four", ErrQueueFull}, // drops "one"
+	}
+	for _, send := range sends {
+		if err := c.Send(send.msg); !errors.Is(err, send.want) {
+			t.Errorf("Send(%q) while disconnected = %v, want %v", send.msg, err, send.want)
+		}
+	}
+	if got := c.Queued(); got != 3 {
+		t.Errorf("Queued() = %d, want 3", got)
+	}
+
+	// Once connected the queue goes first, in order
+	if delay := c.connect(); delay != 0 {
+		t.Fatalf("connect() = %v, want 0", delay)
+	}
+	defer c.Stop()
+	if err := c.Send("INFO: five"); err != nil {
+		t.Errorf("Send once connected = %v", err)
+	}
+	if got := c.Queued(); got != 0 {
+		t.Errorf("Queued() after reconnecting = %d, want 0", got)
+	}
+	want := []string{"INFO: two", "INFO: three", "INFO: four", "INFO: five"}
+	waitFor(t, "the queued logs", func() bool { return len(s.Logs().GetFilteredLogs("ALL")) == len(want) })
+	if got := s.Logs().GetFilteredLogs("ALL"); !slices.Equal(got, want) {
+		t.Errorf("server stored %q, want %q", got, want)
+	}
+}
+
+func TestClientNoOfflineQueue(t *testing.T) {
+	c := NewClient(closedAddr(t), LineFraming)
+	if err := c.Send("INFO: one"); !errors.Is(err, ErrNotConnected) {
+		t.Errorf("Send while disconnected = %v, want ErrNotConnected", err)
+	}
+	if got := c.Queued(); got != 0 {
+		t.Errorf("Queued() = %d without an offline queue", got)
+	}
+}
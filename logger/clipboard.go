@@ -0,0 +1,33 @@
+package logger
+
+import (
+	"errors"
+	"os/exec"
+	"strings"
+)
+
+// clipboardCommands are tried in order; the first one installed is used.
+var clipboardCommands = [][]string{
+	{"wl-copy"},
+	{"xclip", "-selection", "clipboard"},
+	{"xsel", "--clipboard", "--input"},
+	{"pbcopy"},
+	{"clip.exe"},
+}
+
+var ErrNoClipboard = errors.New("no clipboard tool found, install wl-copy, xclip or xsel")
+
+// CopyToClipboard puts text on the system clipboard through whichever
+// clipboard tool is installed.
+func CopyToClipboard(text string) error {
+	for _, command := range clipboardCommands {
+		path, err := exec.LookPath(command[0])
+		if err != nil {
+			continue
+		}
+		cmd := exec.Command(path, command[1:]...)
+		cmd.Stdin = strings.NewReader(text)
+		return cmd.Run()
+	}
+	return ErrNoClipboard
+}
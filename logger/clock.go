@@ -0,0 +1,16 @@
+package logger
+
+import "time"
+
+// Clock tells the time. Time-based logic takes one instead of calling
+// time.Now so it can be driven by a fake clock.
+type Clock interface {
+	Now() time.Time
+}
+
+// RealClock is the wall clock.
+var RealClock Clock = realClock{}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
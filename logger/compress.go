@@ -0,0 +1,31 @@
+package logger
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+)
+
+// gzipMagic starts every gzip stream. A client that compresses writes
+// nothing before it, so the server can tell a compressed stream from a
+// plain one by its first two bytes; plain messages never start with it.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// isCompressed reports whether the stream br reads starts with gzip's
+// magic, without consuming it.
+func isCompressed(br *bufio.Reader) bool {
+	magic, err := br.Peek(len(gzipMagic))
+	return err == nil && bytes.Equal(magic, gzipMagic)
+}
+
+// countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
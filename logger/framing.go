@@ -0,0 +1,209 @@
+// Package logger holds the pieces shared by the SERVER LOGGER and
+// CLIENT LOGGER APP variants: the wire protocol and its framing, the
+// Client and Server that speak it, and the keymap and prefs their UIs use.
+package logger
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// framingRequest is sent by a client, in line mode, as the first
+// message on a connection to switch the rest of the stream over.
+const framingRequest = "_FRAMING_"
+
+// Framing selects how messages are delimited on the wire.
+type Framing int
+
+const (
+	// LineFraming is the original newline-delimited protocol.
+	LineFraming Framing = iota
+	// LengthFraming writes a 4-byte big-endian length, then the payload,
+	// so messages may contain newlines (e.g. stack traces).
+	LengthFraming
+	// NulFraming ends each message with a NUL byte instead of a newline,
+	// a lighter way for multi-line messages to keep their line breaks.
+	NulFraming
+)
+
+// DefaultMaxMessageSize is the longest message a Framer reads whole
+// unless SetMaxSize says otherwise. Longer ones are truncated.
+const DefaultMaxMessageSize = 1 << 20
+
+func (f Framing) String() string {
+	switch f {
+	case LengthFraming:
+		return "length"
+	case NulFraming:
+		return "nul"
+	}
+	return "line"
+}
+
+// ParseFraming returns the framing named by String.
+func ParseFraming(name string) (Framing, error) {
+	for _, f := range []Framing{LineFraming, LengthFraming, NulFraming} {
+		if name == f.String() {
+			return f, nil
+		}
+	}
+	return LineFraming, fmt.Errorf("unknown framing %q", name)
+}
+
+// Request returns the handshake line a client sends to negotiate f.
+func (f Framing) Request() string {
+	return framingRequest + " " + f.String()
+}
+
+// Encode returns msg ready to be written to the connection.
+func (f Framing) Encode(msg string) []byte {
+	if f == LengthFraming {
+		buf := make([]byte, 4+len(msg))
+		binary.BigEndian.PutUint32(buf, uint32(len(msg)))
+		copy(buf[4:], msg)
+		return buf
+	}
+	if f == NulFraming {
+		return []byte(msg + "\x00")
+	}
+	return []byte(msg + "\n")
+}
+
+// ParseFramingRequest reports whether msg is a framing handshake and, if
+// so, which framing the client asked for.
+func ParseFramingRequest(msg string) (Framing, bool) {
+	mode, ok := strings.CutPrefix(msg, framingRequest+" ")
+	if !ok {
+		return LineFraming, false
+	}
+	f, err := ParseFraming(mode)
+	return f, err == nil
+}
+
+// Framer is a bufio.SplitFunc provider whose framing can be switched
+// between tokens, which is how the server applies a client's handshake.
+// A message longer than its max size is cut short, the rest of it
+// skipped, rather than ending the scan.
+type Framer struct {
+	framing   Framing
+	maxSize   int
+	truncated bool // the last message was cut short
+	skipping  bool // discarding the rest of a truncated line or record
+	skip      int  // bytes of a truncated length frame still to discard
+}
+
+func NewFramer() *Framer {
+	return &Framer{}
+}
+
+func (fr *Framer) SetFraming(f Framing) {
+	fr.framing = f
+}
+
+func (fr *Framer) Framing() Framing {
+	return fr.framing
+}
+
+// SetMaxSize sets the longest message read whole, counting a length
+// frame's header, DefaultMaxMessageSize by default. Call before
+// NewScanner.
+func (fr *Framer) SetMaxSize(size int) {
+	fr.maxSize = size
+}
+
+func (fr *Framer) MaxSize() int {
+	if fr.maxSize <= 0 {
+		return DefaultMaxMessageSize
+	}
+	return fr.maxSize
+}
+
+// Truncated reports whether the message last scanned was cut short at
+// the max size.
+func (fr *Framer) Truncated() bool {
+	return fr.truncated
+}
+
+func (fr *Framer) Split(data []byte, atEOF bool) (int, []byte, error) {
+	if fr.skipping {
+		delim := byte('\n')
+		if fr.framing == NulFraming {
+			delim = 0
+		}
+		if i := bytes.IndexByte(data, delim); i >= 0 {
+			fr.skipping = false
+			return i + 1, nil, nil
+		}
+		return len(data), nil, nil
+	}
+	if fr.skip > 0 {
+		n := min(fr.skip, len(data))
+		fr.skip -= n
+		return n, nil, nil
+	}
+	fr.truncated = false
+
+	switch fr.framing {
+	case LineFraming, NulFraming:
+		split := bufio.ScanLines
+		if fr.framing == NulFraming {
+			split = scanNul
+		}
+		advance, token, err := split(data, atEOF)
+		// The scanner's buffer is full without a whole message in it
+		if advance == 0 && len(data) >= fr.MaxSize() {
+			fr.truncated, fr.skipping = true, true
+			return len(data), data, nil
+		}
+		return advance, token, err
+	}
+
+	if len(data) < 4 {
+		if atEOF && len(data) > 0 {
+			return 0, nil, errors.New("logger: truncated frame header")
+		}
+		return 0, nil, nil
+	}
+	size := int(binary.BigEndian.Uint32(data))
+	if size > fr.MaxSize()-4 {
+		// Keep what fits and skip the rest
+		if len(data) < fr.MaxSize() && !atEOF {
+			return 0, nil, nil
+		}
+		fr.truncated = true
+		fr.skip = size - (len(data) - 4)
+		return len(data), data[4:], nil
+	}
+	if len(data) < 4+size {
+		if atEOF {
+			return 0, nil, errors.New("logger: truncated frame")
+		}
+		return 0, nil, nil
+	}
+	return 4 + size, data[4 : 4+size], nil
+}
+
+// scanNul is bufio.ScanLines for NUL-terminated records.
+func scanNul(data []byte, atEOF bool) (int, []byte, error) {
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// NewScanner returns a scanner reading messages through fr, up to its max
+// size.
+func NewScanner(r io.Reader, fr *Framer) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, fr.MaxSize())
+	scanner.Split(fr.Split)
+	return scanner
+}
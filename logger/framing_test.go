@@ -0,0 +1,155 @@
+package logger
+
+import (
+	"bytes"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// scanAll reads every message from r through fr, switching framing on a
+// handshake as the server does.
+func scanAll(t *testing.T, r io.Reader, fr *Framer) []string {
+	t.Helper()
+	var msgs []string
+	scanner := NewScanner(r, fr)
+	for scanner.Scan() {
+		if framing, ok := ParseFramingRequest(scanner.Text()); ok {
+			fr.SetFraming(framing)
+			continue
+		}
+		msgs = append(msgs, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		t.Fatalf("scanning: %v", err)
+	}
+	return msgs
+}
+
+func TestFramerSplit(t *testing.T) {
+	tests := []struct {
+		name    string
+		framing Framing
+		msgs    []string
+	}{
+		{"line", LineFraming, []string{"INFO: one", "ERROR: two words"}},
+		{"length", LengthFraming, []string{"INFO: one", "ERROR: panic\n\tat main.go:12"}},
+		{"nul", NulFraming, []string{"INFO: one", "ERROR: panic\n\tat main.go:12"}},
+	}
+	for _, tt := range tests {
+		var stream []byte
+		if tt.framing != LineFraming {
+			stream = LineFraming.Encode(tt.framing.Request())
+		}
+		for _, msg := range tt.msgs {
+			stream = append(stream, tt.framing.Encode(msg)...)
+		}
+		// Messages merged into one read, and split across many
+		readers := map[string]func() io.Reader{
+			"merged":             func() io.Reader { return bytes.NewReader(stream) },
+			"one byte at a time": func() io.Reader { return iotest.OneByteReader(bytes.NewReader(stream)) },
+		}
+		for how, reader := range readers {
+			t.Run(tt.name+"/"+how, func(t *testing.T) {
+				if got := scanAll(t, reader(), NewFramer()); !slices.Equal(got, tt.msgs) {
+					t.Errorf("scanned %q, want %q", got, tt.msgs)
+				}
+			})
+		}
+	}
+}
+
+func TestFramerSplitTruncatedFrame(t *testing.T) {
+	fr := NewFramer()
+	fr.SetFraming(LengthFraming)
+	stream := LengthFraming.Encode("INFO: cut")
+	scanner := NewScanner(bytes.NewReader(stream[:len(stream)-2]), fr)
+	for scanner.Scan() {
+		t.Errorf("scanned %q from a cut-off frame", scanner.Text())
+	}
+	if scanner.Err() == nil {
+		t.Error("no error for a frame cut off at EOF")
+	}
+}
+
+func TestParseFramingRequest(t *testing.T) {
+	tests := []struct {
+		msg     string
+		framing Framing
+		ok      bool
+	}{
+		{LengthFraming.Request(), LengthFraming, true},
+		{LineFraming.Request(), LineFraming, true},
+		{NulFraming.Request(), NulFraming, true},
+		{"_FRAMING_ carrier-pigeon", LineFraming, false},
+		{"INFO: _FRAMING_ length", LineFraming, false},
+	}
+	for _, tt := range tests {
+		framing, ok := ParseFramingRequest(tt.msg)
+		if framing != tt.framing || ok != tt.ok {
+			t.Errorf("ParseFramingRequest(%q) = %v, %v, want %v, %v", tt.msg, framing, ok, tt.framing, tt.ok)
+		}
+	}
+}
+
+func TestParseFraming(t *testing.T) {
+	for _, f := range []Framing{LineFraming, LengthFraming, NulFraming} {
+		if got, err := ParseFraming(f.String()); err != nil || got != f {
+			t.Errorf("ParseFraming(%q) = %v, %v, want %v", f.String(), got, err, f)
+		}
+	}
+	if _, err := ParseFraming("NUL"); err == nil {
+		t.Error("ParseFraming(\"NUL\") accepted a name String never returns")
+	}
+}
+
+func TestFramerTruncates(t *testing.T) {
+	const maxSize = 16
+	long := strings.Repeat("x", 40)
+	tests := []struct {
+		framing Framing
+		fits    string // the longest message read whole
+		cut     string // what is kept of long
+	}{
+		{LineFraming, strings.Repeat("y", maxSize-1), long[:maxSize]},
+		{NulFraming, strings.Repeat("y", maxSize-1), long[:maxSize]},
+		{LengthFraming, strings.Repeat("y", maxSize-4), long[:maxSize-4]},
+	}
+	for _, tt := range tests {
+		// A long message in the middle, and one at the very end
+		msgs := []string{"INFO: a", long, tt.fits, "INFO: b", long}
+		want := []string{"INFO: a", tt.cut, tt.fits, "INFO: b", tt.cut}
+		truncated := []bool{false, true, false, false, true}
+		var stream []byte
+		for _, msg := range msgs {
+			stream = append(stream, tt.framing.Encode(msg)...)
+		}
+		readers := map[string]func() io.Reader{
+			"merged":             func() io.Reader { return bytes.NewReader(stream) },
+			"one byte at a time": func() io.Reader { return iotest.OneByteReader(bytes.NewReader(stream)) },
+		}
+		for how, reader := range readers {
+			t.Run(tt.framing.String()+"/"+how, func(t *testing.T) {
+				fr := NewFramer()
+				fr.SetFraming(tt.framing)
+				fr.SetMaxSize(maxSize)
+				scanner := NewScanner(reader(), fr)
+				var got []string
+				for scanner.Scan() {
+					if i := len(got); i < len(truncated) && fr.Truncated() != truncated[i] {
+						t.Errorf("message %d: Truncated() = %v, want %v", i, fr.Truncated(), truncated[i])
+					}
+					got = append(got, scanner.Text())
+				}
+				if err := scanner.Err(); err != nil {
+					t.Fatalf("scanning: %v", err)
+				}
+				if !slices.Equal(got, want) {
+					t.Errorf("scanned %q, want %q", got, want)
+				}
+			})
+		}
+	}
+}
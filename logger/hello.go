@@ -0,0 +1,50 @@
+package logger
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// helloRequest is sent by a client right after connecting to say who it
+// is, e.g. "_HELLO_ myservice@host123", so its logs can be told apart from
+// other clients'.
+const helloRequest = "_HELLO_"
+
+// clientName is what a client may call itself: no spaces, and no
+// brackets that could be read as a color tag.
+var clientName = regexp.MustCompile(`^[\w.@:/-]+$`)
+
+// HelloMessage returns the identification line for name, for
+// Client.SetHandshake.
+func HelloMessage(name string) string {
+	return helloRequest + " " + name
+}
+
+// ParseHello reports whether msg is an identification line with a valid
+// name and, if so, the name.
+func ParseHello(msg string) (string, bool) {
+	name, ok := strings.CutPrefix(msg, helloRequest+" ")
+	if !ok || !clientName.MatchString(name) {
+		return "", false
+	}
+	return name, true
+}
+
+// DefaultClientName names the running program as "app@host", from its
+// executable's name and the hostname, with anything not allowed in a
+// name replaced by "-".
+func DefaultClientName() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	name := strings.TrimSuffix(filepath.Base(os.Args[0]), ".exe") + "@" + host
+	return strings.Map(func(r rune) rune {
+		if clientName.MatchString(string(r)) {
+			return r
+		}
+		return '-'
+	}, name)
+}
@@ -0,0 +1,37 @@
+package logger
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/rivo/tview"
+)
+
+// HighlightMatches escapes text for tview and wraps each match of pattern
+// in a highlight, restoring the line's color after it. Matches are escaped
+// too, so a query holding "[" can't open a tag of its own. Empty matches,
+// such as a blank query's, are left unmarked.
+func HighlightMatches(text string, pattern *regexp.Regexp, color string) string {
+	if pattern == nil {
+		return tview.Escape(text)
+	}
+	restore := "[-:-]"
+	if color != "" {
+		restore = "[" + color + ":-]"
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, match := range pattern.FindAllStringIndex(text, -1) {
+		if match[0] == match[1] {
+			continue
+		}
+		b.WriteString(tview.Escape(text[last:match[0]]))
+		b.WriteString("[black:yellow]")
+		b.WriteString(tview.Escape(text[match[0]:match[1]]))
+		b.WriteString(restore)
+		last = match[1]
+	}
+	b.WriteString(tview.Escape(text[last:]))
+	return b.String()
+}
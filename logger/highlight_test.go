@@ -0,0 +1,30 @@
+package logger
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestHighlightMatches(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		pattern *regexp.Regexp
+		color   string
+		want    string
+	}{
+		{"no pattern", "ERROR: [disk] full", nil, "red", "ERROR: [disk[] full"},
+		{"one match", "ERROR: disk full", regexp.MustCompile("disk"), "red", "ERROR: [black:yellow]disk[red:-] full"},
+		{"every match", "a b a", regexp.MustCompile("a"), "green", "[black:yellow]a[green:-] b [black:yellow]a[green:-]"},
+		{"no color", "plain output", regexp.MustCompile("out"), "", "plain [black:yellow]out[-:-]put"},
+		{"escaped match", "got [TAG] back", regexp.MustCompile(`\[TAG\]`), "", "got [black:yellow][TAG[][-:-] back"},
+		{"empty matches", "abc", regexp.MustCompile("x*"), "", "abc"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := HighlightMatches(tt.text, tt.pattern, tt.color); got != tt.want {
+				t.Errorf("HighlightMatches(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package logger
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// Binding is one key an app responds to: a letter or other rune, or, when
+// Key is set, a special key or a rune with modifiers such as Alt+C.
+type Binding struct {
+	Rune   rune
+	Key    tcell.Key
+	Mods   tcell.ModMask
+	Desc   string
+	Action func()
+}
+
+// Name is how help and the footer show the key: "I", "Esc" or "Alt+C".
+func (b Binding) Name() string {
+	var name strings.Builder
+	for _, mod := range []struct {
+		mask tcell.ModMask
+		name string
+	}{{tcell.ModCtrl, "Ctrl+"}, {tcell.ModAlt, "Alt+"}, {tcell.ModShift, "Shift+"}} {
+		if b.Mods&mod.mask != 0 {
+			name.WriteString(mod.name)
+		}
+	}
+	if b.Key == 0 || b.Key == tcell.KeyRune {
+		name.WriteRune(unicode.ToUpper(b.Rune))
+	} else {
+		name.WriteString(tcell.KeyNames[b.Key])
+	}
+	return name.String()
+}
+
+func (b Binding) matches(key tcell.Key, r rune, mods tcell.ModMask) bool {
+	if key != tcell.KeyRune {
+		return b.Key == key && b.Mods == mods
+	}
+	if b.Key == 0 {
+		// Shift is how a capital is typed, so it still matches
+		return mods&^tcell.ModShift == 0 && b.Rune == unicode.ToLower(r)
+	}
+	return b.Key == tcell.KeyRune && b.Mods == mods && b.Rune == unicode.ToLower(r)
+}
+
+// Keymap is an app's single list of key bindings. The footer hint and the
+// help screen are both generated from it so they always match what the
+// keys actually do. Letters match regardless of case.
+type Keymap struct {
+	bindings []Binding
+}
+
+func NewKeymap() *Keymap {
+	return &Keymap{}
+}
+
+// RegisterKey binds r to action. Registering a key again replaces it.
+func (km *Keymap) RegisterKey(r rune, desc string, action func()) {
+	km.register(Binding{Rune: unicode.ToLower(r), Desc: desc, Action: action})
+}
+
+// RegisterSpecialKey binds a key that isn't a plain rune to action: key
+// with mods, such as tcell.KeyEsc, or for a rune with modifiers
+// tcell.KeyRune, r and mods, such as Alt+C. Registering it again replaces
+// it.
+func (km *Keymap) RegisterSpecialKey(key tcell.Key, r rune, mods tcell.ModMask, desc string, action func()) {
+	if key != tcell.KeyRune {
+		r = 0
+	}
+	km.register(Binding{Rune: unicode.ToLower(r), Key: key, Mods: mods, Desc: desc, Action: action})
+}
+
+func (km *Keymap) register(b Binding) {
+	for i := range km.bindings {
+		if old := km.bindings[i]; old.Rune == b.Rune && old.Key == b.Key && old.Mods == b.Mods {
+			km.bindings[i] = b
+			return
+		}
+	}
+	km.bindings = append(km.bindings, b)
+}
+
+// Handle runs the action bound to r and reports whether there was one.
+func (km *Keymap) Handle(r rune) bool {
+	return km.handle(tcell.KeyRune, r, 0)
+}
+
+// HandleEvent runs the action bound to event, a special key or a rune,
+// and reports whether there was one. A rune typed with Alt or Ctrl only
+// runs a binding registered with them.
+func (km *Keymap) HandleEvent(event *tcell.EventKey) bool {
+	return km.handle(event.Key(), event.Rune(), event.Modifiers())
+}
+
+func (km *Keymap) handle(key tcell.Key, r rune, mods tcell.ModMask) bool {
+	for _, b := range km.bindings {
+		if b.matches(key, r, mods) {
+			b.Action()
+			return true
+		}
+	}
+	return false
+}
+
+func (km *Keymap) Bindings() []Binding {
+	return append([]Binding(nil), km.bindings...)
+}
+
+// Footer renders the bindings on one line, e.g. "Press 'I' (Info), 'Q' (Quit)".
+func (km *Keymap) Footer() string {
+	hints := make([]string, len(km.bindings))
+	for i, b := range km.bindings {
+		hints[i] = fmt.Sprintf("'%s' (%s)", b.Name(), b.Desc)
+	}
+	return "Press " + strings.Join(hints, ", ")
+}
+
+// Help renders the bindings one per line for a help screen.
+func (km *Keymap) Help() string {
+	var help strings.Builder
+	help.WriteString("Keys\n\n")
+	for _, b := range km.bindings {
+		fmt.Fprintf(&help, "%s  %s\n", b.Name(), b.Desc)
+	}
+	return help.String()
+}
@@ -0,0 +1,53 @@
+package logger
+
+import (
+	"testing"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+func TestKeymapHandleEvent(t *testing.T) {
+	var ran string
+	km := NewKeymap()
+	km.RegisterKey('c', "Context", func() { ran = "context" })
+	km.RegisterSpecialKey(tcell.KeyRune, 'C', tcell.ModAlt, "Match Case", func() { ran = "match case" })
+	km.RegisterSpecialKey(tcell.KeyEsc, 0, 0, "Clear Search", func() { ran = "clear" })
+
+	tests := []struct {
+		name  string
+		event *tcell.EventKey
+		want  string
+	}{
+		{"rune", tcell.NewEventKey(tcell.KeyRune, 'c', tcell.ModNone), "context"},
+		{"capital", tcell.NewEventKey(tcell.KeyRune, 'C', tcell.ModShift), "context"},
+		{"alt", tcell.NewEventKey(tcell.KeyRune, 'c', tcell.ModAlt), "match case"},
+		{"special", tcell.NewEventKey(tcell.KeyEsc, 0, tcell.ModNone), "clear"},
+		{"alt of a plain binding", tcell.NewEventKey(tcell.KeyRune, 'x', tcell.ModAlt), ""},
+		{"unbound", tcell.NewEventKey(tcell.KeyTab, 0, tcell.ModNone), ""},
+	}
+	for _, tt := range tests {
+		ran = ""
+		if handled := km.HandleEvent(tt.event); handled != (tt.want != "") || ran != tt.want {
+			t.Errorf("%s: HandleEvent ran %q, handled %v, want %q", tt.name, ran, handled, tt.want)
+		}
+	}
+}
+
+func TestKeymapText(t *testing.T) {
+	km := NewKeymap()
+	km.RegisterKey('q', "Quit", func() {})
+	km.RegisterSpecialKey(tcell.KeyRune, 'c', tcell.ModAlt, "Match Case", func() {})
+	km.RegisterSpecialKey(tcell.KeyEsc, 0, 0, "Clear Search", func() {})
+	if got, want := km.Footer(), "Press 'Q' (Quit), 'Alt+C' (Match Case), 'Esc' (Clear Search)"; got != want {
+		t.Errorf("Footer() = %q, want %q", got, want)
+	}
+	if got, want := km.Help(), "Keys\n\nQ  Quit\nAlt+C  Match Case\nEsc  Clear Search\n"; got != want {
+		t.Errorf("Help() = %q, want %q", got, want)
+	}
+
+	// Registering again replaces the binding in place
+	km.RegisterSpecialKey(tcell.KeyEsc, 0, 0, "Back", func() {})
+	if got := len(km.Bindings()); got != 3 {
+		t.Errorf("%d bindings after re-registering Esc, want 3", got)
+	}
+}
@@ -0,0 +1,127 @@
+package logger
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/gdamore/tcell/v2"
+)
+
+// SetLogFile appends every log AddLog stores from now on to the file at
+// path, creating it if need be. Each line is the log's arrival time,
+// stamped in UTC, a tab and the log with its color markup stripped.
+// Backslashes and line breaks in the log are escaped, as \\, \n and \r,
+// so a multi-line log, such as a stack trace, stays one line of the
+// file. LoadFromFile reads such a file back. An empty path stops writing.
+func (lm *LogManager) SetLogFile(path string) error {
+	var file *os.File
+	if path != "" {
+		var err error
+		if file, err = os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644); err != nil {
+			return err
+		}
+	}
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	old := lm.file
+	lm.file = file
+	if old != nil {
+		return old.Close()
+	}
+	return nil
+}
+
+// CloseLogFile stops writing logs to the file set by SetLogFile.
+func (lm *LogManager) CloseLogFile() error {
+	return lm.SetLogFile("")
+}
+
+// LoadFromFile stores the logs in a file written through SetLogFile, as
+// if they had just arrived but without writing them out again, and
+// returns how many it read. A missing file loads nothing. Lines are read
+// whatever their length, as the server may have stored messages of up to
+// its maximum message size, or more with a prefix.
+func (lm *LogManager) LoadFromFile(path string) (int, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	n := 0
+	r := bufio.NewReader(file)
+	for {
+		line, err := r.ReadString('\n')
+		if errors.Is(err, io.EOF) && line == "" {
+			break
+		} else if err != nil && !errors.Is(err, io.EOF) {
+			return n, fmt.Errorf("reading %s: %w", path, err)
+		}
+		line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+		if line == "" {
+			continue
+		}
+		// Lines missing the arrival time are taken as the log itself,
+		// arriving now
+		e := entry{log: line, arrived: lm.clock.Now()}
+		if ts, log, ok := strings.Cut(line, "\t"); ok {
+			e.log = log
+			if arrived, ok := ParseTimestamp(ts); ok {
+				e.arrived = arrived
+			}
+		}
+		e.log = fileUnescaper.Replace(e.log)
+		lm.storeLocked(e)
+		n++
+	}
+	return n, nil
+}
+
+// writeFileLocked appends e to the log file, if there is one. A failed
+// write loses that log from the file only; the file stays open for the
+// next.
+func (lm *LogManager) writeFileLocked(e entry) {
+	if lm.file == nil {
+		return
+	}
+	fmt.Fprintf(lm.file, "%s\t%s\n", FormatTimestamp(e.arrived, true), fileEscaper.Replace(StripColorTags(e.log)))
+}
+
+// fileEscaper and fileUnescaper keep a log on one line of the log file.
+var (
+	fileEscaper   = strings.NewReplacer(`\`, `\\`, "\n", `\n`, "\r", `\r`)
+	fileUnescaper = strings.NewReplacer(`\\`, `\`, `\n`, "\n", `\r`, "\r")
+)
+
+var (
+	ansiEscape = regexp.MustCompile(`\x1b\[[0-9;]*[A-Za-z]`)
+	colorTag   = regexp.MustCompile(`\[([a-zA-Z]+|#[0-9a-fA-F]{6}|-)?(:([a-zA-Z]+|#[0-9a-fA-F]{6}|-)?)?(:[lbidrus-]*)?\]`)
+)
+
+// StripColorTags removes ANSI color escapes and tview color tags such as
+// "[green]", "[-]" or "[red:black:b]" from log. Bracketed words that
+// aren't colors, like "[INFO]", are kept.
+func StripColorTags(log string) string {
+	log = ansiEscape.ReplaceAllString(log, "")
+	return colorTag.ReplaceAllStringFunc(log, func(tag string) string {
+		parts := colorTag.FindStringSubmatch(tag)
+		if parts[1] == "" && parts[2] == "" && parts[4] == "" {
+			return tag
+		}
+		for _, color := range []string{parts[1], parts[3]} {
+			if _, named := tcell.ColorNames[strings.ToLower(color)]; color != "" && color != "-" && !named && !strings.HasPrefix(color, "#") {
+				return tag
+			}
+		}
+		return ""
+	})
+}
@@ -0,0 +1,91 @@
+package logger
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLogFileRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		log  string
+	}{
+		{"plain", "2024-01-01 10:00:00 INFO: started"},
+		{"stack trace", "2024-01-01 10:00:00 ERROR: panic: boom\n\ngoroutine 1 [running]:\nmain.main()\n\t/src/main.go:12 +0x1d"},
+		{"backslashes", `2024-01-01 10:00:00 WARNING: path C:\temp\new and a literal \n`},
+		{"carriage return", "2024-01-01 10:00:00 INFO: one\r\ntwo"},
+		{"trailing backslash", `2024-01-01 10:00:00 INFO: ends in \`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "logs.txt")
+			clock := newFakeClock()
+			written := NewLogManager(0)
+			written.SetClock(clock)
+			if err := written.SetLogFile(path); err != nil {
+				t.Fatal(err)
+			}
+			written.AddLog(tt.log)
+			written.CloseLogFile()
+
+			loaded := NewLogManager(0)
+			if _, err := loaded.LoadFromFile(path); err != nil {
+				t.Fatalf("LoadFromFile: %v", err)
+			}
+			logs := loaded.GetFilteredLogs("ALL")
+			if len(logs) != 1 || logs[0] != tt.log {
+				t.Fatalf("reloaded %q, want [%q]", logs, tt.log)
+			}
+			if got := loaded.Arrived(0); !got.Equal(clock.Now().Truncate(time.Second)) {
+				t.Errorf("arrived %v, want %v", got, clock.Now())
+			}
+		})
+	}
+}
+
+func TestLoadFromFileLongLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs.txt")
+	long := "2024-01-01 10:00:00 INFO: " + strings.Repeat("x", DefaultMaxMessageSize)
+	written := NewLogManager(0)
+	if err := written.SetLogFile(path); err != nil {
+		t.Fatal(err)
+	}
+	written.AddLog(long)
+	written.AddLog("2024-01-01 10:00:01 ERROR: after the long one")
+	written.CloseLogFile()
+
+	loaded := NewLogManager(0)
+	n, err := loaded.LoadFromFile(path)
+	if err != nil {
+		t.Fatalf("LoadFromFile: %v", err)
+	}
+	logs := loaded.GetFilteredLogs("ALL")
+	if n != 2 || len(logs) != 2 || logs[0] != long || logs[1] != "2024-01-01 10:00:01 ERROR: after the long one" {
+		t.Errorf("loaded %d logs, want the long log and the one after it", n)
+	}
+}
+
+func TestStripColorTags(t *testing.T) {
+	tests := []struct {
+		log  string
+		want string
+	}{
+		{"[green]INFO:[-] started", "INFO: started"},
+		{"[red:black:b]ERROR[-:-:-] disk full", "ERROR disk full"},
+		{"[#ff8800]warm[white] and [:blue]on blue[:-]", "warm and on blue"},
+		{"\x1b[31mERROR\x1b[0m: disk \x1b[1;33mfull\x1b[m", "ERROR: disk full"},
+		// Brackets that aren't colors stay
+		{"[INFO] [component] started [5]", "[INFO] [component] started [5]"},
+		{"[] and [::1]:7051", "[] and [::1]:7051"},
+		{"[::]defaults", "defaults"},
+		{"[Green]not yet[-]", "not yet"},
+		{"plain", "plain"},
+	}
+	for _, tt := range tests {
+		if got := StripColorTags(tt.log); got != tt.want {
+			t.Errorf("StripColorTags(%q) = %q, want %q", tt.log, got, tt.want)
+		}
+	}
+}
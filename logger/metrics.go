@@ -0,0 +1,95 @@
+package logger
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// heartbeatSweep is how often a server with metrics looks for clients
+// that have stopped sending heartbeats.
+const heartbeatSweep = time.Second
+
+// metrics are the counters a server exposes for Prometheus, in a registry
+// of its own so several servers in one process don't collide.
+type metrics struct {
+	registry *prometheus.Registry
+	logs     *prometheus.CounterVec
+	timeouts prometheus.Counter
+}
+
+func newMetrics(s *Server) *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+		logs: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "logs_received_total",
+			Help: "Logs received from clients, by level.",
+		}, []string{"level"}),
+		timeouts: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "heartbeat_timeouts_total",
+			Help: "Times a client went longer than the heartbeat timeout without sending anything.",
+		}),
+	}
+	m.registry.MustRegister(m.logs, m.timeouts, prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "clients_connected",
+		Help: "Clients connected and still sending heartbeats.",
+	}, func() float64 { return float64(s.ConnectedClients()) }))
+	return m
+}
+
+// countLog counts a log received from a client under its level, in lower
+// case, or "none" when it has none.
+func (m *metrics) countLog(log string) {
+	level, _, _ := ParseLogLine(log)
+	if level == "" {
+		level = "none"
+	}
+	m.logs.WithLabelValues(strings.ToLower(level)).Inc()
+}
+
+func (m *metrics) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{}))
+	return mux
+}
+
+// SetMetricsAddr has Start also serve Prometheus metrics at /metrics on
+// addr, over plain HTTP: logs_received_total by level, clients_connected
+// and heartbeat_timeouts_total. "", the default, serves none. Call before
+// Start.
+func (s *Server) SetMetricsAddr(addr string) {
+	s.metricsAddr = addr
+}
+
+// sweepHeartbeats runs countTimeouts every heartbeatSweep until the server
+// stops.
+func (s *Server) sweepHeartbeats() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(heartbeatSweep)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.done:
+			return
+		}
+		s.countTimeouts()
+	}
+}
+
+// countTimeouts counts each client that has gone quiet for longer than
+// the heartbeat timeout, once until it is heard from again.
+func (s *Server) countTimeouts() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.clock.Now()
+	for _, c := range s.clients {
+		if !c.timedOut && !c.state.Alive(now) {
+			c.timedOut = true
+			s.metrics.timeouts.Inc()
+		}
+	}
+}
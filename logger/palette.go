@@ -0,0 +1,104 @@
+package logger
+
+import "sync"
+
+// sourcePalette are the accent colors handed to sources in turn, picked
+// to stand apart from the green/yellow/red of the levels.
+var sourcePalette = []string{"cyan", "fuchsia", "orange", "skyblue", "violet", "gold", "teal", "pink"}
+
+// SourceColors gives each source, such as a connection's address, its
+// own accent color so streams at the same level can still be told apart.
+// Colors cycle through the palette and a source keeps the one it gets.
+type SourceColors struct {
+	mu     sync.Mutex
+	colors map[string]string
+}
+
+func NewSourceColors() *SourceColors {
+	return &SourceColors{colors: make(map[string]string)}
+}
+
+func (sc *SourceColors) Color(source string) string {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	color, ok := sc.colors[source]
+	if !ok {
+		color = sourcePalette[len(sc.colors)%len(sourcePalette)]
+		sc.colors[source] = color
+	}
+	return color
+}
+
+// LevelPalette is a set of level colors, with an optional symbol drawn in
+// front of each log so levels can be told apart without relying on hue.
+type LevelPalette struct {
+	Name    string
+	About   string
+	Colors  map[string]string
+	Symbols map[string]string
+}
+
+// Color returns the color of level, or "" for none.
+func (p LevelPalette) Color(level string) string {
+	return p.Colors[level]
+}
+
+// Symbol returns what is drawn in front of a log at level, or "".
+func (p LevelPalette) Symbol(level string) string {
+	return p.Symbols[level]
+}
+
+// levelSymbols mark each level by shape, for palettes that can't count
+// on every hue being seen
+var levelSymbols = map[string]string{"TRACE": "[t] ", "DEBUG": "[d] ", "INFO": "[i] ", "WARNING": "[*] ", "ERROR": "[!] "}
+
+// LevelPalettes are the built-in palettes, the default first. The
+// colorblind-safe ones take their hues from the Okabe-Ito palette.
+var LevelPalettes = []LevelPalette{
+	{
+		Name:   "default",
+		About:  "green, yellow and red",
+		Colors: map[string]string{"TRACE": "darkgray", "DEBUG": "gray", "INFO": "green", "WARNING": "yellow", "ERROR": "red"},
+	},
+	{
+		// Red-green colorblindness, the most common kind, also covers
+		// protanopia
+		Name:    "deuteranopia",
+		About:   "blue, yellow and vermillion, safe for red-green colorblindness",
+		Colors:  map[string]string{"TRACE": "darkgray", "DEBUG": "gray", "INFO": "#0072B2", "WARNING": "#F0E442", "ERROR": "#D55E00"},
+		Symbols: levelSymbols,
+	},
+	{
+		// Blue-yellow colorblindness
+		Name:    "tritanopia",
+		About:   "bluish green, orange and reddish purple, safe for blue-yellow colorblindness",
+		Colors:  map[string]string{"TRACE": "darkgray", "DEBUG": "gray", "INFO": "#009E73", "WARNING": "#E69F00", "ERROR": "#CC79A7"},
+		Symbols: levelSymbols,
+	},
+	{
+		// No color at all, for monochrome terminals or full colorblindness
+		Name:    "mono",
+		About:   "no color, levels marked by symbol alone",
+		Colors:  map[string]string{"TRACE": "white", "DEBUG": "white", "INFO": "white", "WARNING": "white", "ERROR": "white"},
+		Symbols: levelSymbols,
+	},
+}
+
+// FindPalette returns the built-in palette called name.
+func FindPalette(name string) (LevelPalette, bool) {
+	for _, palette := range LevelPalettes {
+		if palette.Name == name {
+			return palette, true
+		}
+	}
+	return LevelPalette{}, false
+}
+
+// PaletteNames lists the built-in palettes' names.
+func PaletteNames() []string {
+	names := make([]string, len(LevelPalettes))
+	for i, palette := range LevelPalettes {
+		names[i] = palette.Name
+	}
+	return names
+}
@@ -0,0 +1,30 @@
+package logger
+
+import "testing"
+
+func TestSourceColors(t *testing.T) {
+	sc := NewSourceColors()
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{"10.0.0.1:5000", sourcePalette[0]},
+		{"10.0.0.2:5000", sourcePalette[1]},
+		// A source keeps the color it was given
+		{"10.0.0.1:5000", sourcePalette[0]},
+		{"10.0.0.3:5000", sourcePalette[2]},
+	}
+	for _, tt := range tests {
+		if got := sc.Color(tt.source); got != tt.want {
+			t.Errorf("Color(%q) = %q, want %q", tt.source, got, tt.want)
+		}
+	}
+
+	// Past the end of the palette colors cycle
+	for i := 3; i < len(sourcePalette); i++ {
+		sc.Color(string(rune('a' + i)))
+	}
+	if got := sc.Color("one more"); got != sourcePalette[0] {
+		t.Errorf("Color() past the palette = %q, want %q again", got, sourcePalette[0])
+	}
+}
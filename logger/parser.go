@@ -0,0 +1,222 @@
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParsedLog is a log split into the parts the server files it by.
+type ParsedLog struct {
+	Timestamp string
+	Level     string
+	Message   string
+}
+
+// String formats the log the way the clients format theirs,
+// "<timestamp> <LEVEL>: <message>", leaving out what is missing. A level
+// the message already mentions is not repeated.
+func (p ParsedLog) String() string {
+	log := p.Message
+	if p.Level != "" && !strings.Contains(log, p.Level) {
+		log = p.Level + ": " + log
+	}
+	if p.Timestamp != "" {
+		log = p.Timestamp + " " + log
+	}
+	return log
+}
+
+// Parser reads one log format. Parse never fails; a log that isn't in
+// the format comes back as a plain one.
+type Parser interface {
+	Parse(raw string) ParsedLog
+}
+
+// Formats are the names ParseFormat accepts.
+var Formats = []string{"plain", "json", "logfmt"}
+
+// ParseFormat returns the parser for a format named in Formats.
+func ParseFormat(name string) (Parser, error) {
+	switch strings.ToLower(name) {
+	case "", "plain":
+		return PlainParser{}, nil
+	case "json":
+		return JSONParser{}, nil
+	case "logfmt":
+		return LogfmtParser{}, nil
+	}
+	return nil, fmt.Errorf("unknown format %q, want one of %s", name, strings.Join(Formats, ", "))
+}
+
+// ParseLogLine reads a log's level, message and timestamp whatever format
+// its client wrote it in: a JSON object as JSONParser does, with the level
+// looked for in the message when it has no level field, and anything else
+// as PlainParser does. ts is zero when the log has no timestamp placing
+// it in time.
+func ParseLogLine(raw string) (level, message string, ts time.Time) {
+	var parsed ParsedLog
+	if strings.HasPrefix(strings.TrimSpace(raw), "{") {
+		if parsed = (JSONParser{}).Parse(raw); parsed.Level == "" {
+			parsed.Level = DetectLevel(parsed.Message)
+		}
+	} else {
+		parsed = PlainParser{}.Parse(raw)
+	}
+	ts, _ = ParseTimestamp(parsed.Timestamp)
+	return parsed.Level, parsed.Message, ts
+}
+
+// PlainParser reads logs as the clients write them: an optional leading
+// timestamp, then the message, whose level is the first one it mentions.
+type PlainParser struct{}
+
+func (PlainParser) Parse(raw string) ParsedLog {
+	parsed := ParsedLog{Message: raw}
+	if loc := leadingTimestamp.FindStringIndex(raw); loc != nil {
+		parsed.Timestamp = strings.TrimSpace(raw[:loc[1]])
+		parsed.Message = raw[loc[1]:]
+	}
+	parsed.Level = DetectLevel(parsed.Message)
+	return parsed
+}
+
+// JSONParser reads one JSON object per log, such as
+// {"time":"...","level":"error","msg":"..."}. Fields other than the
+// timestamp, level and message are kept after the message as key=value.
+type JSONParser struct{}
+
+func (JSONParser) Parse(raw string) ParsedLog {
+	var object map[string]any
+	if err := json.Unmarshal([]byte(raw), &object); err != nil || object == nil {
+		return PlainParser{}.Parse(raw)
+	}
+	fields := make(map[string]string, len(object))
+	for key, value := range object {
+		switch value := value.(type) {
+		case string:
+			fields[key] = value
+		case float64:
+			fields[key] = strconv.FormatFloat(value, 'f', -1, 64)
+		default:
+			data, _ := json.Marshal(value)
+			fields[key] = string(data)
+		}
+	}
+	return parseFields(fields)
+}
+
+// LogfmtParser reads logs of key=value pairs, values quoted when they hold
+// spaces, such as `time=... level=warn msg="disk almost full"`.
+type LogfmtParser struct{}
+
+func (LogfmtParser) Parse(raw string) ParsedLog {
+	fields, ok := splitLogfmt(raw)
+	if !ok {
+		return PlainParser{}.Parse(raw)
+	}
+	return parseFields(fields)
+}
+
+// The keys structured formats commonly use for each part, in preference
+// order
+var (
+	timestampKeys = []string{"time", "timestamp", "ts", "@timestamp"}
+	levelKeys     = []string{"level", "lvl", "severity"}
+	messageKeys   = []string{"msg", "message"}
+)
+
+// parseFields picks the timestamp, level and message out of a structured
+// log's fields and appends the rest to the message, sorted by key.
+func parseFields(fields map[string]string) ParsedLog {
+	take := func(keys []string) string {
+		for _, key := range keys {
+			if value, ok := fields[key]; ok {
+				delete(fields, key)
+				return value
+			}
+		}
+		return ""
+	}
+	parsed := ParsedLog{
+		Timestamp: normalizeTimestamp(take(timestampKeys)),
+		Level:     normalizeLevel(take(levelKeys)),
+		Message:   take(messageKeys),
+	}
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		value := fields[key]
+		if strings.ContainsAny(value, " \t\"=") {
+			value = strconv.Quote(value)
+		}
+		parsed.Message = strings.TrimSpace(parsed.Message + " " + key + "=" + value)
+	}
+	return parsed
+}
+
+// normalizeTimestamp restamps a timestamp the server can place in time,
+// including Unix seconds, in local time as the clients stamp theirs.
+func normalizeTimestamp(ts string) string {
+	if t, ok := ParseTimestamp(ts); ok {
+		return FormatTimestamp(t, false)
+	}
+	if seconds, err := strconv.ParseFloat(ts, 64); err == nil {
+		whole, frac := math.Modf(seconds)
+		return FormatTimestamp(time.Unix(int64(whole), int64(frac*1e9)), false)
+	}
+	return ts
+}
+
+// normalizeLevel maps the usual spellings of a level onto Levels. Others
+// are kept, upper-cased.
+func normalizeLevel(level string) string {
+	switch level = strings.ToUpper(level); level {
+	case "WARN":
+		return "WARNING"
+	case "ERR", "FATAL", "CRITICAL":
+		return "ERROR"
+	}
+	return level
+}
+
+// splitLogfmt splits a logfmt line into its fields, reporting false when
+// it has none or isn't logfmt.
+func splitLogfmt(line string) (map[string]string, bool) {
+	fields := make(map[string]string)
+	rest := strings.TrimSpace(line)
+	for rest != "" {
+		key, after, ok := strings.Cut(rest, "=")
+		if !ok || key == "" || strings.ContainsAny(key, " \t\"") {
+			return nil, false
+		}
+		var value string
+		if strings.HasPrefix(after, `"`) {
+			quoted, err := strconv.QuotedPrefix(after)
+			if err != nil {
+				return nil, false
+			}
+			value, _ = strconv.Unquote(quoted)
+			after = after[len(quoted):]
+		} else {
+			end := strings.IndexAny(after, " \t")
+			if end < 0 {
+				end = len(after)
+			}
+			value, after = after[:end], after[end:]
+		}
+		if after != "" && after[0] != ' ' && after[0] != '\t' {
+			return nil, false
+		}
+		fields[key] = value
+		rest = strings.TrimSpace(after)
+	}
+	return fields, len(fields) > 0
+}
@@ -0,0 +1,100 @@
+package logger
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseFormat(t *testing.T) {
+	tests := []struct {
+		name string
+		want Parser
+	}{
+		{"", PlainParser{}},
+		{"plain", PlainParser{}},
+		{"JSON", JSONParser{}},
+		{"logfmt", LogfmtParser{}},
+	}
+	for _, tt := range tests {
+		if got, err := ParseFormat(tt.name); err != nil || got != tt.want {
+			t.Errorf("ParseFormat(%q) = %T, %v, want %T", tt.name, got, err, tt.want)
+		}
+	}
+	if _, err := ParseFormat("xml"); err == nil {
+		t.Error("ParseFormat(\"xml\") accepted an unknown format")
+	}
+}
+
+func TestParsers(t *testing.T) {
+	stamp := FormatTimestamp(time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC), false)
+	tests := []struct {
+		name   string
+		parser Parser
+		raw    string
+		want   ParsedLog
+	}{
+		{"plain", PlainParser{}, "2024-01-01 10:00:00 ERROR: disk full", ParsedLog{"2024-01-01 10:00:00", "ERROR", "ERROR: disk full"}},
+		{"plain time only", PlainParser{}, "10:00:00 took a WARNING", ParsedLog{"10:00:00", "WARNING", "took a WARNING"}},
+		{"plain first level", PlainParser{}, "INFO: an ERROR was handled", ParsedLog{"", "INFO", "INFO: an ERROR was handled"}},
+		{"plain no level", PlainParser{}, "hello", ParsedLog{"", "", "hello"}},
+		{
+			"json", JSONParser{},
+			`{"time":"2024-01-01T10:00:00Z","level":"warn","msg":"disk almost full","disk":"/dev/sda","pct":91.5}`,
+			ParsedLog{stamp, "WARNING", "disk almost full disk=/dev/sda pct=91.5"},
+		},
+		{"json unix time", JSONParser{}, `{"ts":1704103200,"severity":"fatal","message":"down"}`, ParsedLog{stamp, "ERROR", "down"}},
+		{"json nested", JSONParser{}, `{"msg":"hi","tags":["a b"]}`, ParsedLog{"", "", `hi tags="[\"a b\"]"`}},
+		{"json not json", JSONParser{}, "{INFO: braces", ParsedLog{"", "INFO", "{INFO: braces"}},
+		{
+			"logfmt", LogfmtParser{},
+			`time=2024-01-01T10:00:00Z level=err msg="disk full" host=db1 cause="a b"`,
+			ParsedLog{stamp, "ERROR", `disk full cause="a b" host=db1`},
+		},
+		{"logfmt unknown level", LogfmtParser{}, "lvl=notice msg=up", ParsedLog{"", "NOTICE", "up"}},
+		{"logfmt not logfmt", LogfmtParser{}, "INFO: x=1 happened", ParsedLog{"", "INFO", "INFO: x=1 happened"}},
+		{"logfmt bad quote", LogfmtParser{}, `msg="open`, ParsedLog{"", "", `msg="open`}},
+	}
+	for _, tt := range tests {
+		if got := tt.parser.Parse(tt.raw); got != tt.want {
+			t.Errorf("%s: Parse(%q) = %+v, want %+v", tt.name, tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestParsedLogString(t *testing.T) {
+	tests := []struct {
+		parsed ParsedLog
+		want   string
+	}{
+		{ParsedLog{"2024-01-01 10:00:00", "ERROR", "disk full"}, "2024-01-01 10:00:00 ERROR: disk full"},
+		{ParsedLog{"", "ERROR", "ERROR: disk full"}, "ERROR: disk full"},
+		{ParsedLog{"", "", "hello"}, "hello"},
+	}
+	for _, tt := range tests {
+		if got := tt.parsed.String(); got != tt.want {
+			t.Errorf("%+v.String() = %q, want %q", tt.parsed, got, tt.want)
+		}
+	}
+}
+
+func TestParseLogLine(t *testing.T) {
+	at := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	tests := []struct {
+		raw     string
+		level   string
+		message string
+		ts      time.Time
+	}{
+		{"2024-01-01T10:00:00Z WARNING: slow", "WARNING", "WARNING: slow", at},
+		{`{"time":"2024-01-01T10:00:00Z","level":"info","msg":"up"}`, "INFO", "up", at},
+		// A JSON log without a level field is given the one it mentions
+		{` {"msg":"ERROR: down"}`, "ERROR", "ERROR: down", time.Time{}},
+		{"10:00:00 INFO: no date", "INFO", "INFO: no date", time.Time{}},
+	}
+	for _, tt := range tests {
+		level, message, ts := ParseLogLine(tt.raw)
+		if level != tt.level || message != tt.message || !ts.Equal(tt.ts) {
+			t.Errorf("ParseLogLine(%q) = %q, %q, %v, want %q, %q, %v", tt.raw, level, message, ts, tt.level, tt.message, tt.ts)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package logger
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+)
+
+// Prefs are an app's settings kept between runs, stored as a JSON object
+// in <user config dir>/TerminalUI/<app>.json. A missing or unreadable file
+// just means every setting is at its default.
+type Prefs struct {
+	path string
+
+	mu     sync.Mutex
+	values map[string]string
+}
+
+func LoadPrefs(app string) *Prefs {
+	p := &Prefs{values: make(map[string]string)}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return p
+	}
+	p.path = filepath.Join(dir, "TerminalUI", app+".json")
+	if data, err := os.ReadFile(p.path); err == nil {
+		json.Unmarshal(data, &p.values)
+	}
+	return p
+}
+
+// Get returns the value of key, or fallback when it isn't set.
+func (p *Prefs) Get(key, fallback string) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if value, ok := p.values[key]; ok {
+		return value
+	}
+	return fallback
+}
+
+// Set stores value under key and saves the prefs straight away.
+func (p *Prefs) Set(key, value string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.values[key] = value
+	if p.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(p.values, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(p.path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(p.path, data, 0o644)
+}
+
+func (p *Prefs) Bool(key string, fallback bool) bool {
+	value, err := strconv.ParseBool(p.Get(key, strconv.FormatBool(fallback)))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+func (p *Prefs) SetBool(key string, value bool) error {
+	return p.Set(key, strconv.FormatBool(value))
+}
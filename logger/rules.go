@@ -0,0 +1,35 @@
+package logger
+
+import "strings"
+
+// LevelRule recategorizes logs containing Match, ignoring case, as Level,
+// e.g. anything mentioning DEPRECATED as a WARNING whatever it says.
+type LevelRule struct {
+	Match string `json:"match"`
+	Level string `json:"level"`
+}
+
+// LevelRules are tried in order and the first match wins. They change how
+// a log is shown and filtered, never the stored log.
+type LevelRules []LevelRule
+
+// Level returns the level log falls under: the first matching rule's,
+// upper-cased, or the one ParseLogLine reads when none match.
+func (rules LevelRules) Level(log string) string {
+	if rule, ok := rules.Match(log); ok {
+		return strings.ToUpper(rule.Level)
+	}
+	level, _, _ := ParseLogLine(log)
+	return level
+}
+
+// Match returns the first rule matching log.
+func (rules LevelRules) Match(log string) (LevelRule, bool) {
+	upper := strings.ToUpper(log)
+	for _, rule := range rules {
+		if rule.Match != "" && strings.Contains(upper, strings.ToUpper(rule.Match)) {
+			return rule, true
+		}
+	}
+	return LevelRule{}, false
+}
@@ -0,0 +1,78 @@
+package logger
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestLevelRules(t *testing.T) {
+	rules := LevelRules{
+		{Match: "deprecated", Level: "WARNING"},
+		{Match: "", Level: "ERROR"},
+		{Match: "timeout", Level: "ERROR"},
+		{Match: "retrying", Level: "INFO"},
+		{Match: "panic", Level: "error"},
+	}
+	tests := []struct {
+		log   string
+		level string
+		rule  bool
+	}{
+		{"INFO: DEPRECATED flag -x", "WARNING", true},
+		{"ERROR: deprecated call failed", "WARNING", true},
+		{"WARNING: timeout, retrying", "ERROR", true},
+		{"INFO: retrying", "INFO", true},
+		{"ERROR: disk full", "ERROR", false},
+		{"no level", "", false},
+		{"INFO: recovered from panic", "ERROR", true},
+	}
+	for _, tt := range tests {
+		if got := rules.Level(tt.log); got != tt.level {
+			t.Errorf("Level(%q) = %q, want %q", tt.log, got, tt.level)
+		}
+		if _, ok := rules.Match(tt.log); ok != tt.rule {
+			t.Errorf("Match(%q) matched %v, want %v", tt.log, ok, tt.rule)
+		}
+	}
+	if level := LevelRules(nil).Level("WARNING: slow"); level != "WARNING" {
+		t.Errorf("no rules: Level() = %q, want the log's own WARNING", level)
+	}
+}
+
+func TestLogManagerLevelRules(t *testing.T) {
+	lm := NewLogManager(0)
+	lm.SetLevelRules(LevelRules{{Match: "deprecated", Level: "WARNING"}})
+	for _, log := range []string{"INFO: started", "INFO: deprecated flag", "ERROR: disk full"} {
+		lm.AddLog(log)
+	}
+	tests := []struct {
+		level string
+		want  []string
+	}{
+		{"INFO", []string{"INFO: started"}},
+		{"WARNING", []string{"INFO: deprecated flag"}},
+		{"warning", []string{"INFO: deprecated flag"}},
+		{"ERROR", []string{"ERROR: disk full"}},
+	}
+	for _, tt := range tests {
+		if got := lm.GetFilteredLogs(tt.level); !slices.Equal(got, tt.want) {
+			t.Errorf("GetFilteredLogs(%q) = %q, want %q", tt.level, got, tt.want)
+		}
+	}
+}
+
+func TestLogManagerLowercaseRuleErrors(t *testing.T) {
+	lm := NewLogManager(0)
+	lm.SetLevelRules(LevelRules{{Match: "panic", Level: "error"}})
+	lm.AddLog("INFO: recovered from panic")
+	lm.AddLog("INFO: recovered from panic")
+	if got := lm.ActiveErrors(); got != 2 {
+		t.Errorf("ActiveErrors() = %d, want 2 for an \"error\" rule", got)
+	}
+	if top := lm.TopErrors(1); len(top) != 1 || top[0].Count != 2 {
+		t.Errorf("TopErrors(1) = %v, want the rule's log twice", top)
+	}
+	if !lm.AckLastError() || lm.ActiveErrors() != 1 {
+		t.Errorf("AckLastError() left %d active errors, want 1", lm.ActiveErrors())
+	}
+}
@@ -0,0 +1,1145 @@
+package logger
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// DefaultHeartbeatTimeout is how long a client may go without a
+// heartbeat before it is no longer reported as connected, unless
+// SetHeartbeatTimeout says otherwise. A timeout should be at least twice
+// the interval clients send heartbeats at, so that one late heartbeat
+// isn't taken for a lost client.
+const DefaultHeartbeatTimeout = 3 * time.Second
+
+const (
+	// Probe, sent as a connection's first message, asks whether a logger
+	// server is listening; it answers ProbeReply and hangs up, leaving its
+	// clients alone.
+	Probe      = "_PROBE_"
+	ProbeReply = "_SERVER_LOGGER_"
+)
+
+var ErrAlreadyRunning = errors.New("another SERVER LOGGER is already running")
+
+// ackWriteTimeout bounds writing an Ack, so a client that never reads
+// them can't stall the connection once its buffer fills.
+const ackWriteTimeout = time.Second
+
+// stopTimeout bounds how long Stop waits for the server's goroutines to
+// finish. Of that, clients get closeGrace to hang up, enough for any that
+// read to see EOF and for what they already sent to be read.
+const (
+	stopTimeout = 2 * time.Second
+	closeGrace  = 250 * time.Millisecond
+)
+
+// LogManager keeps the logs a server has received, raw and in arrival
+// order, with the time each arrived. UIs colorize them when they render.
+// Each log has a sequence number, its position counting dropped logs too,
+// which stays the same as older logs are dropped.
+type LogManager struct {
+	mu      sync.Mutex
+	logs    []entry
+	clock   Clock // stamps arrival times
+	limit   int
+	dropped int // logs before the first kept, cleared ones included
+	cleared int
+	acked   map[int]bool
+	rules   LevelRules
+	counts  map[string]int // logs stored at each level, dropped ones too
+
+	caseSensitive bool // searches match case exactly
+
+	// The last search compiled, kept so a query typed a key at a time
+	// isn't recompiled for every pane and every redraw
+	search searchCache
+
+	// Sequence numbers of the logs carrying each request ID, oldest first
+	idPattern *regexp.Regexp
+	ids       map[string][]int
+
+	file *os.File // set by SetLogFile
+}
+
+// entry is one stored log and when it arrived.
+type entry struct {
+	log     string
+	arrived time.Time
+}
+
+// NewLogManager returns a LogManager keeping the most recent maxEntries
+// logs, as SetLimit does. 0 keeps everything.
+func NewLogManager(maxEntries int) *LogManager {
+	return &LogManager{limit: maxEntries, clock: RealClock}
+}
+
+// SetClock replaces the clock logs are stamped with as they arrive.
+func (lm *LogManager) SetClock(clock Clock) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	lm.clock = clock
+}
+
+// SetIDPattern sets the pattern request IDs are recognized by, indexing
+// every log kept so far. Its first group, or else the whole match, is the
+// ID. nil stops recognizing them.
+func (lm *LogManager) SetIDPattern(pattern *regexp.Regexp) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	lm.idPattern = pattern
+	lm.ids = make(map[string][]int)
+	for i, e := range lm.logs {
+		lm.indexLocked(e.log, lm.dropped+i)
+	}
+}
+
+// RequestID returns the request ID log carries, or "" for none.
+func (lm *LogManager) RequestID(log string) string {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	return lm.requestIDLocked(log)
+}
+
+func (lm *LogManager) requestIDLocked(log string) string {
+	if lm.idPattern == nil {
+		return ""
+	}
+	match := lm.idPattern.FindStringSubmatch(log)
+	switch {
+	case match == nil:
+		return ""
+	case len(match) > 1:
+		return match[1]
+	}
+	return match[0]
+}
+
+func (lm *LogManager) indexLocked(log string, seq int) {
+	if id := lm.requestIDLocked(log); id != "" {
+		lm.ids[id] = append(lm.ids[id], seq)
+	}
+}
+
+// GetLogsByID returns every kept log carrying request ID id, in arrival
+// order, whatever its level, with their sequence numbers.
+func (lm *LogManager) GetLogsByID(id string) ([]string, []int) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	var logs []string
+	seqs := slices.Clone(lm.ids[id])
+	for _, seq := range seqs {
+		logs = append(logs, lm.logs[seq-lm.dropped].log)
+	}
+	return logs, seqs
+}
+
+// SetLevelRules sets the rules that recategorize logs when filtering by
+// level and counting errors.
+func (lm *LogManager) SetLevelRules(rules LevelRules) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	lm.rules = rules
+}
+
+// hasLevelLocked reports whether log is at level, which may be "" for
+// any, as the level rules and ParseLogLine read it.
+func (lm *LogManager) hasLevelLocked(log, level string) bool {
+	return level == "" || strings.EqualFold(lm.rules.Level(log), level)
+}
+
+type searchCache struct {
+	query         string
+	caseSensitive bool
+	pattern       *regexp.Regexp
+	err           error
+}
+
+// CompileSearch compiles query as the search functions read it, see the
+// package-level CompileSearch, reusing the last compiled pattern when the
+// query and case mode are unchanged.
+func (lm *LogManager) CompileSearch(query string) (*regexp.Regexp, error) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	return lm.compileSearchLocked(query)
+}
+
+func (lm *LogManager) compileSearchLocked(query string) (*regexp.Regexp, error) {
+	if c := lm.search; c.query != query || c.caseSensitive != lm.caseSensitive || (c.pattern == nil && c.err == nil) {
+		pattern, err := CompileSearch(query, lm.caseSensitive)
+		lm.search = searchCache{query: query, caseSensitive: lm.caseSensitive, pattern: pattern, err: err}
+	}
+	return lm.search.pattern, lm.search.err
+}
+
+// SetCaseSensitive makes searches match case exactly, so "E500" no
+// longer finds "e500". They ignore case by default.
+func (lm *LogManager) SetCaseSensitive(caseSensitive bool) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	lm.caseSensitive = caseSensitive
+}
+
+func (lm *LogManager) CaseSensitive() bool {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	return lm.caseSensitive
+}
+
+// SetLimit caps how many logs are kept, dropping the oldest beyond it.
+// 0, the default, keeps everything.
+func (lm *LogManager) SetLimit(limit int) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	lm.limit = limit
+	lm.trimLocked()
+}
+
+func (lm *LogManager) AddLog(log string) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	e := entry{log: log, arrived: lm.clock.Now()}
+	lm.storeLocked(e)
+	lm.writeFileLocked(e)
+}
+
+func (lm *LogManager) storeLocked(e entry) {
+	log := e.log
+	lm.logs = append(lm.logs, e)
+	if level := strings.ToUpper(lm.rules.Level(log)); level != "" {
+		if lm.counts == nil {
+			lm.counts = make(map[string]int)
+		}
+		lm.counts[level]++
+	}
+	if lm.idPattern != nil {
+		lm.indexLocked(log, lm.dropped+len(lm.logs)-1)
+	}
+	lm.trimLocked()
+}
+
+// Counts returns how many logs have been stored at each level, counting
+// those since dropped. Logs are counted as they arrive, so changing the
+// level rules doesn't recount earlier ones.
+func (lm *LogManager) Counts() map[string]int {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	counts := make(map[string]int, len(lm.counts))
+	for level, n := range lm.counts {
+		counts[level] = n
+	}
+	return counts
+}
+
+// Dropped returns how many logs have been dropped to stay under the limit.
+func (lm *LogManager) Dropped() int {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	return lm.dropped - lm.cleared
+}
+
+// Clear discards every log kept, along with their acknowledgements and
+// the level counts. Sequence numbers carry on from where they were, so
+// Total still counts the cleared logs; Dropped doesn't. The log file, if
+// any, is left as it is.
+func (lm *LogManager) Clear() {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	lm.dropped += len(lm.logs)
+	lm.cleared += len(lm.logs)
+	lm.logs = nil
+	clear(lm.acked)
+	clear(lm.ids)
+	clear(lm.counts)
+}
+
+// Total returns how many logs have been stored, counting those since
+// dropped, which is one more than the newest log's sequence number.
+func (lm *LogManager) Total() int {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	return lm.dropped + len(lm.logs)
+}
+
+func (lm *LogManager) trimLocked() {
+	if lm.limit > 0 && len(lm.logs) > lm.limit {
+		over := len(lm.logs) - lm.limit
+		for _, e := range lm.logs[:over] {
+			// A dropped log is the oldest carrying its ID
+			if id := lm.requestIDLocked(e.log); id != "" {
+				if lm.ids[id] = lm.ids[id][1:]; len(lm.ids[id]) == 0 {
+					delete(lm.ids, id)
+				}
+			}
+		}
+		// Clear the dropped entries so they can be freed before append
+		// next moves the window to a new array
+		clear(lm.logs[:over])
+		lm.logs = lm.logs[over:]
+		for seq := lm.dropped; seq < lm.dropped+over; seq++ {
+			delete(lm.acked, seq)
+		}
+		lm.dropped += over
+	}
+}
+
+// GetFilteredLogs returns the logs mentioning level. "ALL" or "" returns
+// every log.
+func (lm *LogManager) GetFilteredLogs(level string) []string {
+	return lm.GetSearchFilteredLogs("", level)
+}
+
+// GetSearchFilteredLogs returns the logs at level, as GetFilteredLogs,
+// that match query as CompileSearch reads it. A multi-line message is searched
+// and returned as a whole.
+func (lm *LogManager) GetSearchFilteredLogs(query string, level string) []string {
+	logs, _ := lm.GetSearchFilteredLogSeqs(query, level)
+	return logs
+}
+
+// GetSearchFilteredLogSeqs is GetSearchFilteredLogs that also returns
+// each log's sequence number.
+func (lm *LogManager) GetSearchFilteredLogSeqs(query string, level string) ([]string, []int) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	if level == "ALL" {
+		level = ""
+	}
+	var pattern *regexp.Regexp
+	if query != "" {
+		var err error
+		if pattern, err = lm.compileSearchLocked(query); err != nil {
+			return []string{}, nil
+		}
+	}
+	filteredLogs := []string{}
+	var seqs []int
+	for i, e := range lm.logs {
+		if log := e.log; lm.hasLevelLocked(log, level) {
+			if pattern == nil || pattern.MatchString(log) {
+				filteredLogs = append(filteredLogs, log)
+				seqs = append(seqs, lm.dropped+i)
+			}
+		}
+	}
+	return filteredLogs, seqs
+}
+
+// GetContext returns the n logs either side of the log numbered seq,
+// unfiltered, and where that log falls among them. It returns nil once
+// seq has been dropped.
+func (lm *LogManager) GetContext(seq, n int) ([]string, int) {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	i := seq - lm.dropped
+	if i < 0 || i >= len(lm.logs) {
+		return nil, 0
+	}
+	start := max(0, i-n)
+	end := min(len(lm.logs), i+n+1)
+	return logsOf(lm.logs[start:end]), i - start
+}
+
+// Arrived returns when the log numbered seq arrived, or the zero time
+// once it has been dropped.
+func (lm *LogManager) Arrived(seq int) time.Time {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	if i := seq - lm.dropped; i >= 0 && i < len(lm.logs) {
+		return lm.logs[i].arrived
+	}
+	return time.Time{}
+}
+
+// Acked reports whether the log numbered seq has been acknowledged.
+func (lm *LogManager) Acked(seq int) bool {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	return lm.acked[seq]
+}
+
+// AckLastError acknowledges the newest unacknowledged ERROR log and
+// reports whether there was one.
+func (lm *LogManager) AckLastError() bool {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	for i := len(lm.logs) - 1; i >= 0; i-- {
+		if seq := lm.dropped + i; lm.rules.Level(lm.logs[i].log) == "ERROR" && !lm.acked[seq] {
+			lm.ackLocked(seq)
+			return true
+		}
+	}
+	return false
+}
+
+// AckAllErrors acknowledges every ERROR log kept so far.
+func (lm *LogManager) AckAllErrors() {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	for i, e := range lm.logs {
+		if lm.rules.Level(e.log) == "ERROR" {
+			lm.ackLocked(lm.dropped + i)
+		}
+	}
+}
+
+// ActiveErrors returns how many ERROR logs are not acknowledged.
+func (lm *LogManager) ActiveErrors() int {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	active := 0
+	for i, e := range lm.logs {
+		if lm.rules.Level(e.log) == "ERROR" && !lm.acked[lm.dropped+i] {
+			active++
+		}
+	}
+	return active
+}
+
+// ErrorCount is how many times one error message has been logged.
+type ErrorCount struct {
+	Message string
+	Count   int
+}
+
+// TopErrors returns the n most frequent ERROR messages kept, most
+// frequent first and, among equals, first seen first. Messages are
+// compared without their timestamps, so repeats count together. It
+// returns nil when n <= 0.
+func (lm *LogManager) TopErrors(n int) []ErrorCount {
+	if n <= 0 {
+		return nil
+	}
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	var counts []ErrorCount
+	index := make(map[string]int)
+	for _, e := range lm.logs {
+		log := e.log
+		if lm.rules.Level(log) != "ERROR" {
+			continue
+		}
+		message := StripTimestamp(log)
+		if i, ok := index[message]; ok {
+			counts[i].Count++
+			continue
+		}
+		index[message] = len(counts)
+		counts = append(counts, ErrorCount{Message: message, Count: 1})
+	}
+	slices.SortStableFunc(counts, func(a, b ErrorCount) int { return b.Count - a.Count })
+	return counts[:min(n, len(counts))]
+}
+
+func (lm *LogManager) ackLocked(seq int) {
+	if lm.acked == nil {
+		lm.acked = make(map[int]bool)
+	}
+	lm.acked[seq] = true
+}
+
+// CompileSearch compiles a search query. One wrapped in slashes, such as
+// "/error code 4\d\d/", is a regular expression; anything else is words
+// matched as SearchPattern does. Either ignores case unless caseSensitive.
+// An invalid expression is an error, and the search functions then find
+// nothing.
+func CompileSearch(query string, caseSensitive bool) (*regexp.Regexp, error) {
+	if len(query) < 3 || !strings.HasPrefix(query, "/") || !strings.HasSuffix(query, "/") {
+		return SearchPattern(query, caseSensitive), nil
+	}
+	pattern, err := regexp.Compile(query[1 : len(query)-1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid regular expression %s: %w", query, err)
+	}
+	if !caseSensitive {
+		pattern = regexp.MustCompile("(?i)" + pattern.String())
+	}
+	return pattern, nil
+}
+
+// SearchPattern compiles a query into a pattern, ignoring case unless
+// caseSensitive, where a run of whitespace matches any other, line breaks
+// included, so a query can match across the lines of a multi-line
+// message.
+func SearchPattern(query string, caseSensitive bool) *regexp.Regexp {
+	words := strings.Fields(query)
+	for i, word := range words {
+		words[i] = regexp.QuoteMeta(word)
+	}
+	pattern := strings.Join(words, `\s+`)
+	if !caseSensitive {
+		pattern = `(?i)` + pattern
+	}
+	return regexp.MustCompile(pattern)
+}
+
+// GetRecentLogs returns the last n logs, oldest first.
+func (lm *LogManager) GetRecentLogs(n int) []string {
+	lm.mu.Lock()
+	defer lm.mu.Unlock()
+	n = max(0, min(n, len(lm.logs)))
+	return logsOf(lm.logs[len(lm.logs)-n:])
+}
+
+// logsOf returns the logs of entries, in a new slice.
+func logsOf(entries []entry) []string {
+	logs := make([]string, len(entries))
+	for i, e := range entries {
+		logs[i] = e.log
+	}
+	return logs
+}
+
+// Server accepts logger clients and collects their logs. Any number of
+// clients are served at once, their logs merged into one LogManager. It
+// knows nothing about the UI, which renders Logs and is told of each new
+// log through the OnLog hook.
+type Server struct {
+	addr             string
+	levels           []string
+	keepBlank        bool
+	parser           Parser
+	compress         bool
+	clientPrefix     bool
+	onLog            func(string)
+	logs             *LogManager
+	clock            Clock
+	heartbeatTimeout time.Duration
+	maxMessageSize   int
+	tlsConfig        *tls.Config
+	metricsAddr      string
+	metrics          *metrics
+	metricsServer    *http.Server
+	queue            chan string
+	done             chan struct{}
+
+	mu            sync.Mutex
+	ln            net.Listener
+	clients       map[string]*client // by remote address
+	unread        map[net.Conn]bool  // connections yet to send a message
+	stopped       bool
+	minLevel      string
+	belowMinLevel int
+	queueDropped  int
+	wg            sync.WaitGroup
+}
+
+// ConnectionState is how one connected client is doing.
+type ConnectionState struct {
+	Addr          string
+	Name          string    // what it called itself, "" until it says
+	Since         time.Time // when it connected
+	LastHeartbeat time.Time // when it last sent anything, a heartbeat or a log
+
+	timeout time.Duration // the server's heartbeat timeout
+}
+
+// Alive reports whether the client has sent a heartbeat, or anything
+// else, recently enough to still count as connected at now.
+func (cs ConnectionState) Alive(now time.Time) bool {
+	timeout := cs.timeout
+	if timeout == 0 {
+		timeout = DefaultHeartbeatTimeout
+	}
+	return now.Sub(cs.LastHeartbeat) <= timeout
+}
+
+type client struct {
+	conn     net.Conn
+	state    ConnectionState
+	timedOut bool // counted as a heartbeat timeout, and not heard from since
+}
+
+func NewServer(addr string) *Server {
+	return &Server{
+		addr:             addr,
+		logs:             NewLogManager(0),
+		clock:            RealClock,
+		done:             make(chan struct{}),
+		heartbeatTimeout: DefaultHeartbeatTimeout,
+	}
+}
+
+// SetQueueSize hands logs to the OnLog hook through a queue of this size,
+// drained by one goroutine started by Start, so a slow hook such as a UI
+// redraw never holds up reading from the client. While it is full logs
+// are still stored but skip the hook; QueueDropped counts them. 0, the
+// default, runs the hook on the connection's goroutine. Call before Start.
+func (s *Server) SetQueueSize(size int) {
+	s.queue = nil
+	if size > 0 {
+		s.queue = make(chan string, size)
+	}
+}
+
+// QueueDropped returns how many logs skipped the OnLog hook because the
+// queue was full.
+func (s *Server) QueueDropped() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.queueDropped
+}
+
+// SetClock replaces the clock heartbeats are timed against and injected
+// logs are stamped with, so liveness can be checked without waiting out
+// the heartbeat timeout. Call before Start.
+func (s *Server) SetClock(clock Clock) {
+	s.clock = clock
+	s.logs.SetClock(clock)
+}
+
+// SetHeartbeatTimeout sets how long a client may go without a heartbeat
+// before it is no longer reported as connected, DefaultHeartbeatTimeout
+// by default. Call before Start.
+func (s *Server) SetHeartbeatTimeout(timeout time.Duration) {
+	s.heartbeatTimeout = timeout
+}
+
+// SetMaxMessageSize sets the longest message read from a client whole,
+// DefaultMaxMessageSize by default. Longer ones are truncated, with a
+// warning logged. Call before Start.
+func (s *Server) SetMaxMessageSize(size int) {
+	s.maxMessageSize = size
+}
+
+// SetTLSConfig makes the server accept clients over TLS with config, from
+// LoadServerTLS. nil, the default, listens on plain TCP. Call before
+// Start.
+func (s *Server) SetTLSConfig(config *tls.Config) {
+	s.tlsConfig = config
+}
+
+// SetLevels sets the levels clients are told to send, nil for all. Call
+// before Start.
+func (s *Server) SetLevels(levels []string) {
+	s.levels = levels
+}
+
+// SetKeepBlank makes the server store whitespace-only messages instead of
+// skipping them. Call before Start.
+func (s *Server) SetKeepBlank(keep bool) {
+	s.keepBlank = keep
+}
+
+// SetCompress lets clients send gzip-compressed streams, which are told
+// apart from plain ones by their first bytes. Without it a compressed
+// client is hung up on. Call before Start.
+func (s *Server) SetCompress(compress bool) {
+	s.compress = compress
+}
+
+// SetClientPrefix tags each log with the address of the client that sent
+// it, as "[host:port]" after its timestamp, so logs merged from several
+// clients can be told apart. Call before Start.
+func (s *Server) SetClientPrefix(prefix bool) {
+	s.clientPrefix = prefix
+}
+
+// SetParser sets the format client logs are read in. Each is rewritten
+// from its parts, as a client would have sent it, before it is stored, so
+// levels and timestamps are found whatever the format. nil, the default,
+// stores logs as they arrive. Call before Start.
+func (s *Server) SetParser(parser Parser) {
+	s.parser = parser
+}
+
+// OnLog sets a hook run for every log after it is stored. It runs on the
+// connection's goroutine, or the queue's with SetQueueSize, and must not
+// call Stop. Call before Start.
+func (s *Server) OnLog(handler func(log string)) {
+	s.onLog = handler
+}
+
+// SetMinLevel makes the server discard client logs below level, before
+// they are stored. "" keeps every level. Logs with no level are always
+// kept. It may be changed while running.
+func (s *Server) SetMinLevel(level string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.minLevel = level
+}
+
+func (s *Server) MinLevel() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.minLevel
+}
+
+// BelowMinLevel returns how many logs have been discarded by SetMinLevel.
+func (s *Server) BelowMinLevel() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.belowMinLevel
+}
+
+func (s *Server) Logs() *LogManager {
+	return s.logs
+}
+
+// Addr returns the address being listened on once started, so a server
+// given ":0" can report its port.
+func (s *Server) Addr() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.ln != nil {
+		return s.ln.Addr().String()
+	}
+	return s.addr
+}
+
+// Start listens and accepts clients in the background until Stop is
+// called or ctx is done.
+func (s *Server) Start(ctx context.Context) error {
+	ln, err := net.Listen("tcp", s.addr)
+	if IsAddrInUse(err) {
+		if ProbeServer(s.addr, time.Second) {
+			return fmt.Errorf("%w on %s", ErrAlreadyRunning, s.addr)
+		}
+		return fmt.Errorf("%s is already in use by another program", s.addr)
+	}
+	if err != nil {
+		return err
+	}
+	if s.tlsConfig != nil {
+		ln = tls.NewListener(ln, s.tlsConfig)
+	}
+	var metricsLn net.Listener
+	if s.metricsAddr != "" {
+		metricsLn, err = net.Listen("tcp", s.metricsAddr)
+		if err != nil {
+			ln.Close()
+			return fmt.Errorf("metrics: %w", err)
+		}
+	}
+
+	s.mu.Lock()
+	s.ln = ln
+	if metricsLn != nil {
+		s.metrics = newMetrics(s)
+		s.metricsServer = &http.Server{Handler: s.metrics.handler(), ReadHeaderTimeout: 5 * time.Second}
+	}
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go s.accept(ln)
+	if metricsLn != nil {
+		s.wg.Add(2)
+		go func() {
+			defer s.wg.Done()
+			s.metricsServer.Serve(metricsLn)
+		}()
+		go s.sweepHeartbeats()
+	}
+	if s.queue != nil {
+		s.wg.Add(1)
+		go s.drainQueue()
+	}
+	context.AfterFunc(ctx, s.Stop)
+	return nil
+}
+
+// Stop shuts the server down as Shutdown does, waiting up to
+// stopTimeout.
+func (s *Server) Stop() {
+	s.Shutdown(stopTimeout)
+}
+
+// Shutdown closes the listener and shuts every client down cleanly: its
+// connection is half-closed, so the client reads EOF instead of a reset,
+// and what it had already sent is still read until it hangs up or
+// closeGrace passes. It then waits, up to timeout in all, for the
+// server's goroutines, such as one stuck in an OnLog hook, reporting
+// whether they all finished; connections still open then are closed
+// outright.
+func (s *Server) Shutdown(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	s.mu.Lock()
+	if !s.stopped {
+		close(s.done)
+	}
+	s.stopped = true
+	if s.ln != nil {
+		s.ln.Close()
+		s.ln = nil
+	}
+	if s.metricsServer != nil {
+		s.metricsServer.Close()
+	}
+	for _, c := range s.clients {
+		if tcp, ok := c.conn.(interface{ CloseWrite() error }); ok && tcp.CloseWrite() == nil {
+			c.conn.SetReadDeadline(time.Now().Add(min(timeout, closeGrace)))
+		} else {
+			c.conn.Close()
+		}
+	}
+	for conn := range s.unread {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	finished := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(finished)
+	}()
+	select {
+	case <-finished:
+		return true
+	case <-time.After(time.Until(deadline)):
+	}
+	s.mu.Lock()
+	for _, c := range s.clients {
+		c.conn.Close()
+	}
+	s.mu.Unlock()
+	return false
+}
+
+// Connected reports whether any client is connected and still sending
+// heartbeats.
+func (s *Server) Connected() bool {
+	return s.ConnectedClients() > 0
+}
+
+// ConnectedClients returns how many clients are connected and still
+// sending heartbeats.
+func (s *Server) ConnectedClients() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.clock.Now()
+	n := 0
+	for _, c := range s.clients {
+		if c.state.Alive(now) {
+			n++
+		}
+	}
+	return n
+}
+
+// ConnectedNames returns the names of the connected clients that have
+// given one and are still sending heartbeats, sorted.
+func (s *Server) ConnectedNames() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.clock.Now()
+	var names []string
+	for _, c := range s.clients {
+		if c.state.Name != "" && c.state.Alive(now) {
+			names = append(names, c.state.Name)
+		}
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Clients returns the state of every client connected, sorted by address.
+func (s *Server) Clients() []ConnectionState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	states := make([]ConnectionState, 0, len(s.clients))
+	for _, c := range s.clients {
+		states = append(states, c.state)
+	}
+	slices.SortFunc(states, func(a, b ConnectionState) int { return strings.Compare(a.Addr, b.Addr) })
+	return states
+}
+
+func (s *Server) accept(ln net.Listener) {
+	defer s.wg.Done()
+	for {
+		conn, err := ln.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			continue
+		}
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.ServeConn(conn)
+		}()
+	}
+}
+
+// ServeConn reads one client's logs until its connection closes, counting
+// it among the clients once it sends its first message. A connection from
+// the address of one already counted, as the ends of net.Pipes all share,
+// replaces it. Start calls it
+// for every accepted connection; it can also be handed one end of a
+// net.Pipe. When levels are set, the client is told to only send those
+// once its framing handshake is read. A Probe is answered and closed. A
+// gzip-compressed stream is read through a decompressor, with SetCompress.
+// A TLS connection that fails its handshake is logged as a warning.
+func (s *Server) ServeConn(conn net.Conn) {
+	s.mu.Lock()
+	if s.stopped {
+		s.mu.Unlock()
+		conn.Close()
+		return
+	}
+	if s.unread == nil {
+		s.unread = make(map[net.Conn]bool)
+	}
+	s.unread[conn] = true
+	s.mu.Unlock()
+
+	// A failed handshake is logged, so a client with the wrong
+	// certificate, or not using TLS, doesn't just silently fail
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		tlsConn.SetDeadline(time.Now().Add(tlsHandshakeTimeout))
+		err := tlsConn.Handshake()
+		tlsConn.SetDeadline(time.Time{})
+		if err != nil {
+			s.mu.Lock()
+			stopped := s.stopped
+			s.mu.Unlock()
+			if !stopped {
+				s.InjectLog("WARNING", fmt.Sprintf("TLS handshake with %s failed: %v", conn.RemoteAddr(), err))
+			}
+			s.dropUnread(conn)
+			return
+		}
+	}
+
+	framer := NewFramer()
+	framer.SetMaxSize(s.maxMessageSize)
+	br := bufio.NewReader(conn)
+	var r io.Reader = br
+	if isCompressed(br) {
+		if !s.compress {
+			s.dropUnread(conn)
+			return
+		}
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			s.dropUnread(conn)
+			return
+		}
+		r = zr
+	}
+	scanner := NewScanner(r, framer)
+	ok := scanner.Scan()
+
+	s.mu.Lock()
+	delete(s.unread, conn)
+	if !ok || s.stopped {
+		s.mu.Unlock()
+		conn.Close()
+		return
+	}
+	if scanner.Text() == Probe {
+		s.mu.Unlock()
+		conn.Write(LineFraming.Encode(ProbeReply))
+		conn.Close()
+		return
+	}
+	addr := conn.RemoteAddr().String()
+	if old := s.clients[addr]; old != nil {
+		old.conn.Close()
+	}
+	if s.clients == nil {
+		s.clients = make(map[string]*client)
+	}
+	now := s.clock.Now()
+	c := &client{conn: conn, state: ConnectionState{Addr: addr, Since: now, LastHeartbeat: now, timeout: s.heartbeatTimeout}}
+	s.clients[addr] = c
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		conn.Close()
+		if s.clients[addr] == c {
+			delete(s.clients, addr)
+		}
+		s.mu.Unlock()
+	}()
+
+	// Logs are tagged with the client's name once it gives one, and
+	// otherwise, with SetClientPrefix, its address. Names go in angle
+	// brackets, as one in square brackets could pass for a color tag.
+	var tag string
+	if s.clientPrefix {
+		tag = "[" + addr + "]"
+	}
+
+	subscribed := s.levels == nil
+	for read := true; read; read = scanner.Scan() {
+		message := scanner.Text()
+		if framer.Truncated() {
+			s.InjectLog("WARNING", fmt.Sprintf("line truncated: a message from %s was longer than %d bytes", addr, framer.MaxSize()))
+		}
+		// Anything a client sends shows it is alive, so a burst of logs
+		// keeps it connected even if heartbeats fall behind
+		s.mu.Lock()
+		c.state.LastHeartbeat = s.clock.Now()
+		c.timedOut = false
+		s.mu.Unlock()
+		framing, isHandshake := ParseFramingRequest(message)
+		if isHandshake {
+			framer.SetFraming(framing)
+		}
+		if !subscribed {
+			conn.Write(framer.Framing().Encode(SubscribeMessage(s.levels)))
+			subscribed = true
+		}
+		if isHandshake {
+			continue
+		}
+		if name, ok := ParseHello(message); ok {
+			s.mu.Lock()
+			c.state.Name = name
+			s.mu.Unlock()
+			tag = "<" + name + ">"
+			continue
+		}
+		if message == Heartbeat {
+			conn.SetWriteDeadline(time.Now().Add(ackWriteTimeout))
+			conn.Write(framer.Framing().Encode(Ack))
+			continue
+		}
+		if IsControlMessage(message) {
+			continue
+		}
+		if !s.keepBlank && strings.TrimSpace(message) == "" {
+			continue
+		}
+		if s.parser != nil {
+			message = s.parser.Parse(message).String()
+		}
+		if s.metrics != nil {
+			s.metrics.countLog(message)
+		}
+		if s.discardBelowMinLevel(message) {
+			continue
+		}
+		if tag != "" {
+			message = InsertAfterTimestamp(message, tag)
+		}
+		s.addLog(message)
+	}
+}
+
+// dropUnread closes a connection that is hung up on before it sent a
+// message.
+func (s *Server) dropUnread(conn net.Conn) {
+	s.mu.Lock()
+	delete(s.unread, conn)
+	s.mu.Unlock()
+	conn.Close()
+}
+
+// AddLog stores log as it is, running the OnLog hook, as though a client
+// had sent it. It makes a Server a LogSink.
+func (s *Server) AddLog(log string) {
+	s.addLog(log)
+}
+
+// InjectLog stores a log as though a client had sent it, formatted the
+// way the clients format theirs, so demos and tests can drive a server
+// without a connection.
+func (s *Server) InjectLog(level, msg string) {
+	s.addLog(fmt.Sprintf("%s %s: %s", FormatTimestamp(s.clock.Now(), false), level, msg))
+}
+
+func (s *Server) discardBelowMinLevel(log string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.minLevel == "" {
+		return false
+	}
+	level, _, _ := ParseLogLine(log)
+	rank := LevelRank(level)
+	if rank < 0 || rank >= LevelRank(s.minLevel) {
+		return false
+	}
+	s.belowMinLevel++
+	return true
+}
+
+// DefaultPort is the port servers listen on unless told otherwise:
+// $LOGGER_PORT, or else 8080.
+func DefaultPort() string {
+	if port := os.Getenv("LOGGER_PORT"); port != "" {
+		return port
+	}
+	return "8080"
+}
+
+// ListenAddr returns the address to listen on for port, checking it is a
+// port number from 1 to 65535.
+func ListenAddr(port string) (string, error) {
+	n, err := strconv.Atoi(port)
+	if err != nil || n < 1 || n > 65535 {
+		return "", fmt.Errorf("%q is not a port number from 1 to 65535", port)
+	}
+	return ":" + strconv.Itoa(n), nil
+}
+
+// IsAddrInUse reports whether err is a listen failing because something
+// is already bound to the address.
+func IsAddrInUse(err error) bool {
+	return errors.Is(err, syscall.EADDRINUSE)
+}
+
+// ProbeServer reports whether a logger server is listening on addr,
+// without disturbing the client it is serving.
+func ProbeServer(addr string, timeout time.Duration) bool {
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return false
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+	if _, err := conn.Write(LineFraming.Encode(Probe)); err != nil {
+		return false
+	}
+	scanner := NewScanner(conn, NewFramer())
+	return scanner.Scan() && scanner.Text() == ProbeReply
+}
+
+func (s *Server) addLog(log string) {
+	s.logs.AddLog(log)
+	if s.onLog == nil {
+		return
+	}
+	if s.queue == nil {
+		s.onLog(log)
+		return
+	}
+	select {
+	case s.queue <- log:
+	default:
+		s.mu.Lock()
+		s.queueDropped++
+		s.mu.Unlock()
+	}
+}
+
+func (s *Server) drainQueue() {
+	defer s.wg.Done()
+	for {
+		select {
+		case log := <-s.queue:
+			s.onLog(log)
+		case <-s.done:
+			return
+		}
+	}
+}
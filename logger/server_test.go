@@ -0,0 +1,814 @@
+package logger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+)
+
+// waitFor polls cond until it holds, failing the test after a second.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// pipeClient serves one end of a net.Pipe on s and returns the other,
+// with whatever the server writes back read and discarded.
+func pipeClient(t *testing.T, s *Server) net.Conn {
+	t.Helper()
+	server, client := net.Pipe()
+	go s.ServeConn(server)
+	go io.Copy(io.Discard, client)
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func send(t *testing.T, conn net.Conn, msg string) {
+	t.Helper()
+	if _, err := conn.Write(LineFraming.Encode(msg)); err != nil {
+		t.Fatalf("writing %q: %v", msg, err)
+	}
+}
+
+// serveMessages has s serve a client that sends msgs in framing and hangs
+// up, returning once ServeConn does.
+func serveMessages(t *testing.T, s *Server, framing Framing, msgs []string) {
+	t.Helper()
+	server, client := net.Pipe()
+	served := make(chan struct{})
+	go func() {
+		s.ServeConn(server)
+		close(served)
+	}()
+	go io.Copy(io.Discard, client)
+	if framing != LineFraming {
+		send(t, client, framing.Request())
+	}
+	for _, msg := range msgs {
+		if _, err := client.Write(framing.Encode(msg)); err != nil {
+			t.Fatalf("writing %q: %v", msg, err)
+		}
+	}
+	client.Close()
+	<-served
+}
+
+func TestHeartbeatKeepsConnectionAlive(t *testing.T) {
+	const timeout = 3 * time.Second
+	clock := newFakeClock()
+	s := NewServer("127.0.0.1:0")
+	s.SetClock(clock)
+	s.SetHeartbeatTimeout(timeout)
+	s.SetMetricsAddr("127.0.0.1:0")
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+
+	conn := pipeClient(t, s)
+	send(t, conn, Heartbeat)
+	waitFor(t, "the client to connect", func() bool { return s.ConnectedClients() == 1 })
+
+	// Heartbeats more often than the timeout keep it alive well past it
+	for i := 0; i < 5; i++ {
+		clock.Advance(timeout - time.Second)
+		send(t, conn, Heartbeat)
+		waitFor(t, "the heartbeat to be read", func() bool {
+			clients := s.Clients()
+			return len(clients) == 1 && clients[0].LastHeartbeat.Equal(clock.Now())
+		})
+		if got := s.ConnectedClients(); got != 1 {
+			t.Fatalf("after heartbeat %d, ConnectedClients() = %d, want 1", i+1, got)
+		}
+	}
+
+	clock.Advance(timeout + time.Second)
+	if got := s.ConnectedClients(); got != 0 {
+		t.Fatalf("after the heartbeats stopped, ConnectedClients() = %d, want 0", got)
+	}
+
+	// However often the sweep runs, a silent client counts once
+	s.countTimeouts()
+	s.countTimeouts()
+	var m dto.Metric
+	if err := s.metrics.timeouts.Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	if got := m.GetCounter().GetValue(); got != 1 {
+		t.Errorf("heartbeat_timeouts_total = %v, want 1", got)
+	}
+}
+
+func TestServeConnDeliversLogs(t *testing.T) {
+	tests := []struct {
+		name     string
+		setup    func(s *Server)
+		messages []string
+		want     []string
+	}{
+		{
+			name:     "logs in order",
+			messages: []string{"INFO: started", "ERROR: disk full"},
+			want:     []string{"INFO: started", "ERROR: disk full"},
+		},
+		{
+			name:     "control messages and blanks skipped",
+			messages: []string{Heartbeat, "INFO: started", "   ", "_SOMETHING_NEW_ arg", "WARNING: slow"},
+			want:     []string{"INFO: started", "WARNING: slow"},
+		},
+		{
+			name:     "blanks kept",
+			setup:    func(s *Server) { s.SetKeepBlank(true) },
+			messages: []string{"INFO: started", " "},
+			want:     []string{"INFO: started", " "},
+		},
+		{
+			name:     "named client",
+			messages: []string{HelloMessage("api"), "2024-01-01 10:00:00 INFO: started"},
+			want:     []string{"2024-01-01 10:00:00 <api> INFO: started"},
+		},
+		{
+			name:     "below min level",
+			setup:    func(s *Server) { s.SetMinLevel("WARNING") },
+			messages: []string{"INFO: started", "ERROR: disk full", "no level"},
+			want:     []string{"ERROR: disk full", "no level"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewServer("")
+			if tt.setup != nil {
+				tt.setup(s)
+			}
+			var mu sync.Mutex
+			var hooked []string
+			s.OnLog(func(log string) {
+				mu.Lock()
+				hooked = append(hooked, log)
+				mu.Unlock()
+			})
+
+			serveMessages(t, s, LineFraming, tt.messages)
+
+			if got := s.Logs().GetFilteredLogs("ALL"); !slices.Equal(got, tt.want) {
+				t.Errorf("stored %q, want %q", got, tt.want)
+			}
+			if !slices.Equal(hooked, tt.want) {
+				t.Errorf("OnLog saw %q, want %q", hooked, tt.want)
+			}
+		})
+	}
+}
+
+func TestServerConnectAndStop(t *testing.T) {
+	s := NewServer("127.0.0.1:0")
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	server, client := net.Pipe()
+	served := make(chan struct{})
+	go func() {
+		s.ServeConn(server)
+		close(served)
+	}()
+	closed := make(chan struct{})
+	go func() {
+		io.Copy(io.Discard, client)
+		close(closed)
+	}()
+	if s.Connected() {
+		t.Fatal("Connected() before the client sent anything")
+	}
+	send(t, client, HelloMessage("worker"))
+	waitFor(t, "the client to connect", func() bool { return s.Connected() })
+	if got := s.ConnectedNames(); !slices.Equal(got, []string{"worker"}) {
+		t.Errorf("ConnectedNames() = %q, want [worker]", got)
+	}
+
+	if !s.Shutdown(time.Second) {
+		t.Error("Shutdown() = false, want true with nothing left running")
+	}
+	for what, ch := range map[string]chan struct{}{"the client's connection to close": closed, "ServeConn to return": served} {
+		select {
+		case <-ch:
+		case <-time.After(time.Second):
+			t.Fatalf("timed out waiting for %s", what)
+		}
+	}
+	if s.Connected() {
+		t.Error("Connected() after Stop")
+	}
+
+	// Connections served after Stop are closed straight away
+	late, lateClient := net.Pipe()
+	s.ServeConn(late)
+	if _, err := lateClient.Write([]byte("x")); err == nil {
+		t.Error("wrote to a connection served after Stop")
+	}
+}
+
+func TestShutdownWaitsForGoroutines(t *testing.T) {
+	s := NewServer("127.0.0.1:0")
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	s.OnLog(func(string) {
+		close(entered)
+		<-release
+	})
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.Dial("tcp", s.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	send(t, conn, "INFO: started")
+	<-entered
+
+	// A hook that never returns holds the client's goroutine
+	if s.Shutdown(50 * time.Millisecond) {
+		t.Fatal("Shutdown() = true while an OnLog hook was still running")
+	}
+	close(release)
+	if !s.Shutdown(time.Second) {
+		t.Error("Shutdown() = false after the hook returned")
+	}
+}
+
+func TestGetRecentLogs(t *testing.T) {
+	tests := []struct {
+		n    int
+		want []string
+	}{
+		{0, []string{}},
+		{-1, []string{}},
+		{2, []string{"INFO: 2", "INFO: 3"}},
+		{3, []string{"INFO: 1", "INFO: 2", "INFO: 3"}},
+		{10, []string{"INFO: 1", "INFO: 2", "INFO: 3"}},
+	}
+	lm := NewLogManager(0)
+	for _, log := range []string{"INFO: 1", "INFO: 2", "INFO: 3"} {
+		lm.AddLog(log)
+	}
+	for _, tt := range tests {
+		if got := lm.GetRecentLogs(tt.n); !slices.Equal(got, tt.want) {
+			t.Errorf("GetRecentLogs(%d) = %q, want %q", tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestServeConnEmptyMessages(t *testing.T) {
+	tests := []struct {
+		name      string
+		framing   Framing
+		keepBlank bool
+		want      []string
+	}{
+		{"line", LineFraming, false, []string{"INFO: a", "INFO: b"}},
+		{"line kept", LineFraming, true, []string{"INFO: a", "", " \t", "INFO: b"}},
+		{"length", LengthFraming, false, []string{"INFO: a", "INFO: b"}},
+		{"length kept", LengthFraming, true, []string{"INFO: a", "", " \t", "INFO: b"}},
+		{"nul", NulFraming, false, []string{"INFO: a", "INFO: b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewServer("")
+			s.SetKeepBlank(tt.keepBlank)
+			serveMessages(t, s, tt.framing, []string{"INFO: a", "", " \t", "INFO: b"})
+			if got := s.Logs().GetFilteredLogs("ALL"); !slices.Equal(got, tt.want) {
+				t.Errorf("stored %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInjectLog(t *testing.T) {
+	tests := []struct {
+		level, msg string
+		want       string // after the timestamp
+	}{
+		{"INFO", "Server started", " INFO: Server started"},
+		{"ERROR", "disk full: /var", " ERROR: disk full: /var"},
+		{"WARNING", "", " WARNING: "},
+	}
+	clock := newFakeClock()
+	s := NewServer("")
+	s.SetClock(clock)
+	var hooked []string
+	s.OnLog(func(log string) { hooked = append(hooked, log) })
+	var want []string
+	for _, tt := range tests {
+		s.InjectLog(tt.level, tt.msg)
+		want = append(want, FormatTimestamp(clock.Now(), false)+tt.want)
+		clock.Advance(time.Second)
+	}
+	if got := s.Logs().GetFilteredLogs("ALL"); !slices.Equal(got, want) {
+		t.Errorf("stored %q, want %q", got, want)
+	}
+	if !slices.Equal(hooked, want) {
+		t.Errorf("OnLog saw %q, want %q", hooked, want)
+	}
+	if counts := s.Logs().Counts(); counts["INFO"] != 1 || counts["ERROR"] != 1 || counts["WARNING"] != 1 {
+		t.Errorf("Counts() = %v, want one of each level", counts)
+	}
+}
+
+func TestSearchPattern(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		text  string
+		match bool
+	}{
+		{"word", "disk", "ERROR: disk full", true},
+		{"phrase", "disk full", "ERROR: disk full", true},
+		{"across lines", "panic: boom goroutine", "ERROR: panic: boom\n\ngoroutine 1 [running]:", true},
+		{"across extra spaces", "disk   full", "disk \t full", true},
+		{"ignores case", "DISK", "disk full", true},
+		{"words out of order", "full disk", "disk full", false},
+		{"metacharacters literal", "a.b", "axb", false},
+		{"metacharacters matched", "[x] (y)", "got [x] (y)", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SearchPattern(tt.query, false).MatchString(tt.text); got != tt.match {
+				t.Errorf("SearchPattern(%q) matching %q = %v, want %v", tt.query, tt.text, got, tt.match)
+			}
+		})
+	}
+}
+
+func TestGetSearchFilteredLogsMultiLine(t *testing.T) {
+	lm := NewLogManager(0)
+	trace := "ERROR: panic: boom\n\ngoroutine 1 [running]:\nmain.main()"
+	for _, log := range []string{"INFO: started", trace, "WARNING: goroutine leak"} {
+		lm.AddLog(log)
+	}
+	tests := []struct {
+		query, level string
+		want         []string
+	}{
+		{"boom goroutine", "ALL", []string{trace}},
+		{"goroutine", "ALL", []string{trace, "WARNING: goroutine leak"}},
+		{"goroutine", "WARNING", []string{"WARNING: goroutine leak"}},
+		{"[running]: main.main()", "ERROR", []string{trace}},
+		{"", "INFO", []string{"INFO: started"}},
+	}
+	for _, tt := range tests {
+		if got := lm.GetSearchFilteredLogs(tt.query, tt.level); !slices.Equal(got, tt.want) {
+			t.Errorf("GetSearchFilteredLogs(%q, %q) = %q, want %q", tt.query, tt.level, got, tt.want)
+		}
+	}
+}
+
+func TestLogManagerLimit(t *testing.T) {
+	tests := []struct {
+		name    string
+		limit   int
+		added   int
+		want    []string
+		dropped int
+	}{
+		{"under", 5, 3, []string{"INFO: 1", "INFO: 2", "INFO: 3"}, 0},
+		{"at", 3, 3, []string{"INFO: 1", "INFO: 2", "INFO: 3"}, 0},
+		{"over", 2, 5, []string{"INFO: 4", "INFO: 5"}, 3},
+		{"unlimited", 0, 5, []string{"INFO: 1", "INFO: 2", "INFO: 3", "INFO: 4", "INFO: 5"}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lm := NewLogManager(tt.limit)
+			for i := 1; i <= tt.added; i++ {
+				lm.AddLog(fmt.Sprintf("INFO: %d", i))
+			}
+			if got := lm.GetFilteredLogs("ALL"); !slices.Equal(got, tt.want) {
+				t.Errorf("kept %q, want %q", got, tt.want)
+			}
+			if got := lm.Dropped(); got != tt.dropped {
+				t.Errorf("Dropped() = %d, want %d", got, tt.dropped)
+			}
+		})
+	}
+
+	// Lowering the limit trims straight away
+	lm := NewLogManager(0)
+	for i := 1; i <= 4; i++ {
+		lm.AddLog(fmt.Sprintf("INFO: %d", i))
+	}
+	lm.SetLimit(1)
+	if got := lm.GetFilteredLogs("ALL"); !slices.Equal(got, []string{"INFO: 4"}) || lm.Dropped() != 3 {
+		t.Errorf("after SetLimit(1) kept %q with %d dropped, want [INFO: 4] with 3", got, lm.Dropped())
+	}
+}
+
+func TestConnectionStateAlive(t *testing.T) {
+	last := newFakeClock().Now()
+	tests := []struct {
+		name    string
+		timeout time.Duration
+		since   time.Duration // since the last heartbeat
+		alive   bool
+	}{
+		{"just now", time.Second, 0, true},
+		{"at the timeout", time.Second, time.Second, true},
+		{"past the timeout", time.Second, time.Second + time.Millisecond, false},
+		{"default timeout", 0, DefaultHeartbeatTimeout, true},
+		{"past the default", 0, DefaultHeartbeatTimeout + time.Millisecond, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cs := ConnectionState{LastHeartbeat: last, timeout: tt.timeout}
+			if got := cs.Alive(last.Add(tt.since)); got != tt.alive {
+				t.Errorf("Alive() %v after the last heartbeat = %v, want %v", tt.since, got, tt.alive)
+			}
+		})
+	}
+}
+
+func TestLogManagerClock(t *testing.T) {
+	clock := newFakeClock()
+	lm := NewLogManager(0)
+	lm.SetClock(clock)
+	start := clock.Now()
+	for i := 0; i < 3; i++ {
+		lm.AddLog(fmt.Sprintf("INFO: %d", i))
+		clock.Advance(time.Minute)
+	}
+	for seq := 0; seq < 3; seq++ {
+		if got, want := lm.Arrived(seq), start.Add(time.Duration(seq)*time.Minute); !got.Equal(want) {
+			t.Errorf("Arrived(%d) = %v, want %v", seq, got, want)
+		}
+	}
+}
+
+func TestSetMinLevel(t *testing.T) {
+	logs := []string{"DEBUG: cache hit", "INFO: started", "WARNING: slow", "ERROR: disk full", "no level"}
+	tests := []struct {
+		minLevel  string
+		want      []string
+		discarded int
+	}{
+		{"", logs, 0},
+		{"TRACE", logs, 0},
+		{"INFO", logs[1:], 1},
+		{"ERROR", []string{"ERROR: disk full", "no level"}, 3},
+	}
+	for _, tt := range tests {
+		t.Run("min "+tt.minLevel, func(t *testing.T) {
+			s := NewServer("")
+			s.SetMinLevel(tt.minLevel)
+			serveMessages(t, s, LineFraming, logs)
+			if got := s.Logs().GetFilteredLogs("ALL"); !slices.Equal(got, tt.want) {
+				t.Errorf("stored %q, want %q", got, tt.want)
+			}
+			if got := s.BelowMinLevel(); got != tt.discarded {
+				t.Errorf("BelowMinLevel() = %d, want %d", got, tt.discarded)
+			}
+		})
+	}
+}
+
+func TestAckErrors(t *testing.T) {
+	lm := NewLogManager(0)
+	for _, log := range []string{"INFO: started", "ERROR: a", "WARNING: slow", "ERROR: b"} {
+		lm.AddLog(log)
+	}
+	steps := []struct {
+		name   string
+		do     func() bool
+		ok     bool
+		acked  []int // seqs acknowledged after the step
+		active int
+	}{
+		{"newest first", lm.AckLastError, true, []int{3}, 1},
+		{"then the one before", lm.AckLastError, true, []int{1, 3}, 0},
+		{"none left", lm.AckLastError, false, []int{1, 3}, 0},
+		{"a new error", func() bool { lm.AddLog("ERROR: c"); return true }, true, []int{1, 3}, 1},
+		{"all at once", func() bool { lm.AckAllErrors(); return true }, true, []int{1, 3, 4}, 0},
+	}
+	for _, step := range steps {
+		if ok := step.do(); ok != step.ok {
+			t.Errorf("%s: returned %v, want %v", step.name, ok, step.ok)
+		}
+		for seq := 0; seq < lm.Total(); seq++ {
+			if got, want := lm.Acked(seq), slices.Contains(step.acked, seq); got != want {
+				t.Errorf("%s: Acked(%d) = %v, want %v", step.name, seq, got, want)
+			}
+		}
+		if got := lm.ActiveErrors(); got != step.active {
+			t.Errorf("%s: ActiveErrors() = %d, want %d", step.name, got, step.active)
+		}
+	}
+}
+
+func TestTopErrors(t *testing.T) {
+	lm := NewLogManager(0)
+	for _, log := range []string{"ERROR: a", "INFO: a", "2024-01-02 03:04:05 ERROR: b", "ERROR: b", "ERROR: c"} {
+		lm.AddLog(log)
+	}
+	tests := []struct {
+		n    int
+		want []ErrorCount
+	}{
+		{2, []ErrorCount{{"ERROR: b", 2}, {"ERROR: a", 1}}},
+		{10, []ErrorCount{{"ERROR: b", 2}, {"ERROR: a", 1}, {"ERROR: c", 1}}},
+		{0, nil},
+		{-1, nil},
+	}
+	for _, tt := range tests {
+		if got := lm.TopErrors(tt.n); !slices.Equal(got, tt.want) {
+			t.Errorf("TopErrors(%d) = %v, want %v", tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestAckSurvivesTrim(t *testing.T) {
+	lm := NewLogManager(2)
+	lm.AddLog("ERROR: a")
+	lm.AddLog("ERROR: b")
+	lm.AckLastError()
+	lm.AddLog("INFO: c")
+	// "ERROR: a" is dropped; "ERROR: b" keeps its seq and its ack
+	if !lm.Acked(1) || lm.ActiveErrors() != 0 {
+		t.Errorf("after trimming, Acked(1) = %v and ActiveErrors() = %d, want true and 0", lm.Acked(1), lm.ActiveErrors())
+	}
+	if _, seqs := lm.GetSearchFilteredLogSeqs("", "ALL"); !slices.Equal(seqs, []int{1, 2}) {
+		t.Errorf("seqs after trimming = %v, want [1 2]", seqs)
+	}
+}
+
+func TestQueueDropsWhenFull(t *testing.T) {
+	s := NewServer("127.0.0.1:0")
+	s.SetQueueSize(2)
+	entered := make(chan struct{}, 6)
+	release := make(chan struct{})
+	var mu sync.Mutex
+	var hooked []string
+	s.OnLog(func(log string) {
+		entered <- struct{}{}
+		<-release
+		mu.Lock()
+		hooked = append(hooked, log)
+		mu.Unlock()
+	})
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+
+	// The first is taken by the hook, which blocks, the next two fill the
+	// queue and the rest skip the hook
+	s.AddLog("INFO: 1")
+	<-entered
+	for i := 2; i <= 6; i++ {
+		s.AddLog(fmt.Sprintf("INFO: %d", i))
+	}
+	if got := s.QueueDropped(); got != 3 {
+		t.Errorf("QueueDropped() = %d, want 3", got)
+	}
+	if got := s.Logs().Total(); got != 6 {
+		t.Errorf("stored %d logs, want all 6", got)
+	}
+
+	close(release)
+	waitFor(t, "the queue to drain", func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(hooked) == 3
+	})
+	mu.Lock()
+	defer mu.Unlock()
+	if want := []string{"INFO: 1", "INFO: 2", "INFO: 3"}; !slices.Equal(hooked, want) {
+		t.Errorf("OnLog saw %q, want %q", hooked, want)
+	}
+}
+
+func TestServeConnNulFraming(t *testing.T) {
+	s := NewServer("")
+	msgs := []string{"ERROR: panic\n\tat main.go:12", "INFO: after"}
+	serveMessages(t, s, NulFraming, msgs)
+	if got := s.Logs().GetFilteredLogs("ALL"); !slices.Equal(got, msgs) {
+		t.Errorf("stored %q, want %q", got, msgs)
+	}
+}
+
+func TestStartAlreadyRunning(t *testing.T) {
+	s := NewServer("127.0.0.1:0")
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+	if !ProbeServer(s.Addr(), time.Second) {
+		t.Fatalf("ProbeServer(%s) = false with a server listening", s.Addr())
+	}
+	if err := NewServer(s.Addr()).Start(context.Background()); !errors.Is(err, ErrAlreadyRunning) {
+		t.Errorf("second Start on %s = %v, want ErrAlreadyRunning", s.Addr(), err)
+	}
+	if got := s.Logs().GetFilteredLogs("ALL"); len(got) != 0 {
+		t.Errorf("probing stored %q", got)
+	}
+
+	// A port held by something that isn't a logger is reported as such
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+	if ProbeServer(ln.Addr().String(), time.Second) {
+		t.Errorf("ProbeServer(%s) = true for a listener that isn't a logger", ln.Addr())
+	}
+	err = NewServer(ln.Addr().String()).Start(context.Background())
+	if err == nil || errors.Is(err, ErrAlreadyRunning) {
+		t.Errorf("Start on a port in use by another program = %v, want a plain error", err)
+	}
+}
+
+func TestServeConnHidesControlMessages(t *testing.T) {
+	s := NewServer("")
+	serveMessages(t, s, LineFraming, []string{"INFO: a", "_VERSION_ 2", Heartbeat, "INFO: b"})
+	if got, want := s.Logs().GetFilteredLogs("ALL"), []string{"INFO: a", "INFO: b"}; !slices.Equal(got, want) {
+		t.Errorf("stored %q, want %q", got, want)
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	tests := []struct {
+		name    string
+		pattern *regexp.Regexp
+		log     string
+		want    string
+	}{
+		{"first group", regexp.MustCompile(`req=(\w+)`), "INFO: req=a1 served", "a1"},
+		{"whole match", regexp.MustCompile(`\breq-\d+\b`), "ERROR: req-42 failed", "req-42"},
+		{"no match", regexp.MustCompile(`req=(\w+)`), "INFO: started", ""},
+		{"no pattern", nil, "INFO: req=a1 served", ""},
+	}
+	for _, tt := range tests {
+		lm := NewLogManager(0)
+		lm.SetIDPattern(tt.pattern)
+		if got := lm.RequestID(tt.log); got != tt.want {
+			t.Errorf("%s: RequestID(%q) = %q, want %q", tt.name, tt.log, got, tt.want)
+		}
+	}
+}
+
+func TestGetLogsByID(t *testing.T) {
+	logs := []string{"INFO: req=a start", "INFO: req=b start", "ERROR: req=a failed", "INFO: idle", "WARNING: req=a retried"}
+	tests := []struct {
+		name  string
+		limit int
+		later bool // set the pattern after the logs arrive
+		id    string
+		want  []string
+		seqs  []int
+	}{
+		{"every level", 0, false, "a", []string{logs[0], logs[2], logs[4]}, []int{0, 2, 4}},
+		{"indexed when set", 0, true, "a", []string{logs[0], logs[2], logs[4]}, []int{0, 2, 4}},
+		{"other ID", 0, false, "b", []string{logs[1]}, []int{1}},
+		{"unknown ID", 0, false, "c", nil, nil},
+		{"dropped logs forgotten", 3, false, "a", []string{logs[2], logs[4]}, []int{2, 4}},
+		{"all dropped", 3, false, "b", nil, nil},
+	}
+	for _, tt := range tests {
+		lm := NewLogManager(tt.limit)
+		if !tt.later {
+			lm.SetIDPattern(regexp.MustCompile(`req=(\w+)`))
+		}
+		for _, log := range logs {
+			lm.AddLog(log)
+		}
+		if tt.later {
+			lm.SetIDPattern(regexp.MustCompile(`req=(\w+)`))
+		}
+		got, seqs := lm.GetLogsByID(tt.id)
+		if !slices.Equal(got, tt.want) || !slices.Equal(seqs, tt.seqs) {
+			t.Errorf("%s: GetLogsByID(%q) = %q, %v, want %q, %v", tt.name, tt.id, got, seqs, tt.want, tt.seqs)
+		}
+	}
+}
+
+func TestSetCaseSensitive(t *testing.T) {
+	lm := NewLogManager(0)
+	for _, log := range []string{"ERROR: E500 upstream", "ERROR: e500 upstream", "INFO: ok"} {
+		lm.AddLog(log)
+	}
+	steps := []struct {
+		caseSensitive bool
+		query         string
+		want          []string
+	}{
+		{false, "E500", []string{"ERROR: E500 upstream", "ERROR: e500 upstream"}},
+		// The same query again once the mode changes isn't served from the
+		// last search
+		{true, "E500", []string{"ERROR: E500 upstream"}},
+		{true, "e500", []string{"ERROR: e500 upstream"}},
+		{true, "error", nil},
+		{false, "e500", []string{"ERROR: E500 upstream", "ERROR: e500 upstream"}},
+	}
+	for _, step := range steps {
+		lm.SetCaseSensitive(step.caseSensitive)
+		if lm.CaseSensitive() != step.caseSensitive {
+			t.Fatalf("CaseSensitive() = %v after SetCaseSensitive(%v)", lm.CaseSensitive(), step.caseSensitive)
+		}
+		if got := lm.GetSearchFilteredLogs(step.query, "ALL"); !slices.Equal(got, step.want) {
+			t.Errorf("case sensitive %v: GetSearchFilteredLogs(%q) = %q, want %q", step.caseSensitive, step.query, got, step.want)
+		}
+	}
+}
+
+func TestCompileSearch(t *testing.T) {
+	tests := []struct {
+		query         string
+		caseSensitive bool
+		text          string
+		match         bool
+	}{
+		{`/error code 4\d\d/`, false, "ERROR code 404", true},
+		{`/error code 4\d\d/`, true, "ERROR code 404", false},
+		{`/error code 4\d\d/`, false, "error code 500", false},
+		{"/^INFO/", false, "INFO: up", true},
+		// Too short to be an expression, or not wrapped, so words
+		{"//", false, "a // b", true},
+		{"/a", false, "/a", true},
+		{"a.b/", false, "axb/", false},
+		{"disk full", false, "Disk  Full", true},
+	}
+	for _, tt := range tests {
+		pattern, err := CompileSearch(tt.query, tt.caseSensitive)
+		if err != nil {
+			t.Errorf("CompileSearch(%q): %v", tt.query, err)
+			continue
+		}
+		if got := pattern.MatchString(tt.text); got != tt.match {
+			t.Errorf("CompileSearch(%q, %v) matching %q = %v, want %v", tt.query, tt.caseSensitive, tt.text, got, tt.match)
+		}
+	}
+
+	if _, err := CompileSearch("/disk (full/", false); err == nil {
+		t.Error("CompileSearch accepted an invalid expression")
+	}
+}
+
+func TestLogManagerCompileSearch(t *testing.T) {
+	lm := NewLogManager(0)
+	lm.AddLog("ERROR: disk (full")
+	first, err := lm.CompileSearch("/disk/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := lm.CompileSearch("/disk/"); again != first {
+		t.Error("the same query was compiled again")
+	}
+
+	// An invalid expression finds nothing rather than everything
+	if _, err := lm.CompileSearch("/disk (full/"); err == nil {
+		t.Error("CompileSearch accepted an invalid expression")
+	}
+	if got := lm.GetSearchFilteredLogs("/disk (full/", "ALL"); len(got) != 0 {
+		t.Errorf("an invalid expression found %q", got)
+	}
+	if got := lm.GetSearchFilteredLogs("disk (full", "ALL"); len(got) != 1 {
+		t.Errorf("the same words unwrapped found %q, want the log", got)
+	}
+}
+
+func TestServeConnTruncates(t *testing.T) {
+	for _, framing := range []Framing{LineFraming, LengthFraming, NulFraming} {
+		t.Run(framing.String(), func(t *testing.T) {
+			s := NewServer("")
+			s.SetMaxMessageSize(64)
+			serveMessages(t, s, framing, []string{"INFO: a", "INFO: " + strings.Repeat("x", 200), "INFO: b"})
+			got := s.Logs().GetFilteredLogs("ALL")
+			if len(got) != 4 || got[0] != "INFO: a" || !strings.Contains(got[1], "WARNING: line truncated") ||
+				!strings.HasPrefix(got[2], "INFO: xxx") || len(got[2]) > 64 || got[3] != "INFO: b" {
+				t.Errorf("stored %q, want the cut message after a warning, between the others", got)
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package logger
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/rivo/uniseg"
+)
+
+// StatusIcons are the markers a connection status line starts with.
+type StatusIcons struct {
+	Alive  string
+	Broken string
+}
+
+var (
+	EmojiIcons = StatusIcons{Alive: "🟢", Broken: "🔴"}
+	// ASCIIIcons suit terminals that draw emoji at the wrong width. They
+	// contain brackets, so escape the line before handing it to tview.
+	ASCIIIcons = StatusIcons{Alive: "[UP]", Broken: "[DOWN]"}
+)
+
+// ClientsText describes how many clients are connected, for the text of
+// a status line: "No Client Connected", "1 Client Connected" or
+// "3 Clients Connected", followed by the names of those that gave one,
+// as in "1 Client Connected: myservice@host123".
+func ClientsText(n int, names ...string) string {
+	var text string
+	switch n {
+	case 0:
+		return "No Client Connected"
+	case 1:
+		text = "1 Client Connected"
+	default:
+		text = fmt.Sprintf("%d Clients Connected", n)
+	}
+	if len(names) > 0 {
+		text += ": " + strings.Join(names, ", ")
+	}
+	return text
+}
+
+// ReconnectingText describes a client waiting wait to reconnect, rounded
+// up to whole seconds: "Reconnecting in 4s…".
+func ReconnectingText(wait time.Duration) string {
+	return fmt.Sprintf("Reconnecting in %ds…", int(math.Ceil(wait.Seconds())))
+}
+
+// Line renders a status line with the icon for alive. With blank set the
+// icon is swapped for spaces of the same display width, so blinking it
+// doesn't shift centered text.
+func (icons StatusIcons) Line(alive, blank bool, text string) string {
+	icon := icons.Broken
+	if alive {
+		icon = icons.Alive
+	}
+	if blank {
+		icon = strings.Repeat(" ", uniseg.StringWidth(icon))
+	}
+	return icon + " " + text
+}
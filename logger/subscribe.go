@@ -0,0 +1,80 @@
+package logger
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// subscribeRequest is sent by a server to tell a client which levels it
+// wants, e.g. "_SUBSCRIBE_ INFO,ERROR". "_SUBSCRIBE_ ALL" clears it.
+const subscribeRequest = "_SUBSCRIBE_"
+
+// Levels the protocol knows, in order of severity
+var Levels = []string{"TRACE", "DEBUG", "INFO", "WARNING", "ERROR"}
+
+// DetectLevel returns the first level a log mentions, or "" for none.
+func DetectLevel(log string) string {
+	detected, first := "", len(log)
+	for _, level := range Levels {
+		if i := strings.Index(log, level); i >= 0 && i < first {
+			detected, first = level, i
+		}
+	}
+	return detected
+}
+
+// IsVerbose reports whether log is at a level less severe than INFO, such
+// as DEBUG or TRACE, that UIs can offer to hide.
+func IsVerbose(log string) bool {
+	level, _, _ := ParseLogLine(log)
+	rank := LevelRank(level)
+	return rank >= 0 && rank < LevelRank("INFO")
+}
+
+// LevelRank returns level's place in Levels, higher being more severe, or
+// -1 for an unknown level.
+func LevelRank(level string) int {
+	return slices.Index(Levels, level)
+}
+
+// ParseLevels parses a comma-separated level list such as "INFO,ERROR".
+// An empty list or "ALL" returns nil, meaning every level.
+func ParseLevels(list string) ([]string, error) {
+	var levels []string
+	for _, level := range strings.Split(list, ",") {
+		level = strings.ToUpper(strings.TrimSpace(level))
+		switch level {
+		case "":
+			continue
+		case "ALL":
+			return nil, nil
+		}
+		if LevelRank(level) < 0 {
+			return nil, fmt.Errorf("unknown level %q", level)
+		}
+		levels = append(levels, level)
+	}
+	return levels, nil
+}
+
+func SubscribeMessage(levels []string) string {
+	if len(levels) == 0 {
+		return subscribeRequest + " ALL"
+	}
+	return subscribeRequest + " " + strings.Join(levels, ",")
+}
+
+// ParseSubscribe reports whether msg is a subscribe request and, if so,
+// the levels asked for (nil for all).
+func ParseSubscribe(msg string) ([]string, bool) {
+	list, ok := strings.CutPrefix(msg, subscribeRequest+" ")
+	if !ok {
+		return nil, false
+	}
+	levels, err := ParseLevels(list)
+	if err != nil {
+		return nil, false
+	}
+	return levels, true
+}
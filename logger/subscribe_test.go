@@ -0,0 +1,24 @@
+package logger
+
+import "testing"
+
+func TestLevelRank(t *testing.T) {
+	tests := []struct {
+		level string
+		want  int
+	}{
+		{"TRACE", 0},
+		{"DEBUG", 1},
+		{"INFO", 2},
+		{"WARNING", 3},
+		{"ERROR", 4},
+		{"FATAL", -1},
+		{"info", -1},
+		{"", -1},
+	}
+	for _, tt := range tests {
+		if got := LevelRank(tt.level); got != tt.want {
+			t.Errorf("LevelRank(%q) = %d, want %d", tt.level, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+//go:build !windows && !plan9
+
+package logger
+
+import "log/syslog"
+
+// SyslogForwarder passes logs on to a syslog daemon, at the priority
+// matching each log's level.
+type SyslogForwarder struct {
+	w *syslog.Writer
+}
+
+// NewSyslogForwarder connects to the syslog daemon at raddr over network,
+// or to the local one when both are "". Logs are tagged with tag.
+func NewSyslogForwarder(network, raddr, tag string) (*SyslogForwarder, error) {
+	w, err := syslog.Dial(network, raddr, syslog.LOG_INFO|syslog.LOG_USER, tag)
+	if err != nil {
+		return nil, err
+	}
+	return &SyslogForwarder{w: w}, nil
+}
+
+// Forward sends log to syslog. A log without a level goes as a notice.
+func (f *SyslogForwarder) Forward(log string) error {
+	switch level, _, _ := ParseLogLine(log); level {
+	case "ERROR":
+		return f.w.Err(log)
+	case "WARNING":
+		return f.w.Warning(log)
+	case "INFO":
+		return f.w.Info(log)
+	case "DEBUG", "TRACE":
+		return f.w.Debug(log)
+	}
+	return f.w.Notice(log)
+}
+
+func (f *SyslogForwarder) Close() error {
+	return f.w.Close()
+}
@@ -0,0 +1,22 @@
+//go:build windows || plan9
+
+package logger
+
+import "errors"
+
+var errNoSyslog = errors.New("syslog is not available on this system")
+
+// SyslogForwarder is unavailable here; NewSyslogForwarder always fails.
+type SyslogForwarder struct{}
+
+func NewSyslogForwarder(network, raddr, tag string) (*SyslogForwarder, error) {
+	return nil, errNoSyslog
+}
+
+func (f *SyslogForwarder) Forward(log string) error {
+	return errNoSyslog
+}
+
+func (f *SyslogForwarder) Close() error {
+	return nil
+}
@@ -0,0 +1,51 @@
+//go:build !windows && !plan9
+
+package logger
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSyslogForwarder(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	f, err := NewSyslogForwarder("udp", conn.LocalAddr().String(), "server-logger")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	// Priorities are the user facility, 8, plus each level's severity
+	tests := []struct {
+		log      string
+		priority string
+	}{
+		{"ERROR: disk full", "<11>"},
+		{"WARNING: disk nearly full", "<12>"},
+		{"INFO: disk checked", "<14>"},
+		{"DEBUG: disk queue depth 3", "<15>"},
+		{"TRACE: disk read sector 8", "<15>"},
+		{"disk spun up", "<13>"},
+	}
+	buf := make([]byte, 1024)
+	for _, tt := range tests {
+		if err := f.Forward(tt.log); err != nil {
+			t.Fatalf("Forward(%q): %v", tt.log, err)
+		}
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("reading %q: %v", tt.log, err)
+		}
+		msg := string(buf[:n])
+		if !strings.HasPrefix(msg, tt.priority) || !strings.Contains(msg, " server-logger[") || !strings.HasSuffix(msg, ": "+tt.log+"\n") {
+			t.Errorf("Forward(%q) sent %q, want priority %s, the tag and the log", tt.log, msg, tt.priority)
+		}
+	}
+}
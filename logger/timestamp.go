@@ -0,0 +1,62 @@
+package logger
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+// TimestampLayout is how clients stamp their logs. A "Z" after it marks
+// the time as UTC; without one it is the sender's local time.
+const TimestampLayout = "2006-01-02 15:04:05"
+
+// FormatTimestamp stamps t in local time, or in UTC with a "Z".
+func FormatTimestamp(t time.Time, utc bool) string {
+	if utc {
+		return t.UTC().Format(TimestampLayout) + "Z"
+	}
+	return t.Local().Format(TimestampLayout)
+}
+
+// ConvertTimestamp re-renders a log's timestamp in local time or UTC, as
+// FormatTimestamp would. Timestamps without a zone are taken as local.
+// Ones it can't place in time, such as a bare "15:04:05", come back as
+// they are.
+func ConvertTimestamp(ts string, utc bool) string {
+	if t, ok := ParseTimestamp(ts); ok {
+		return FormatTimestamp(t, utc)
+	}
+	return ts
+}
+
+// leadingTimestamp matches the timestamp a log starts with, if any, and
+// the space after it.
+var leadingTimestamp = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2}[ T])?\d{2}:\d{2}:\d{2}(\.\d+)?(Z|[+-]\d{2}:?\d{2})?\s+`)
+
+// StripTimestamp returns log without its leading timestamp.
+func StripTimestamp(log string) string {
+	return leadingTimestamp.ReplaceAllString(log, "")
+}
+
+// InsertAfterTimestamp puts text into log after its leading timestamp,
+// or at its start when it has none, keeping the timestamp first.
+func InsertAfterTimestamp(log, text string) string {
+	end := 0
+	if loc := leadingTimestamp.FindStringIndex(log); loc != nil {
+		end = loc[1]
+	}
+	return log[:end] + text + " " + log[end:]
+}
+
+// ParseTimestamp reads a log timestamp as ConvertTimestamp does, reporting
+// whether it names a point in time.
+func ParseTimestamp(ts string) (time.Time, bool) {
+	layouts := []string{time.RFC3339Nano, TimestampLayout + "Z07:00", "2006-01-02T15:04:05", TimestampLayout}
+	normalized := strings.Replace(ts, "Z", "+00:00", 1)
+	for _, layout := range layouts {
+		if t, err := time.ParseInLocation(layout, normalized, time.Local); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,67 @@
+package logger
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFormatTimestamp(t *testing.T) {
+	at := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	if got, want := FormatTimestamp(at, true), "2024-01-01 10:00:00Z"; got != want {
+		t.Errorf("FormatTimestamp(utc) = %q, want %q", got, want)
+	}
+	if got, want := FormatTimestamp(at, false), at.Local().Format(TimestampLayout); got != want {
+		t.Errorf("FormatTimestamp(local) = %q, want %q", got, want)
+	}
+}
+
+func TestConvertTimestamp(t *testing.T) {
+	local := time.Date(2024, 1, 1, 10, 0, 0, 0, time.Local)
+	tests := []struct {
+		ts   string
+		utc  bool
+		want string
+	}{
+		{"2024-01-01 10:00:00Z", true, "2024-01-01 10:00:00Z"},
+		{"2024-01-01T10:00:00Z", true, "2024-01-01 10:00:00Z"},
+		{"2024-01-01T10:00:00+02:00", true, "2024-01-01 08:00:00Z"},
+		{"2024-01-01 10:00:00-05:00", true, "2024-01-01 15:00:00Z"},
+		{"2024-01-01T10:00:00.250Z", true, "2024-01-01 10:00:00Z"},
+		// Without a zone a timestamp is local
+		{"2024-01-01 10:00:00", true, FormatTimestamp(local, true)},
+		{"2024-01-01 10:00:00", false, "2024-01-01 10:00:00"},
+		{"2024-01-01 10:00:00Z", false, FormatTimestamp(time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC), false)},
+		// Ones that can't be placed in time come back as they are
+		{"15:04:05", true, "15:04:05"},
+		{"yesterday", false, "yesterday"},
+	}
+	for _, tt := range tests {
+		if got := ConvertTimestamp(tt.ts, tt.utc); got != tt.want {
+			t.Errorf("ConvertTimestamp(%q, %v) = %q, want %q", tt.ts, tt.utc, got, tt.want)
+		}
+	}
+}
+
+func TestParseTimestamp(t *testing.T) {
+	tests := []struct {
+		ts   string
+		want time.Time
+		ok   bool
+	}{
+		{"2024-01-01T10:00:00Z", time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC), true},
+		{"2024-01-01T10:00:00.5+02:00", time.Date(2024, 1, 1, 8, 0, 0, 5e8, time.UTC), true},
+		{"2024-01-01 10:00:00Z", time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC), true},
+		{"2024-01-01 10:00:00-05:00", time.Date(2024, 1, 1, 15, 0, 0, 0, time.UTC), true},
+		{"2024-01-01T10:00:00", time.Date(2024, 1, 1, 10, 0, 0, 0, time.Local), true},
+		{"2024-01-01 10:00:00", time.Date(2024, 1, 1, 10, 0, 0, 0, time.Local), true},
+		{"10:00:00", time.Time{}, false},
+		{"2024-13-01 10:00:00", time.Time{}, false},
+		{"", time.Time{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := ParseTimestamp(tt.ts)
+		if ok != tt.ok || !got.Equal(tt.want) {
+			t.Errorf("ParseTimestamp(%q) = %v, %v, want %v, %v", tt.ts, got, ok, tt.want, tt.ok)
+		}
+	}
+}
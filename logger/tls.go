@@ -0,0 +1,50 @@
+package logger
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// tlsHandshakeTimeout is how long the server gives a client to finish
+// the TLS handshake.
+const tlsHandshakeTimeout = 5 * time.Second
+
+// LoadServerTLS returns the config a server listens for TLS with, from a
+// PEM certificate and key. With neither given it returns nil, for plain
+// TCP.
+func LoadServerTLS(certFile, keyFile string) (*tls.Config, error) {
+	if certFile == "" && keyFile == "" {
+		return nil, nil
+	}
+	if certFile == "" || keyFile == "" {
+		return nil, errors.New("a certificate and a key are both needed")
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}, nil
+}
+
+// LoadClientTLS returns the config a client dials with over TLS. The
+// server's certificate is verified against the PEM certificates in
+// caFile, or with "" the system's roots.
+func LoadClientTLS(caFile string) (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caFile == "" {
+		return config, nil
+	}
+	data, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	config.RootCAs = x509.NewCertPool()
+	if !config.RootCAs.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in %s", caFile)
+	}
+	return config, nil
+}
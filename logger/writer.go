@@ -0,0 +1,76 @@
+package logger
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+)
+
+// LogSink is somewhere logs can be stored, such as a LogManager or, so
+// its OnLog hook runs too, a Server.
+type LogSink interface {
+	AddLog(log string)
+}
+
+// ColorWriter is an io.Writer that turns what is written to it into logs,
+// one per line, so output from the standard log package or anything else
+// writing text shows up in a UI, colored by level like any other log:
+//
+//	log.SetOutput(logger.NewColorWriter(server, "INFO"))
+//
+// Writes need not end on a line break; a partial line is held until the
+// rest of it arrives or Flush is called.
+type ColorWriter struct {
+	sink  LogSink
+	level string
+
+	mu      sync.Mutex
+	partial []byte
+}
+
+// NewColorWriter returns a writer storing lines in sink. Lines that don't
+// mention a level are given level, so they are colored as one; "" leaves
+// them as they are.
+func NewColorWriter(sink LogSink, level string) *ColorWriter {
+	return &ColorWriter{sink: sink, level: level}
+}
+
+func (w *ColorWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.partial = append(w.partial, p...)
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			break
+		}
+		w.addLocked(string(w.partial[:i]))
+		w.partial = w.partial[i+1:]
+	}
+	// Don't keep a large buffer alive once its lines are out
+	if len(w.partial) == 0 {
+		w.partial = nil
+	}
+	return len(p), nil
+}
+
+// Flush stores a partial line still waiting for its line break.
+func (w *ColorWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.partial) > 0 {
+		w.addLocked(string(w.partial))
+		w.partial = nil
+	}
+}
+
+func (w *ColorWriter) addLocked(line string) {
+	line = strings.TrimSuffix(line, "\r")
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	if w.level != "" && DetectLevel(line) == "" {
+		line = w.level + ": " + line
+	}
+	w.sink.AddLog(line)
+}
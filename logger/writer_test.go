@@ -0,0 +1,40 @@
+package logger
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestColorWriter(t *testing.T) {
+	tests := []struct {
+		name   string
+		level  string
+		writes []string
+		flush  bool
+		want   []string
+	}{
+		{"lines", "INFO", []string{"one\ntwo\n"}, false, []string{"INFO: one", "INFO: two"}},
+		{"split across writes", "INFO", []string{"par", "tial\nnext", " line\n"}, false, []string{"INFO: partial", "INFO: next line"}},
+		{"partial held", "INFO", []string{"done\nhalf"}, false, []string{"INFO: done"}},
+		{"partial flushed", "INFO", []string{"done\nhalf"}, true, []string{"INFO: done", "INFO: half"}},
+		{"crlf and blanks", "INFO", []string{"one\r\n\r\n  \ntwo\n"}, false, []string{"INFO: one", "INFO: two"}},
+		{"own level kept", "INFO", []string{"ERROR: disk full\n"}, false, []string{"ERROR: disk full"}},
+		{"no level", "", []string{"plain\n"}, false, []string{"plain"}},
+		{"nothing to flush", "INFO", []string{"one\n"}, true, []string{"INFO: one"}},
+	}
+	for _, tt := range tests {
+		lm := NewLogManager(0)
+		w := NewColorWriter(lm, tt.level)
+		for _, p := range tt.writes {
+			if n, err := w.Write([]byte(p)); n != len(p) || err != nil {
+				t.Fatalf("%s: Write(%q) = %d, %v", tt.name, p, n, err)
+			}
+		}
+		if tt.flush {
+			w.Flush()
+		}
+		if got := lm.GetFilteredLogs("ALL"); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: stored %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}